@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// defaultSite - сайт, для которого парсер был написан изначально
+const defaultSite = "stanki.ru"
+
+// SiteAdapter описывает особенности конкретного сайта: адреса, разметку категорий, списков
+// и страниц товаров, устройство пагинации. Загрузка страниц, потоки, задержки, robots.txt,
+// обогащение и выгрузка результатов от сайта не зависят и адаптеру не нужны
+type SiteAdapter interface {
+	// Name - имя сайта для флага -site
+	Name() string
+	// BaseURL - адрес сайта без завершающего слэша
+	BaseURL() string
+	// CatalogPath - путь раздела каталога основной версии сайта со слэшами, например /catalog/
+	CatalogPath() string
+	// BrandsPath - путь страницы со списком брендов для -brand-pages; пустой, если ее нет
+	BrandsPath() string
+	// Selectors - CSS-селекторы разметки по умолчанию; файл -selectors может их переопределить
+	Selectors() siteSelectors
+
+	// ParseCategories находит категории на странице каталога; адреса абсолютные
+	ParseCategories(doc *goquery.Document) []Category
+	// Pagination определяет способ пагинации по загруженной странице списка doc. Для nil
+	// возвращается способ по умолчанию, которым загружаются страницы до первой разобранной
+	Pagination(doc *goquery.Document) Pagination
+	// ParseProductList извлекает товары со страницы списка и сообщает, есть ли следующая страница.
+	// При priceOnly достаточно ID, названия, адреса и цены
+	ParseProductList(doc *goquery.Document, category Category, priceOnly bool) ([]Product, bool)
+	// LastPage возвращает номер последней страницы из ссылок пагинации (1, если их нет)
+	LastPage(doc *goquery.Document) int
+	// ParseProductDetails извлекает данные со страницы товара pageURL
+	ParseProductDetails(doc *goquery.Document, pageURL string) Product
+}
+
+// siteAdapters - зарегистрированные адаптеры по имени
+var siteAdapters = make(map[string]SiteAdapter)
+
+var (
+	// site - адаптер выбранного сайта; задается useSiteAdapter до начала работы
+	site SiteAdapter
+	// baseURL и catalogURL - адреса выбранного сайта
+	baseURL    string
+	catalogURL string
+)
+
+// registerSiteAdapter добавляет адаптер в реестр; вызывается из init файла адаптера
+func registerSiteAdapter(adapter SiteAdapter) {
+	name := strings.ToLower(adapter.Name())
+	if _, exists := siteAdapters[name]; exists {
+		panic(fmt.Sprintf("адаптер сайта %s зарегистрирован дважды", name))
+	}
+	siteAdapters[name] = adapter
+}
+
+// useSiteAdapter выбирает адаптер по имени и задает адреса сайта
+func useSiteAdapter(name string) error {
+	adapter, ok := siteAdapters[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return fmt.Errorf("неизвестный сайт %q (допустимо: %s)", name, strings.Join(slices.Sorted(maps.Keys(siteAdapters)), ", "))
+	}
+
+	site = adapter
+	baseURL = strings.TrimSuffix(adapter.BaseURL(), "/")
+	catalogURL = baseURL + adapter.CatalogPath()
+	markup = adapter.Selectors()
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// availabilityPhrases - фразы о наличии и соответствующие значения schema.org. Порядок важен:
+// "нет в наличии" проверяется раньше "в наличии", "под заказ" - раньше срока поставки
+var availabilityPhrases = []struct {
+	phrase string
+	value  string
+}{
+	{"снят с производства", "Discontinued"},
+	{"нет в наличии", "OutOfStock"},
+	{"нет на складе", "OutOfStock"},
+	{"отсутствует", "OutOfStock"},
+	{"распродан", "SoldOut"},
+	{"предзаказ", "PreOrder"},
+	{"ожидается", "PreOrder"},
+	{"под заказ", "BackOrder"},
+	{"на заказ", "BackOrder"},
+	{"мало", "LimitedAvailability"},
+	{"заканчивается", "LimitedAvailability"},
+	{"в наличии", "InStock"},
+	{"на складе", "InStock"},
+	{"есть", "InStock"},
+	{"много", "InStock"},
+	{"срок поставки", "BackOrder"},
+	{"поставка", "BackOrder"},
+}
+
+// deliveryTimeRe находит срок поставки: "5 дней", "14-21 раб. дн.", "2 недели", "1–2 мес."
+var deliveryTimeRe = regexp.MustCompile(`(?i)\d+(?:\s*[-–—]\s*\d+)?\s*(?:рабоч\S*\s+|раб\.?\s*)?(?:дн\S*|день|недел\S*|мес\S*)`)
+
+// availabilityFromText определяет наличие по тексту карточки или страницы товара ("В наличии",
+// "Под заказ, срок поставки 14-21 день") и возвращает значение schema.org и срок поставки, если он указан
+func availabilityFromText(text string) (availability, deliveryTime string) {
+	lower := strings.ToLower(text)
+	for _, p := range availabilityPhrases {
+		if strings.Contains(lower, p.phrase) {
+			availability = p.value
+			break
+		}
+	}
+
+	deliveryTime = strings.Join(strings.Fields(deliveryTimeRe.FindString(text)), " ")
+	// Срок поставки без других признаков означает товар под заказ
+	if availability == "" && deliveryTime != "" {
+		availability = "BackOrder"
+	}
+	return availability, deliveryTime
+}
+
+// availabilityInStock сообщает, можно ли купить товар сразу: значения schema.org,
+// означающие товар на складе
+func availabilityInStock(availability string) bool {
+	switch availability {
+	case "InStock", "LimitedAvailability", "InStoreOnly", "OnlineOnly":
+		return true
+	}
+	return false
+}
+
+// applyAvailabilityText записывает в товар текст о наличии и срок поставки. Значение
+// из разметки schema.org точнее текста, поэтому текст определяет наличие, только если разметки нет
+func applyAvailabilityText(product *Product, text string) {
+	text = strings.Join(strings.Fields(text), " ")
+	if text != "" {
+		availability, deliveryTime := availabilityFromText(text)
+		product.AvailabilityText = text
+		product.DeliveryTime = deliveryTime
+		if product.Availability == "" {
+			product.Availability = availability
+		}
+	}
+	product.InStock = availabilityInStock(product.Availability)
+}
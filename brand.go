@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Названия характеристик с брендом и производителем. "Производитель" на сайтах станков
+// обычно и есть бренд, поэтому бренд без своей характеристики берется из производителя
+var (
+	brandSpecNames        = []string{"бренд", "торговая марка", "марка", "brand"}
+	manufacturerSpecNames = []string{"производитель", "изготовитель", "завод-изготовитель", "manufacturer"}
+)
+
+// brands - бренды со страниц брендов сайта (-brand-pages); nil, если они не загружались
+var brands *brandCatalog
+
+// fillBrandFromSpecs заполняет бренд и производителя из характеристик товара, если их нет
+func fillBrandFromSpecs(product *Product) {
+	if product.Manufacturer == "" {
+		product.Manufacturer = specValue(*product, manufacturerSpecNames)
+	}
+	if product.Brand == "" {
+		product.Brand = specValue(*product, brandSpecNames)
+	}
+	if product.Brand == "" {
+		product.Brand = product.Manufacturer
+	}
+}
+
+// brandFromLink возвращает бренд из ссылки на страницу бренда на странице товара:
+// текст ссылки, а для ссылки-логотипа - alt или title изображения
+func brandFromLink(doc *goquery.Document, links string) string {
+	link := doc.Find(links).First()
+	if link.Length() == 0 {
+		return ""
+	}
+	if name := strings.Join(strings.Fields(link.Text()), " "); name != "" {
+		return name
+	}
+	for _, attr := range []string{"title", "alt"} {
+		if name := strings.TrimSpace(link.AttrOr(attr, "")); name != "" {
+			return name
+		}
+		if name := strings.TrimSpace(link.Find("img").AttrOr(attr, "")); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// brandCatalog - бренды сайта и товары, найденные на их страницах
+type brandCatalog struct {
+	mu      sync.Mutex
+	names   map[string]string // Название в нижнем регистре -> название как на сайте
+	byID    map[string]string // ID товара -> бренд
+	Brands  int
+	Matched int
+}
+
+// loadBrandCatalog загружает страницу со списком брендов (BrandsPath адаптера), а затем
+// списки товаров на страницах брендов - так бренд становится известен и товарам,
+// у которых его нет ни в характеристиках, ни в разметке
+func loadBrandCatalog(ctx context.Context, semaphore chan struct{}, delayMs int) (*brandCatalog, error) {
+	if site.BrandsPath() == "" {
+		return nil, fmt.Errorf("у сайта %s нет страницы брендов", site.Name())
+	}
+
+	indexURL := baseURL + site.BrandsPath()
+	resp, err := doRequestWithRetry(ctx, indexURL, 3, delayMs)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ошибка при получении страницы брендов: %d", resp.StatusCode)
+	}
+
+	utf8Reader, err := responseUTF8Reader(resp)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(utf8Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := &brandCatalog{names: make(map[string]string), byID: make(map[string]string)}
+
+	var pages []Category
+	seenURLs := make(map[string]bool)
+	doc.Find(markup.BrandIndexLinks).Each(func(_ int, s *goquery.Selection) {
+		name := strings.Join(strings.Fields(s.Text()), " ")
+		if name == "" {
+			name = strings.TrimSpace(s.Find("img").AttrOr("alt", ""))
+		}
+		href, ok := s.Attr("href")
+		if name == "" || !ok {
+			return
+		}
+		u, err := base.Parse(href)
+		if err != nil {
+			return
+		}
+		pageURL := u.String()
+		if seenURLs[pageURL] || !scope.Allowed(pageURL) {
+			return
+		}
+		seenURLs[pageURL] = true
+		catalog.names[strings.ToLower(name)] = name
+		pages = append(pages, Category{Name: name, URL: pageURL})
+	})
+	catalog.Brands = len(pages)
+	slog.Info("Найдены страницы брендов", "brands", len(pages))
+
+	var wg sync.WaitGroup
+	for _, page := range pages {
+		wg.Add(1)
+		go func(page Category) {
+			defer wg.Done()
+			products, err := getProductsFromCategory(ctx, page, semaphore, 1, 0, maxCategoryPages, delayMs, true, 0)
+			if err != nil {
+				slog.Warn("Не удалось загрузить товары бренда", "brand", page.Name, "url", page.URL, "err", err)
+				return
+			}
+			catalog.mu.Lock()
+			for _, product := range products {
+				catalog.byID[product.ID] = page.Name
+			}
+			catalog.mu.Unlock()
+		}(page)
+	}
+	wg.Wait()
+
+	return catalog, ctx.Err()
+}
+
+// Apply заполняет пустой бренд товара: по ID товара со страниц брендов, а без него -
+// по элементу навигационной цепочки, совпадающему с названием бренда
+func (c *brandCatalog) Apply(product Product) Product {
+	if c == nil || product.Brand != "" {
+		return product
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	brand, ok := c.byID[product.ID]
+	for i := len(product.CategoryPath) - 1; !ok && i >= 0; i-- {
+		brand, ok = c.names[strings.ToLower(product.CategoryPath[i])]
+	}
+	if ok {
+		product.Brand = brand
+		c.Matched++
+	}
+	return product
+}
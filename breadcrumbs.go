@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// breadcrumbHome - названия ссылки на главную страницу в начале цепочки; в путь категории не входят
+var breadcrumbHome = map[string]bool{"главная": true, "главная страница": true, "home": true}
+
+// extractBreadcrumbs возвращает путь категории товара из навигационной цепочки страницы:
+// сначала из разметки schema.org BreadcrumbList (JSON-LD, микроданные), затем по селектору
+// ссылок цепочки links. Ссылка на главную и последний элемент с названием самого товара отбрасываются
+func extractBreadcrumbs(doc *goquery.Document, links, productName string) []string {
+	path := jsonLDBreadcrumbs(doc)
+	if len(path) == 0 {
+		path = microdataBreadcrumbs(doc)
+	}
+	if len(path) == 0 {
+		doc.Find(links).Each(func(_ int, s *goquery.Selection) {
+			if name := strings.Join(strings.Fields(s.Text()), " "); name != "" {
+				path = append(path, name)
+			}
+		})
+	}
+
+	for len(path) > 0 && breadcrumbHome[strings.ToLower(path[0])] {
+		path = path[1:]
+	}
+	if n := len(path); n > 0 && productName != "" && strings.EqualFold(path[n-1], productName) {
+		path = path[:n-1]
+	}
+	if len(path) == 0 {
+		return nil
+	}
+	return path
+}
+
+// breadcrumbItem - элемент цепочки с номером позиции
+type breadcrumbItem struct {
+	position int
+	name     string
+}
+
+// sortedBreadcrumbNames упорядочивает элементы по position (без него - в порядке разметки)
+func sortedBreadcrumbNames(items []breadcrumbItem) []string {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].position < items[j].position })
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.name != "" {
+			names = append(names, item.name)
+		}
+	}
+	return names
+}
+
+// jsonLDBreadcrumbs ищет BreadcrumbList в блоках JSON-LD страницы, включая массивы и @graph
+func jsonLDBreadcrumbs(doc *goquery.Document) []string {
+	var names []string
+
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s.Text())), &data); err != nil {
+			return true
+		}
+		list := findJSONLDType(data, "BreadcrumbList")
+		if list == nil {
+			return true
+		}
+
+		elements, _ := list["itemListElement"].([]interface{})
+		var items []breadcrumbItem
+		for i, element := range elements {
+			node, ok := element.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			item := breadcrumbItem{position: i, name: jsonLDString(node["name"])}
+			if item.name == "" {
+				item.name = jsonLDName(node["item"])
+			}
+			if position, ok := node["position"].(float64); ok {
+				item.position = int(position)
+			}
+			items = append(items, item)
+		}
+		names = sortedBreadcrumbNames(items)
+		return len(names) == 0
+	})
+
+	return names
+}
+
+// microdataBreadcrumbs извлекает цепочку из микроразметки itemtype="https://schema.org/BreadcrumbList"
+func microdataBreadcrumbs(doc *goquery.Document) []string {
+	scope := doc.Find("[itemscope][itemtype]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return strings.EqualFold(schemaName(s.AttrOr("itemtype", "")), "BreadcrumbList")
+	}).First()
+	if scope.Length() == 0 {
+		return nil
+	}
+
+	var items []breadcrumbItem
+	microdataProps(scope, "itemListElement").Each(func(i int, element *goquery.Selection) {
+		item := breadcrumbItem{position: i, name: microdataValue(microdataProps(element, "name").First())}
+		// Название может быть свойством вложенной сущности item
+		if item.name == "" {
+			if nested := microdataProps(element, "item").First(); nested.Is("[itemscope]") {
+				item.name = microdataValue(microdataProps(nested, "name").First())
+			}
+		}
+		if item.name == "" {
+			item.name = strings.Join(strings.Fields(element.Text()), " ")
+		}
+		if position, err := strconv.Atoi(microdataValue(microdataProps(element, "position").First())); err == nil {
+			item.position = position
+		}
+		items = append(items, item)
+	})
+	return sortedBreadcrumbNames(items)
+}
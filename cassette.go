@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cassetteEntry - записанный ответ; тело хранится рядом в файле <ключ>.body без изменений
+type cassetteEntry struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	RecordedAt time.Time   `json:"recorded_at"`
+}
+
+// cassetteTransport записывает ответы запуска в каталог-кассету (-record-dir) или отвечает
+// записанными ответами, не обращаясь к сайту (-replay-dir). Запись стоит после распаковки
+// сжатых ответов, поэтому в кассете то же тело, которое разбирает парсер
+type cassetteTransport struct {
+	dir    string
+	replay bool
+	next   http.RoundTripper
+}
+
+// newCassetteTransport создает транспорт записи (replay = false) или воспроизведения кассеты dir
+func newCassetteTransport(next http.RoundTripper, dir string, replay bool) (*cassetteTransport, error) {
+	if replay {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("кассета %s не найдена", dir)
+		}
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &cassetteTransport{dir: dir, replay: replay, next: next}, nil
+}
+
+// cassetteKey - имя файлов записи: хеш метода и адреса. Повторный запрос того же адреса
+// перезаписывает запись, поэтому в кассете остается последний ответ
+func cassetteKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := filepath.Join(t.dir, cassetteKey(req))
+	if t.replay {
+		return t.play(req, base)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := cassetteEntry{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		RecordedAt: time.Now().UTC(),
+	}
+	// Ошибка записи не должна прерывать обход: страница уже загружена
+	if err := writeCassetteEntry(base, entry, body); err != nil {
+		slog.Warn("Не удалось записать ответ в кассету", "url", entry.URL, "err", err)
+	}
+	return resp, nil
+}
+
+// writeCassetteEntry записывает тело, затем описание ответа; каждый файл - через временный,
+// поэтому прерванная запись не оставляет в кассете половину ответа
+func writeCassetteEntry(base string, entry cassetteEntry, body []byte) error {
+	meta, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{{base + ".body", body}, {base + ".json", meta}} {
+		tmp := file.name + ".tmp"
+		if err := os.WriteFile(tmp, file.data, 0o644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, file.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// play отвечает записанным ответом. Адрес, которого нет в кассете, получает ответ 404:
+// прогон продолжается так же, как на сайте, где страницы нет
+func (t *cassetteTransport) play(req *http.Request, base string) (*http.Response, error) {
+	var entry cassetteEntry
+	meta, err := os.ReadFile(base + ".json")
+	if err == nil {
+		err = json.Unmarshal(meta, &entry)
+	}
+	if err != nil {
+		slog.Warn("Ответа нет в кассете", "url", req.URL.String(), "err", err)
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)),
+			StatusCode: http.StatusNotFound,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	body, err := os.ReadFile(base + ".body")
+	if err != nil {
+		return nil, fmt.Errorf("кассета повреждена: %v", err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode)),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
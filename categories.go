@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// parseCategoryURLs разбирает список URL категорий, переданный через -categories,
+// проверяет и нормализует каждый URL и убирает дубликаты.
+// Все найденные ошибки возвращаются одним сообщением, чтобы их можно было исправить за один раз
+func parseCategoryURLs(ctx context.Context, raw string, delayMs int) ([]Category, error) {
+	var categories []Category
+	var problems []string
+	seen := make(map[string]bool)
+
+	for _, rawURL := range strings.Split(raw, ",") {
+		rawURL = strings.TrimSpace(rawURL)
+		if rawURL == "" {
+			continue
+		}
+
+		categoryURL, err := normalizeCategoryURL(rawURL)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("  %s: %v", rawURL, err))
+			continue
+		}
+
+		if !scope.Allowed(categoryURL) {
+			problems = append(problems, fmt.Sprintf("  %s: адрес за пределами области обхода %s", rawURL, scope))
+			continue
+		}
+
+		if seen[categoryURL] {
+			fmt.Printf("Пропущен повтор категории: %s\n", rawURL)
+			continue
+		}
+		seen[categoryURL] = true
+
+		// Проверяем доступность категории до начала парсинга
+		if err := checkCategoryReachable(ctx, categoryURL, delayMs); err != nil {
+			problems = append(problems, fmt.Sprintf("  %s: %v", rawURL, err))
+			continue
+		}
+
+		categories = append(categories, Category{
+			Name: categoryNameFromURL(categoryURL),
+			URL:  categoryURL,
+		})
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("некорректные URL категорий:\n%s", strings.Join(problems, "\n"))
+	}
+
+	if len(categories) == 0 {
+		return nil, errors.New("список категорий пуст")
+	}
+
+	return categories, nil
+}
+
+// normalizeCategoryURL проверяет, что URL указывает на раздел каталога сайта,
+// и приводит его к каноническому виду: абсолютный адрес, основной хост, завершающий слэш
+func normalizeCategoryURL(rawURL string) (string, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("не удалось разобрать URL: %v", err)
+	}
+
+	// Относительный путь вида /catalog/... дополняем адресом сайта
+	if u.Host == "" && strings.HasPrefix(u.Path, "/") {
+		u.Scheme = base.Scheme
+		u.Host = base.Host
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("ожидается адрес вида %s<категория>/", catalogURL)
+	}
+
+	if strings.TrimPrefix(u.Host, "www.") != strings.TrimPrefix(base.Host, "www.") {
+		return "", fmt.Errorf("адрес должен относиться к сайту %s, а не %s", base.Host, u.Host)
+	}
+
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	// Адрес можно указать как в основной, так и в выбранной языковой версии
+	u.Path = delocalizePath(u.Path)
+
+	if !strings.HasPrefix(u.Path, site.CatalogPath()) {
+		return "", fmt.Errorf("адрес должен находиться в разделе %s", site.CatalogPath())
+	}
+	if u.Path == site.CatalogPath() {
+		return "", errors.New("укажите конкретную категорию, а не корень каталога")
+	}
+
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	u.Fragment = ""
+
+	return localizeURL(u.String()), nil
+}
+
+// checkCategoryReachable проверяет, что страница категории открывается
+func checkCategoryReachable(ctx context.Context, categoryURL string, delayMs int) error {
+	resp, err := doRequestWithRetry(ctx, categoryURL, 2, delayMs)
+	if err != nil {
+		return fmt.Errorf("страница недоступна: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("страница недоступна: код ответа %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// categoryNameFromURL формирует название категории из последнего непустого элемента URL
+func categoryNameFromURL(categoryURL string) string {
+	parts := strings.Split(categoryURL, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if parts[i] != "" {
+			name := strings.ReplaceAll(parts[i], "_", " ")
+			return cases.Title(language.Russian).String(name)
+		}
+	}
+	return ""
+}
+
+// categorySkipList - категории, которые не обходятся (-skip-categories, -skip-categories-file):
+// адреса разделов каталога и подстроки названий
+type categorySkipList struct {
+	urls  []string // Нормализованные адреса; пропускаются и их подкатегории
+	names []string // Подстроки названий в нижнем регистре
+}
+
+// loadCategorySkipList собирает список из флага (через запятую) и файла (по одному в строке,
+// строки с # игнорируются). Значение, начинающееся с http://, https:// или /, считается адресом
+// категории, остальные - подстрокой названия без учета регистра. Пустой список возвращается как nil
+func loadCategorySkipList(list, file string) (*categorySkipList, error) {
+	raw := strings.Split(list, ",")
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); !strings.HasPrefix(line, "#") {
+				raw = append(raw, line)
+			}
+		}
+	}
+
+	skip := &categorySkipList{}
+	var problems []string
+	for _, value := range raw {
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+			continue
+		case strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") || strings.HasPrefix(value, "/"):
+			categoryURL, err := normalizeCategoryURL(value)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("  %s: %v", value, err))
+				continue
+			}
+			skip.urls = append(skip.urls, categoryURL)
+		default:
+			skip.names = append(skip.names, strings.ToLower(value))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("некорректные адреса категорий:\n%s", strings.Join(problems, "\n"))
+	}
+	if len(skip.urls) == 0 && len(skip.names) == 0 {
+		return nil, nil
+	}
+	return skip, nil
+}
+
+// Match проверяет, что категория или раздел, в который она вложена, есть в списке пропуска
+func (s *categorySkipList) Match(category Category) bool {
+	if s == nil {
+		return false
+	}
+	for _, prefix := range s.urls {
+		if strings.HasPrefix(category.URL, prefix) {
+			return true
+		}
+	}
+	name := strings.ToLower(category.Name)
+	for _, substring := range s.names {
+		if strings.Contains(name, substring) {
+			return true
+		}
+	}
+	return false
+}
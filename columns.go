@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// fieldColumn - поле товара, доступное как колонка -csv-columns и в проверках test-rules
+type fieldColumn struct {
+	header string
+	value  func(Product) string
+}
+
+// productFields - поля товара по имени; имена совпадают с ключами JSON. Списки объединяются через "|"
+var productFields = map[string]fieldColumn{
+	"id":                {"ID", func(p Product) string { return p.ID }},
+	"name":              {"Название", func(p Product) string { return p.Name }},
+	"url":               {"URL", func(p Product) string { return p.URL }},
+	"description":       {"Описание", func(p Product) string { return p.Description }},
+	"price":             {"Цена", func(p Product) string { return p.Price }},
+	"image":             {"URL изображения", func(p Product) string { return p.ImageURL }},
+	"image_alt":         {"Alt изображения", func(p Product) string { return p.ImageAlt }},
+	"images":            {"Изображения", func(p Product) string { return strings.Join(p.Images, "|") }},
+	"category":          {"Категория", func(p Product) string { return p.Category }},
+	"category_path":     {"Путь категории", func(p Product) string { return strings.Join(p.CategoryPath, " > ") }},
+	"features":          {"Характеристики", func(p Product) string { return strings.Join(p.Features, "|") }},
+	"specs":             {"Характеристики", func(p Product) string { return specsText(p.Specs) }},
+	"sku":               {"Артикул", func(p Product) string { return p.SKU }},
+	"brand":             {"Бренд", func(p Product) string { return p.Brand }},
+	"manufacturer":      {"Производитель", func(p Product) string { return p.Manufacturer }},
+	"availability":      {"Наличие", func(p Product) string { return p.Availability }},
+	"availability_text": {"Наличие на сайте", func(p Product) string { return p.AvailabilityText }},
+	"delivery_time":     {"Срок поставки", func(p Product) string { return p.DeliveryTime }},
+	"in_stock":          {"В наличии", func(p Product) string { return yesNo(p.InStock, "нет") }},
+	"gallery":           {"Подписи изображений", func(p Product) string { return galleryTexts(p.Gallery) }},
+	"variants":          {"Варианты", func(p Product) string { return variantsText(p.Variants) }},
+	"locale":            {"Язык", func(p Product) string { return p.Locale }},
+	"local_image":       {"Локальное изображение", func(p Product) string { return p.LocalImagePath }},
+	"noindex":           {"Noindex", func(p Product) string { return yesNo(p.NoIndex, "") }},
+	"change_type":       {"Изменение", func(p Product) string { return p.ChangeType }},
+	"seen_before":       {"Известен ранее", func(p Product) string { return yesNo(p.SeenBefore, "") }},
+	"first_seen":        {"Впервые найден", func(p Product) string { return p.FirstSeen }},
+}
+
+// yesNo возвращает "да" для true и no для false
+func yesNo(value bool, no string) string {
+	if value {
+		return "да"
+	}
+	return no
+}
+
+// specsText объединяет характеристики в строку "название: значение|..." в порядке названий
+func specsText(specs map[string]string) string {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + specs[name]
+	}
+	return strings.Join(parts, "|")
+}
+
+// checkProductField проверяет имя поля: одно из productFields или specs.<название>
+func checkProductField(name string) error {
+	if spec, ok := strings.CutPrefix(name, "specs."); ok {
+		if spec == "" {
+			return fmt.Errorf("не указано название характеристики в %q", name)
+		}
+		return nil
+	}
+	if _, ok := productFields[name]; !ok {
+		names := make([]string, 0, len(productFields))
+		for known := range productFields {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("неизвестное поле %q (допустимо: %s, specs.<название>)", name, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// productFieldValue возвращает значение поля товара; specs.<название> - значение одной характеристики
+func productFieldValue(product Product, name string) string {
+	if spec, ok := strings.CutPrefix(name, "specs."); ok {
+		return product.Specs[spec]
+	}
+	return productFields[name].value(product)
+}
+
+// tableColumns - колонки таблицы CSV или XLSX: заголовки и значения для товара
+type tableColumns interface {
+	Headers() []string
+	Row(product Product) []string
+}
+
+// csvColumns - колонки CSV, выбранные флагом -csv-columns; пусто - колонки по умолчанию
+var csvColumns selectedColumns
+
+// selectedColumns - колонки, заданные списком полей в нужном порядке
+type selectedColumns []string
+
+// parseSelectedColumns разбирает список полей через запятую: "id,name,price,specs.Мощность"
+func parseSelectedColumns(value string) (selectedColumns, error) {
+	var columns selectedColumns
+	for _, part := range strings.Split(value, ",") {
+		name := strings.TrimSpace(part)
+		if name == "" {
+			continue
+		}
+		// Названия характеристик сохраняют регистр, имена полей - нет
+		if !strings.HasPrefix(strings.ToLower(name), "specs.") {
+			name = strings.ToLower(name)
+		} else {
+			name = "specs." + name[len("specs."):]
+		}
+		if err := checkProductField(name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+// Headers возвращает заголовки: названия полей как в колонках по умолчанию, для характеристики - ее название
+func (c selectedColumns) Headers() []string {
+	headers := make([]string, len(c))
+	for i, name := range c {
+		if spec, ok := strings.CutPrefix(name, "specs."); ok {
+			headers[i] = spec
+			continue
+		}
+		headers[i] = productFields[name].header
+	}
+	return headers
+}
+
+// Row возвращает значения выбранных полей товара
+func (c selectedColumns) Row(product Product) []string {
+	row := make([]string, len(c))
+	for i, name := range c {
+		row[i] = productFieldValue(product, name)
+	}
+	return row
+}
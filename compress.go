@@ -0,0 +1,46 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// compressOutput - сжимать файлы json, csv и ndjson в gzip (-compress-output)
+var compressOutput bool
+
+// compressedFormats - форматы, которые -compress-output сжимает в gzip. XLSX уже архив zip,
+// а ndjson.zst сжат zstd
+var compressedFormats = map[string]bool{"json": true, "csv": true, "ndjson": true}
+
+// resultFormat возвращает формат файла с учетом -compress-output: json -> json.gz. Расширение
+// файла результатов берется из формата, поэтому имена получаются products.json.gz
+func resultFormat(format string) string {
+	if compressOutput && compressedFormats[format] {
+		return format + ".gz"
+	}
+	return format
+}
+
+// gzipFile - файл результатов, который сжимается по мере записи. Close дописывает
+// конец потока gzip и закрывает файл
+type gzipFile struct {
+	*gzip.Writer
+	file io.WriteCloser
+}
+
+// newGzipFile сжимает запись в file; имя внутри архива - имя файла без .gz
+func newGzipFile(file io.WriteCloser, filename string) *gzipFile {
+	zw := gzip.NewWriter(file)
+	zw.Name = strings.TrimSuffix(filepath.Base(filename), ".gz")
+	return &gzipFile{Writer: zw, file: file}
+}
+
+func (f *gzipFile) Close() error {
+	if err := f.Writer.Close(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
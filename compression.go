@@ -0,0 +1,89 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding - сжатия, которые парсер запрашивает и распаковывает сам
+const acceptEncoding = "gzip, br"
+
+// decompressTransport запрашивает сжатые ответы и распаковывает их до определения кодировки.
+// Стандартный транспорт умеет только gzip и только если Accept-Encoding задает он сам;
+// brotli сжимает HTML заметно лучше, а страниц товаров за запуск - тысячи
+type decompressTransport struct {
+	base http.RoundTripper
+}
+
+// newDecompressTransport оборачивает транспорт base. Если base не задан, используется стандартный
+func newDecompressTransport(base http.RoundTripper) *decompressTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &decompressTransport{base: base}
+}
+
+// RoundTrip добавляет Accept-Encoding, если он не задан, и подменяет тело ответа распакованным.
+// Content-Encoding и Content-Length после распаковки удаляются, как это делает net/http для gzip
+func (t *decompressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Accept-Encoding, заданный вызывающим, означает, что сжатый ответ ему и нужен
+	if req.Header.Get("Accept-Encoding") != "" || req.Method == http.MethodHead {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var open func(io.Reader) (io.Reader, error)
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		open = func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }
+	case "br":
+		open = func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }
+	default:
+		return resp, nil
+	}
+
+	resp.Body = &decompressedBody{compressed: resp.Body, open: open}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// decompressedBody распаковывает тело при первом чтении: заголовок gzip читается из сети,
+// и делать это внутри RoundTrip значило бы ждать тело до возврата ответа
+type decompressedBody struct {
+	compressed io.ReadCloser
+	open       func(io.Reader) (io.Reader, error)
+	reader     io.Reader
+	err        error
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.err = b.open(b.compressed)
+		if b.err != nil {
+			b.err = fmt.Errorf("не удалось распаковать ответ: %w", b.err)
+		}
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+func (b *decompressedBody) Close() error {
+	return b.compressed.Close()
+}
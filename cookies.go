@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookies - хранилище cookie клиента; сессия Bitrix влияет на пагинацию и региональные цены,
+// поэтому все запросы запуска идут в одной сессии
+var cookies *persistentJar
+
+// storedCookie - cookie в файле -cookie-file вместе с адресом, с которого она получена
+type storedCookie struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// persistentJar - cookiejar.Jar, который запоминает полученные cookie, чтобы сохранить их
+// в файл и продолжить сессию в следующем запуске. Стандартный Jar не умеет перечислять cookie
+type persistentJar struct {
+	*cookiejar.Jar
+	filename string // Пусто, если cookie не сохраняются между запусками
+
+	mu     sync.Mutex
+	stored map[string]storedCookie // По хосту, домену, пути и имени cookie
+}
+
+// newPersistentJar создает хранилище cookie и, если задан файл, загружает в него cookie
+// прошлого запуска. Отсутствие файла ошибкой не считается: это первый запуск
+func newPersistentJar(filename string) (*persistentJar, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	j := &persistentJar{Jar: jar, filename: filename, stored: make(map[string]storedCookie)}
+
+	if filename == "" {
+		return j, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []storedCookie
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	loaded := 0
+	for _, entry := range saved {
+		u, err := url.Parse(entry.URL)
+		if err != nil || entry.Cookie == nil {
+			continue
+		}
+		if !entry.Cookie.Expires.IsZero() && entry.Cookie.Expires.Before(now) {
+			continue
+		}
+		j.SetCookies(u, []*http.Cookie{entry.Cookie})
+		loaded++
+	}
+	slog.Info("Загружены cookie прошлого запуска", "file", filename, "cookies", loaded)
+
+	return j, nil
+}
+
+// SetCookies сохраняет cookie в Jar и запоминает их для записи в файл
+func (j *persistentJar) SetCookies(u *url.URL, received []*http.Cookie) {
+	j.Jar.SetCookies(u, received)
+	if j.filename == "" {
+		return
+	}
+
+	origin := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}).String()
+	now := time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, c := range received {
+		key := u.Host + "|" + c.Domain + "|" + c.Path + "|" + c.Name
+
+		// Max-Age < 0 или прошедший срок - сервер удаляет cookie
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(j.stored, key)
+			continue
+		}
+
+		// Max-Age отсчитывается от получения, поэтому в файл пишем абсолютный срок
+		saved := *c
+		if saved.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(saved.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+		saved.Raw, saved.RawExpires, saved.Unparsed = "", "", nil
+
+		j.stored[key] = storedCookie{URL: origin, Cookie: &saved}
+	}
+}
+
+// Save записывает cookie в файл -cookie-file. Сессионные cookie тоже сохраняются:
+// ради них файл и нужен. Ошибки записываются в журнал
+func (j *persistentJar) Save() {
+	if j == nil || j.filename == "" {
+		return
+	}
+
+	j.mu.Lock()
+	saved := make([]storedCookie, 0, len(j.stored))
+	for _, entry := range j.stored {
+		saved = append(saved, entry)
+	}
+	j.mu.Unlock()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err == nil {
+		err = os.WriteFile(j.filename, data, 0o600)
+	}
+	if err != nil {
+		slog.Error("Не удалось сохранить cookie", "file", j.filename, "err", err)
+		return
+	}
+	slog.Debug("Cookie сохранены", "file", j.filename, "cookies", len(saved))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Варианты -csv-quote
+const (
+	csvQuoteMinimal = "minimal" // В кавычки берутся только значения с разделителем, кавычкой или переводом строки
+	csvQuoteAll     = "all"     // В кавычки берутся все значения
+)
+
+// csvDialect - оформление CSV результатов: разделитель, кавычки и переводы строк.
+// По умолчанию - как ожидает русский Excel: ";" и CRLF
+type csvDialect struct {
+	Comma    rune
+	QuoteAll bool
+	CRLF     bool
+}
+
+// csvFormat - оформление CSV, заданное флагами -csv-delimiter, -csv-quote и -no-crlf
+var csvFormat = csvDialect{Comma: ';', CRLF: true}
+
+// newCSVDialect разбирает флаги оформления CSV. Разделитель - один символ; табуляцию можно
+// записать как tab или \t
+func newCSVDialect(delimiter, quote string, crlf bool) (csvDialect, error) {
+	switch delimiter {
+	case "tab", `\t`:
+		delimiter = "\t"
+	}
+	comma, size := utf8.DecodeRuneInString(delimiter)
+	if size == 0 || size != len(delimiter) || comma == utf8.RuneError || comma == '"' || comma == '\r' || comma == '\n' {
+		return csvDialect{}, fmt.Errorf("разделитель должен быть одним символом, кроме кавычки и перевода строки: %q", delimiter)
+	}
+
+	d := csvDialect{Comma: comma, CRLF: crlf}
+	switch quote {
+	case csvQuoteMinimal:
+	case csvQuoteAll:
+		d.QuoteAll = true
+	default:
+		return csvDialect{}, fmt.Errorf("неизвестный режим кавычек %q (допустимо: minimal, all)", quote)
+	}
+	return d, nil
+}
+
+// csvRowWriter - запись строк CSV; ему соответствует *csv.Writer
+type csvRowWriter interface {
+	Write(record []string) error
+	WriteAll(records [][]string) error
+	Flush()
+	Error() error
+}
+
+// NewWriter создает запись CSV в этом оформлении
+func (d csvDialect) NewWriter(w io.Writer) csvRowWriter {
+	if d.QuoteAll {
+		return &quotingCSVWriter{w: bufio.NewWriter(w), comma: d.Comma, crlf: d.CRLF}
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = d.Comma
+	writer.UseCRLF = d.CRLF
+	return writer
+}
+
+// quotingCSVWriter записывает CSV, беря в кавычки каждое значение. encoding/csv так не умеет,
+// а некоторые загрузчики иначе путают числа и коды с ведущими нулями
+type quotingCSVWriter struct {
+	w     *bufio.Writer
+	comma rune
+	crlf  bool
+	err   error
+}
+
+func (q *quotingCSVWriter) Write(record []string) error {
+	if q.err != nil {
+		return q.err
+	}
+	for i, field := range record {
+		if i > 0 {
+			q.w.WriteRune(q.comma)
+		}
+		q.w.WriteByte('"')
+		q.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+		q.w.WriteByte('"')
+	}
+	if q.crlf {
+		q.w.WriteString("\r\n")
+	} else {
+		q.w.WriteByte('\n')
+	}
+	// Ошибка bufio.Writer сохраняется и возвращается при следующей записи
+	_, q.err = q.w.Write(nil)
+	return q.err
+}
+
+func (q *quotingCSVWriter) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := q.Write(record); err != nil {
+			return err
+		}
+	}
+	q.Flush()
+	return q.Error()
+}
+
+func (q *quotingCSVWriter) Flush() {
+	if err := q.w.Flush(); err != nil && q.err == nil {
+		q.err = err
+	}
+}
+
+func (q *quotingCSVWriter) Error() error {
+	return q.err
+}
+
+// detectCSVDelimiter определяет разделитель по строке заголовков: из ";", ",", табуляции и "|"
+// выбирается встречающийся чаще всего. Без разделителей в строке - ";", как пишет парсер по умолчанию
+func detectCSVDelimiter(header []byte) rune {
+	header, _, _ = bytes.Cut(header, []byte("\n"))
+	comma, best := ';', 0
+	for _, candidate := range []rune{';', ',', '\t', '|'} {
+		if n := bytes.Count(header, []byte(string(candidate))); n > best {
+			comma, best = candidate, n
+		}
+	}
+	return comma
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// dedupeFields - поля, из которых можно составить ключ дедупликации. name-fuzzy - название,
+// сравниваемое по похожести (см. dedupe_fuzzy.go)
+var dedupeFields = []string{"id", "url", "sku", "name", "name-fuzzy", "brand", "category", "locale"}
+
+// Названия характеристик, из которых берутся артикул и бренд
+var (
+	skuFeatureNames   = []string{"артикул", "код товара", "sku", "article"}
+	brandFeatureNames = []string{"бренд", "производитель", "торговая марка", "марка", "brand", "manufacturer"}
+)
+
+// dedupeKey описывает, по каким полям товары считаются одинаковыми
+type dedupeKey struct {
+	fields    []string
+	threshold float64 // Порог похожести названий для name-fuzzy, задается флагом -dedupe-fuzzy-threshold
+}
+
+// dedupeBy - ключ дедупликации текущего запуска, задается флагом -dedupe-by
+var dedupeBy = dedupeKey{fields: []string{"id"}, threshold: defaultFuzzyThreshold}
+
+// parseDedupeKey разбирает выражение вида "id", "url" или "name+brand"
+func parseDedupeKey(expr string) (dedupeKey, error) {
+	var key dedupeKey
+	for _, part := range strings.Split(expr, "+") {
+		field := strings.ToLower(strings.TrimSpace(part))
+		known := false
+		for _, f := range dedupeFields {
+			if field == f {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return dedupeKey{}, fmt.Errorf("неизвестное поле %q (допустимо: %s)", part, strings.Join(dedupeFields, ", "))
+		}
+		for _, f := range key.fields {
+			if f == field || f == "name" && field == "name-fuzzy" || f == "name-fuzzy" && field == "name" {
+				return dedupeKey{}, fmt.Errorf("поле %q указано в ключе дважды", part)
+			}
+		}
+		key.fields = append(key.fields, field)
+	}
+	return key, nil
+}
+
+// Fuzzy сообщает, что названия сравниваются по похожести: одного ключа для этого мало,
+// и removeDuplicateProducts после точной дедупликации объединяет товары с похожими названиями
+func (k dedupeKey) Fuzzy() bool {
+	return slices.Contains(k.fields, "name-fuzzy")
+}
+
+// String возвращает выражение ключа в том же виде, в каком оно задается флагом
+func (k dedupeKey) String() string {
+	return strings.Join(k.fields, "+")
+}
+
+// Key вычисляет ключ дедупликации товара.
+// Если все поля ключа пустые (например, артикул неизвестен без детальной страницы),
+// используется ID товара. Пустая строка означает, что товар не удалось идентифицировать
+func (k dedupeKey) Key(product Product) string {
+	values := make([]string, len(k.fields))
+	empty := true
+	for i, field := range k.fields {
+		values[i] = normalizeDedupeValue(productField(product, field))
+		if values[i] != "" {
+			empty = false
+		}
+	}
+
+	if empty {
+		if product.ID == "" {
+			return ""
+		}
+		return "id:" + product.ID
+	}
+	return strings.Join(values, "|")
+}
+
+// productField возвращает значение поля товара по имени из dedupeFields
+func productField(product Product, field string) string {
+	switch field {
+	case "id":
+		return product.ID
+	case "url":
+		return strings.TrimSuffix(product.URL, "/")
+	case "sku":
+		if product.SKU != "" {
+			return product.SKU
+		}
+		return specValue(product, skuFeatureNames)
+	case "name":
+		return product.Name
+	case "name-fuzzy":
+		return normalizeFuzzyName(product.Name)
+	case "brand":
+		if product.Brand != "" {
+			return product.Brand
+		}
+		return specValue(product, brandFeatureNames)
+	case "category":
+		return product.Category
+	case "locale":
+		return product.Locale
+	}
+	return ""
+}
+
+// specValue возвращает характеристику товара по одному из названий: сначала из Specs,
+// затем из плоского списка Features (например, в снимке прошлых версий, где Specs еще нет)
+func specValue(product Product, names []string) string {
+	// Названия перебираются по порядку, чтобы при наличии и "Бренд", и "Производитель" выбор не зависел от порядка словаря
+	for _, name := range names {
+		for specName, value := range product.Specs {
+			if strings.ToLower(specName) == name {
+				return value
+			}
+		}
+	}
+	return featureValue(product.Features, names)
+}
+
+// featureValue ищет среди характеристик товара строку вида "Артикул: 12345"
+// (или ячейки таблицы "Артикул 12345") и возвращает ее значение
+func featureValue(features []string, names []string) string {
+	for _, feature := range features {
+		lower := strings.ToLower(strings.TrimSpace(feature))
+		for _, name := range names {
+			if !strings.HasPrefix(lower, name) {
+				continue
+			}
+			value := strings.TrimSpace(feature)[len(name):]
+			// Имя должно быть целым словом: "марка" не должна совпасть с "маркировка"
+			if value != "" && !strings.ContainsAny(value[:1], ": \t\n\r-") {
+				continue
+			}
+			return strings.TrimSpace(strings.TrimLeft(value, ": \t\n\r-"))
+		}
+	}
+	return ""
+}
+
+// normalizeDedupeValue приводит значение к виду, в котором сравниваются ключи:
+// без учета регистра и лишних пробелов
+func normalizeDedupeValue(value string) string {
+	return strings.Join(strings.Fields(strings.ToLower(value)), " ")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// defaultFuzzyThreshold - порог похожести названий по умолчанию для -dedupe-by name-fuzzy
+const defaultFuzzyThreshold = 0.85
+
+// latinLookalikes - латинские буквы, которыми на сайтах пишут кириллицу в моделях станков:
+// "16K20" с латинской K и "16К20" с кириллической - один станок
+var latinLookalikes = map[rune]rune{
+	'a': 'а', 'b': 'в', 'c': 'с', 'e': 'е', 'h': 'н', 'k': 'к', 'm': 'м',
+	'o': 'о', 'p': 'р', 't': 'т', 'x': 'х', 'y': 'у',
+}
+
+// normalizeFuzzyName приводит название к виду для нечеткого сравнения: нижний регистр, "ё" как "е",
+// знаки препинания как пробелы, латинские буквы в обозначениях моделей (словах с цифрами) - кириллицей
+func normalizeFuzzyName(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "ё", "е")
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		if strings.IndexFunc(word, unicode.IsDigit) < 0 {
+			continue
+		}
+		words[i] = strings.Map(func(r rune) rune {
+			if cyrillic, ok := latinLookalikes[r]; ok {
+				return cyrillic
+			}
+			return r
+		}, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// fuzzyName - нормализованное название с триграммами и обозначениями моделей
+type fuzzyName struct {
+	trigrams []string
+	models   []string // Слова с цифрами в порядке сортировки: "1к62", "220в"
+}
+
+func newFuzzyName(normalized string) fuzzyName {
+	var name fuzzyName
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(normalized) {
+		if strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+			name.models = append(name.models, word)
+		}
+		// Пробелы по краям дают триграммы начала и конца слова, поэтому короткие слова тоже сравниваются
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			trigram := string(runes[i : i+3])
+			if !seen[trigram] {
+				seen[trigram] = true
+				name.trigrams = append(name.trigrams, trigram)
+			}
+		}
+	}
+	slices.Sort(name.models)
+	return name
+}
+
+// collapseFuzzyDuplicates объединяет товары с похожими названиями: коэффициент Дайса по триграммам
+// не ниже порога, обозначения моделей совпадают (1К62 и 1К625 - разные станки, как бы ни были
+// похожи названия), остальные поля ключа (например, brand в name-fuzzy+brand) равны.
+// Из похожих остается первый товар. Возвращает оставшиеся товары и число объединенных
+func collapseFuzzyDuplicates(products []Product, key dedupeKey) ([]Product, int) {
+	type group struct {
+		names []fuzzyName
+		index map[string][]int // Триграмма -> оставленные товары группы с ней
+	}
+	groups := make(map[string]*group)
+
+	unique := make([]Product, 0, len(products))
+	collapsed := 0
+	for _, product := range products {
+		normalized := normalizeFuzzyName(product.Name)
+		if normalized == "" {
+			unique = append(unique, product)
+			continue
+		}
+
+		var exact []string
+		for _, field := range key.fields {
+			if field != "name-fuzzy" {
+				exact = append(exact, normalizeDedupeValue(productField(product, field)))
+			}
+		}
+		g := groups[strings.Join(exact, "|")]
+		if g == nil {
+			g = &group{index: make(map[string][]int)}
+			groups[strings.Join(exact, "|")] = g
+		}
+
+		name := newFuzzyName(normalized)
+		// Сравниваются только товары с общими триграммами; общие триграммы считаются по индексу
+		shared := make(map[int]int)
+		for _, trigram := range name.trigrams {
+			for _, i := range g.index[trigram] {
+				shared[i]++
+			}
+		}
+		duplicate := false
+		for i, common := range shared {
+			other := g.names[i]
+			dice := 2 * float64(common) / float64(len(name.trigrams)+len(other.trigrams))
+			if dice >= key.threshold && slices.Equal(name.models, other.models) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			collapsed++
+			continue
+		}
+
+		for _, trigram := range name.trigrams {
+			g.index[trigram] = append(g.index[trigram], len(g.names))
+		}
+		g.names = append(g.names, name)
+		unique = append(unique, product)
+	}
+	return unique, collapsed
+}
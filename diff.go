@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// diffFields - поля, которые сравнивает команда diff, в порядке вывода. Поля со страницы товара
+// сравниваются, только если заполнены в обоих снимках, как в productChanged: иначе снимок
+// с -skip-details или недогруженная страница дали бы ложные изменения
+var diffFields = []struct {
+	name   string
+	detail bool
+}{
+	{"name", false},
+	{"price", false},
+	{"url", false},
+	{"image", false},
+	{"category", false},
+	{"availability", true},
+	{"availability_text", true},
+	{"delivery_time", true},
+	{"sku", true},
+	{"brand", true},
+	{"manufacturer", true},
+	{"description", true},
+	{"features", true},
+	{"variants", true},
+}
+
+// fieldChange - изменение одного поля: имя как в JSON или specs.<название>
+type fieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// productDiff - изменившийся товар. Разница цены заполняется, если обе цены разобраны
+type productDiff struct {
+	ID                string        `json:"id"`
+	Name              string        `json:"name"`
+	URL               string        `json:"url"`
+	Category          string        `json:"category"`
+	OldPrice          string        `json:"old_price,omitempty"`
+	NewPrice          string        `json:"new_price,omitempty"`
+	PriceDelta        *float64      `json:"price_delta,omitempty"`
+	PriceDeltaPercent *float64      `json:"price_delta_percent,omitempty"`
+	Changes           []fieldChange `json:"changes"`
+}
+
+// catalogDiffSummary - итоги сравнения снимков
+type catalogDiffSummary struct {
+	OldProducts int `json:"old_products"`
+	NewProducts int `json:"new_products"`
+	Added       int `json:"added"`
+	Removed     int `json:"removed"`
+	Changed     int `json:"changed"`
+	Unchanged   int `json:"unchanged"`
+	PriceUp     int `json:"price_up"`
+	PriceDown   int `json:"price_down"`
+}
+
+// catalogDiff - отчет команды diff
+type catalogDiff struct {
+	Old     string             `json:"old"`
+	New     string             `json:"new"`
+	Summary catalogDiffSummary `json:"summary"`
+	Added   []Product          `json:"added"`
+	Removed []Product          `json:"removed"`
+	Changed []productDiff      `json:"changed"`
+}
+
+// runDiff сравнивает два снимка каталога и пишет отчет JSON о новых, исчезнувших и изменившихся
+// товарах, а в консоль выводит сводку
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	output := fs.String("o", "diff.json", "Файл отчета JSON; - для вывода в stdout (сводка тогда выводится в stderr)")
+	top := fs.Int("top", 20, "Сколько товаров каждого раздела показать в сводке; 0 - все")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: parserEol diff [-o отчет.json] [-top N] <старый файл> <новый файл>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("нужны два файла: старый и новый снимок каталога")
+	}
+
+	oldProducts, err := readProductsFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	newProducts, err := readProductsFile(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(1), err)
+	}
+
+	report := compareCatalogs(oldProducts, newProducts)
+	report.Old, report.New = fs.Arg(0), fs.Arg(1)
+
+	if *output == stdoutOutput {
+		useStdoutForResults()
+	}
+	if err := saveDiffReport(report, *output); err != nil {
+		return err
+	}
+	printDiffSummary(report, *top)
+	if *output != stdoutOutput {
+		fmt.Printf("\nОтчет сохранен в файл %s\n", *output)
+	}
+	return nil
+}
+
+// compareCatalogs сопоставляет товары снимков по ID (без ID - по адресу). Новые товары идут
+// в порядке нового снимка, исчезнувшие - старого, изменившиеся - по убыванию изменения цены
+func compareCatalogs(oldProducts, newProducts []Product) catalogDiff {
+	report := catalogDiff{
+		Added:   []Product{},
+		Removed: []Product{},
+		Changed: []productDiff{},
+	}
+
+	previous := make(map[string]Product, len(oldProducts))
+	for _, product := range oldProducts {
+		if key := productIdentity(product); key != "" {
+			if _, dup := previous[key]; !dup {
+				previous[key] = product
+				report.Summary.OldProducts++
+			}
+		}
+	}
+
+	current := make(map[string]bool, len(newProducts))
+	for _, product := range newProducts {
+		key := productIdentity(product)
+		if key == "" || current[key] {
+			continue
+		}
+		current[key] = true
+		report.Summary.NewProducts++
+
+		prev, ok := previous[key]
+		if !ok {
+			report.Added = append(report.Added, product)
+			continue
+		}
+		diff := diffProducts(prev, product)
+		if len(diff.Changes) == 0 {
+			report.Summary.Unchanged++
+			continue
+		}
+		if diff.PriceDelta != nil {
+			if *diff.PriceDelta > 0 {
+				report.Summary.PriceUp++
+			} else if *diff.PriceDelta < 0 {
+				report.Summary.PriceDown++
+			}
+		}
+		report.Changed = append(report.Changed, diff)
+	}
+
+	for _, product := range oldProducts {
+		key := productIdentity(product)
+		if key != "" && !current[key] {
+			report.Removed = append(report.Removed, product)
+			current[key] = true // Дубликаты старого снимка выводим один раз
+		}
+	}
+
+	// Сначала самые заметные изменения цены, затем остальные в порядке нового снимка
+	sort.SliceStable(report.Changed, func(i, j int) bool {
+		return math.Abs(priceDeltaPercent(report.Changed[i])) > math.Abs(priceDeltaPercent(report.Changed[j]))
+	})
+
+	report.Summary.Added = len(report.Added)
+	report.Summary.Removed = len(report.Removed)
+	report.Summary.Changed = len(report.Changed)
+	return report
+}
+
+// diffProducts сравнивает две версии товара по diffFields и характеристикам
+func diffProducts(prev, cur Product) productDiff {
+	diff := productDiff{ID: cur.ID, Name: cur.Name, URL: cur.URL, Category: cur.Category}
+
+	for _, field := range diffFields {
+		oldValue, newValue := productFieldValue(prev, field.name), productFieldValue(cur, field.name)
+		if oldValue == newValue || field.detail && (oldValue == "" || newValue == "") {
+			continue
+		}
+		diff.Changes = append(diff.Changes, fieldChange{Field: field.name, Old: oldValue, New: newValue})
+	}
+
+	// Флаг наличия без сведений о наличии равен false, поэтому сравнивается только при известном наличии
+	if prev.InStock != cur.InStock && prev.Availability+prev.AvailabilityText != "" && cur.Availability+cur.AvailabilityText != "" {
+		diff.Changes = append(diff.Changes, fieldChange{Field: "in_stock", Old: yesNo(prev.InStock, "нет"), New: yesNo(cur.InStock, "нет")})
+	}
+
+	// Характеристики сравниваются по названиям, если они есть в обоих снимках
+	if len(prev.Specs) > 0 && len(cur.Specs) > 0 {
+		names := make([]string, 0, len(prev.Specs)+len(cur.Specs))
+		for name := range prev.Specs {
+			names = append(names, name)
+		}
+		for name := range cur.Specs {
+			if _, ok := prev.Specs[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prev.Specs[name] != cur.Specs[name] {
+				diff.Changes = append(diff.Changes, fieldChange{Field: "specs." + name, Old: prev.Specs[name], New: cur.Specs[name]})
+			}
+		}
+	}
+
+	if prev.Price != cur.Price {
+		diff.OldPrice, diff.NewPrice = prev.Price, cur.Price
+		oldPrice, okOld := parsePrice(prev.Price)
+		newPrice, okNew := parsePrice(cur.Price)
+		if okOld && okNew {
+			delta := newPrice - oldPrice
+			diff.PriceDelta = &delta
+			if oldPrice != 0 {
+				percent := math.Round(delta/oldPrice*10000) / 100
+				diff.PriceDeltaPercent = &percent
+			}
+		}
+	}
+	return diff
+}
+
+// priceDeltaPercent возвращает изменение цены в процентах; 0, если его нет или оно не вычислено
+func priceDeltaPercent(diff productDiff) float64 {
+	if diff.PriceDeltaPercent == nil {
+		return 0
+	}
+	return *diff.PriceDeltaPercent
+}
+
+// saveDiffReport записывает отчет в файл или в stdout
+func saveDiffReport(report catalogDiff, filename string) error {
+	file, err := createResultFile(filename)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// printDiffSummary выводит сводку сравнения: итоги и первые top товаров каждого раздела
+func printDiffSummary(report catalogDiff, top int) {
+	s := report.Summary
+	fmt.Printf("Было товаров: %d, стало: %d\n", s.OldProducts, s.NewProducts)
+	fmt.Printf("Новых: %d, исчезло: %d, изменилось: %d (цена выросла у %d, снизилась у %d), без изменений: %d\n",
+		s.Added, s.Removed, s.Changed, s.PriceUp, s.PriceDown, s.Unchanged)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(report.Added) > 0 {
+		fmt.Fprintln(w, "\nНовые товары:")
+		for i, product := range report.Added {
+			if top > 0 && i == top {
+				fmt.Fprintf(w, "  ... и еще %d\n", len(report.Added)-top)
+				break
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", product.Name, product.Price, product.Category)
+		}
+	}
+	if len(report.Removed) > 0 {
+		fmt.Fprintln(w, "\nИсчезнувшие товары:")
+		for i, product := range report.Removed {
+			if top > 0 && i == top {
+				fmt.Fprintf(w, "  ... и еще %d\n", len(report.Removed)-top)
+				break
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", product.Name, product.Price, product.Category)
+		}
+	}
+	if len(report.Changed) > 0 {
+		fmt.Fprintln(w, "\nИзменившиеся товары:")
+		for i, diff := range report.Changed {
+			if top > 0 && i == top {
+				fmt.Fprintf(w, "  ... и еще %d\n", len(report.Changed)-top)
+				break
+			}
+			price := ""
+			if diff.OldPrice != "" || diff.NewPrice != "" {
+				price = diff.OldPrice + " -> " + diff.NewPrice
+				if diff.PriceDeltaPercent != nil {
+					price += fmt.Sprintf(" (%+.2f%%)", *diff.PriceDeltaPercent)
+				}
+			}
+			fields := make([]string, len(diff.Changes))
+			for j, change := range diff.Changes {
+				fields[j] = change.Field
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", diff.Name, price, strings.Join(fields, ", "))
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// workerTokenEnv - переменная окружения с общим секретом координатора и исполнителей.
+// Без него задания может получить любой, кто достучится до адреса координатора
+const workerTokenEnv = "PARSER_WORKER_TOKEN"
+
+// Виды заданий распределенного обхода
+const (
+	jobCategory = "category" // Обойти страницы категории и вернуть товары списка
+	jobDetails  = "details"  // Загрузить страницы товаров пачки и вернуть обогащенные товары
+)
+
+// jobAttempts - сколько раз задание выдается, прежде чем считаться неудавшимся
+const jobAttempts = 3
+
+// crawlJob - задание исполнителю. Параметры обхода страниц передаются в задании, чтобы
+// все исполнители обходили категории одинаково, независимо от своих флагов
+type crawlJob struct {
+	ID          int       `json:"id"`
+	Kind        string    `json:"kind"`
+	Category    *Category `json:"category,omitempty"`
+	StartPage   int       `json:"start_page,omitempty"`
+	EndPage     int       `json:"end_page,omitempty"`
+	MaxPages    int       `json:"max_pages,omitempty"`    // -max-pages-per-category координатора
+	MaxProducts int       `json:"max_products,omitempty"` // -max-products координатора
+	PriceOnly   bool      `json:"price_only,omitempty"`
+	Products    []Product `json:"products,omitempty"`
+	// Исполнитель продлевает аренду задания, пока его выполняет
+	LeaseSeconds int `json:"lease_seconds"`
+}
+
+// crawlResult - результат задания от исполнителя
+type crawlResult struct {
+	Worker   string    `json:"worker"`
+	Products []Product `json:"products"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// queuedJob - задание в очереди координатора
+type queuedJob struct {
+	job      crawlJob
+	offset   int // Для details: позиция пачки в списке товаров
+	attempts int
+	queued   bool
+	worker   string // Исполнитель, которому задание выдано
+	deadline time.Time
+}
+
+// jobOutcome - завершенное задание: результат или окончательная ошибка
+type jobOutcome struct {
+	job    *queuedJob
+	result crawlResult
+}
+
+// crawlCoordinator раздает задания исполнителям по HTTP и собирает результаты. Очередь хранится
+// в памяти координатора: задания исполнителя, который пропал, возвращаются в очередь по
+// истечении аренды, поэтому исполнители можно добавлять и останавливать во время обхода
+type crawlCoordinator struct {
+	server *http.Server
+	token  string
+	lease  time.Duration
+
+	mu       sync.Mutex
+	nextID   int
+	queue    []*queuedJob
+	active   map[int]*queuedJob
+	outcomes chan jobOutcome
+	finished bool
+}
+
+// startCrawlCoordinator начинает принимать исполнителей на addr (например, ":8700")
+func startCrawlCoordinator(addr string, lease time.Duration) (*crawlCoordinator, error) {
+	if lease < time.Minute {
+		return nil, fmt.Errorf("аренда задания должна быть не меньше 1m: %s", lease)
+	}
+	c := &crawlCoordinator{
+		token:  os.Getenv(workerTokenEnv),
+		lease:  lease,
+		active: make(map[int]*queuedJob),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs/lease", c.authorized(c.handleLease))
+	mux.HandleFunc("POST /jobs/{id}/heartbeat", c.authorized(c.handleHeartbeat))
+	mux.HandleFunc("POST /jobs/{id}/result", c.authorized(c.handleResult))
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c.server = &http.Server{Handler: mux, ReadHeaderTimeout: 30 * time.Second}
+	go c.server.Serve(ln)
+	return c, nil
+}
+
+// authorized проверяет общий секрет, если он задан
+func (c *crawlCoordinator) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.token != "" && r.Header.Get("Authorization") != "Bearer "+c.token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleLease выдает следующее задание: 200 с заданием, 204 - заданий пока нет (исполнитель
+// спрашивает позже), 410 - обход завершен и исполнитель может выйти
+func (c *crawlCoordinator) handleLease(w http.ResponseWriter, r *http.Request) {
+	worker := r.URL.Query().Get("worker")
+
+	c.mu.Lock()
+	if c.finished {
+		c.mu.Unlock()
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	var next *queuedJob
+	for len(c.queue) > 0 && next == nil {
+		next, c.queue = c.queue[0], c.queue[1:]
+		if !next.queued {
+			next = nil
+		}
+	}
+	if next == nil {
+		c.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	next.queued = false
+	next.attempts++
+	next.worker = worker
+	next.deadline = time.Now().Add(c.lease)
+	job := next.job
+	c.mu.Unlock()
+
+	slog.Debug("Задание выдано исполнителю", "job", job.ID, "kind", job.Kind, "worker", worker)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleHeartbeat продлевает аренду задания. 404 - задание уже передано другому исполнителю
+// или завершено
+func (c *crawlCoordinator) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	worker := r.URL.Query().Get("worker")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	qj := c.active[id]
+	if qj == nil || qj.queued || qj.worker != worker {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	qj.deadline = time.Now().Add(c.lease)
+	stall.MarkPage()
+}
+
+// handleResult принимает результат. Ошибку исполнителя задание получает еще раз, пока не
+// исчерпаны попытки. Результат задания, уже завершенного другим исполнителем, отбрасывается
+func (c *crawlCoordinator) handleResult(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	var result crawlResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	qj := c.active[id]
+	if qj == nil {
+		return
+	}
+	if result.Error != "" && result.Worker != qj.worker {
+		// Ошибка от исполнителя, у которого задание уже забрали
+		return
+	}
+	if result.Error != "" && qj.attempts < jobAttempts {
+		slog.Warn("Исполнитель не выполнил задание, оно будет выдано повторно",
+			"job", id, "kind", qj.job.Kind, "worker", result.Worker, "attempt", qj.attempts, "err", result.Error)
+		c.requeue(qj)
+		return
+	}
+	c.complete(qj, result)
+}
+
+// requeue возвращает задание в очередь; вызывается под c.mu
+func (c *crawlCoordinator) requeue(qj *queuedJob) {
+	qj.worker = ""
+	if !qj.queued {
+		qj.queued = true
+		c.queue = append(c.queue, qj)
+	}
+}
+
+// complete завершает задание; вызывается под c.mu. Канал результатов рассчитан на все задания
+// этапа, поэтому отправка не блокируется
+func (c *crawlCoordinator) complete(qj *queuedJob, result crawlResult) {
+	delete(c.active, qj.job.ID)
+	qj.queued = false
+	c.outcomes <- jobOutcome{job: qj, result: result}
+}
+
+// dropJobs снимает невыполненные задания с очереди и перестает ждать их результатов
+func (c *crawlCoordinator) dropJobs(jobs []*queuedJob) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, qj := range jobs {
+		// Снятое задание пропускается при выдаче, продление его аренды получает 404, результат отбрасывается
+		qj.queued = false
+		delete(c.active, qj.job.ID)
+	}
+}
+
+// expireLeases возвращает в очередь задания, аренда которых истекла: исполнитель
+// остановлен, потерял сеть или завис
+func (c *crawlCoordinator) expireLeases() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, qj := range c.active {
+		if qj.queued || qj.worker == "" || now.Before(qj.deadline) {
+			continue
+		}
+		if qj.attempts >= jobAttempts {
+			c.complete(qj, crawlResult{Worker: qj.worker, Error: "истекла аренда задания"})
+			continue
+		}
+		slog.Warn("Истекла аренда задания, оно будет выдано повторно", "job", qj.job.ID, "kind", qj.job.Kind, "worker", qj.worker)
+		c.requeue(qj)
+	}
+}
+
+// runStage ставит задания в очередь и ждет их завершения, передавая каждое в handle.
+// Прерывается отменой контекста; невыполненные задания тогда снимаются с очереди, чтобы
+// исполнители не получили их на следующем этапе, а их результаты отбрасываются
+func (c *crawlCoordinator) runStage(ctx context.Context, jobs []*queuedJob, handle func(*queuedJob, crawlResult)) {
+	c.mu.Lock()
+	c.outcomes = make(chan jobOutcome, len(jobs))
+	for _, qj := range jobs {
+		c.nextID++
+		qj.job.ID = c.nextID
+		qj.job.LeaseSeconds = int(c.lease / time.Second)
+		c.active[qj.job.ID] = qj
+		c.requeue(qj)
+	}
+	outcomes := c.outcomes
+	c.mu.Unlock()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for remaining := len(jobs); remaining > 0; {
+		select {
+		case <-ctx.Done():
+			c.dropJobs(jobs)
+			return
+		case <-ticker.C:
+			c.expireLeases()
+		case outcome := <-outcomes:
+			handle(outcome.job, outcome.result)
+			remaining--
+		}
+	}
+}
+
+// CrawlCategories раздает категории исполнителям; handle получает товары списка категории
+// или ошибку, если категорию не удалось обойти ни с одной попытки. Отмена ctx (в том числе
+// по достижении -max-products) прекращает раздачу оставшихся категорий
+func (c *crawlCoordinator) CrawlCategories(ctx context.Context, categories []Category, startPage, endPage, maxPages, maxProducts int, priceOnly bool, handle func(Category, []Product, error)) {
+	jobs := make([]*queuedJob, 0, len(categories))
+	for i := range categories {
+		jobs = append(jobs, &queuedJob{job: crawlJob{
+			Kind:        jobCategory,
+			Category:    &categories[i],
+			StartPage:   startPage,
+			EndPage:     endPage,
+			MaxPages:    maxPages,
+			MaxProducts: maxProducts,
+			PriceOnly:   priceOnly,
+		}})
+	}
+	c.runStage(ctx, jobs, func(qj *queuedJob, result crawlResult) {
+		stall.MarkPage()
+		var err error
+		if result.Error != "" {
+			err = errors.New(result.Error)
+		}
+		handle(*qj.job.Category, result.Products, err)
+	})
+}
+
+// EnrichProducts раздает товары пачками по batch на загрузку страниц товаров и записывает
+// обогащенные товары на место исходных. Товары пачки, которую не удалось обработать,
+// остаются с данными списка, как при ошибке обогащения одного товара
+func (c *crawlCoordinator) EnrichProducts(ctx context.Context, products []Product, batch int, onDone func(Product)) {
+	var jobs []*queuedJob
+	for offset := 0; offset < len(products); offset += batch {
+		end := min(offset+batch, len(products))
+		jobs = append(jobs, &queuedJob{offset: offset, job: crawlJob{Kind: jobDetails, Products: products[offset:end]}})
+	}
+
+	done, failed := 0, 0
+	bars.Enrich(0, len(products), 0)
+	status.Enrich(0, len(products))
+	c.runStage(ctx, jobs, func(qj *queuedJob, result crawlResult) {
+		batchProducts := qj.job.Products
+		if result.Error != "" || len(result.Products) != len(batchProducts) {
+			slog.Error("Пачка товаров не обогащена", "job", qj.job.ID, "products", len(batchProducts), "worker", result.Worker, "err", result.Error)
+			failed += len(batchProducts)
+			for range batchProducts {
+				status.CountError("товары")
+			}
+		} else {
+			batchProducts = result.Products
+		}
+
+		for i, product := range batchProducts {
+			product = brands.Apply(product)
+			products[qj.offset+i] = product
+			stall.MarkProduct()
+			if onDone != nil {
+				onDone(product)
+			}
+		}
+		done += len(batchProducts)
+		bars.Enrich(done, len(products), failed)
+		status.Enrich(done, len(products))
+		if !bars.ReplacesLogs() {
+			slog.Info("Прогресс обогащения", "processed", done, "total", len(products), "errors", failed)
+		}
+	})
+}
+
+// Finish сообщает исполнителям, что обход завершен. Сервер продолжает отвечать до выхода
+// координатора, чтобы исполнители получили ответ и завершились сами
+func (c *crawlCoordinator) Finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finished = true
+}
+
+// crawlWorker выполняет задания координатора
+type crawlWorker struct {
+	client         *http.Client
+	baseURL        string
+	token          string
+	name           string
+	semaphore      chan struct{}
+	enrichSem      chan struct{}
+	delayMs        int
+	productTimeout time.Duration
+}
+
+// runCrawlWorker берет задания у координатора, пока он не сообщит о завершении обхода.
+// Запросы к сайту исполнитель выполняет со своими настройками: прокси, задержкой, потоками
+func runCrawlWorker(ctx context.Context, coordinatorURL string, threads, enrichThreads, delayMs int, productTimeout time.Duration) error {
+	hostname, _ := os.Hostname()
+	w := &crawlWorker{
+		client:         &http.Client{Timeout: 5 * time.Minute},
+		baseURL:        strings.TrimSuffix(coordinatorURL, "/"),
+		token:          os.Getenv(workerTokenEnv),
+		name:           fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		semaphore:      make(chan struct{}, threads),
+		enrichSem:      make(chan struct{}, enrichThreads),
+		delayMs:        delayMs,
+		productTimeout: productTimeout,
+	}
+	slog.Info("Исполнитель распределенного обхода запущен", "coordinator", w.baseURL, "worker", w.name)
+
+	jobs, unavailable := 0, 0
+	for ctx.Err() == nil {
+		job, status, err := w.lease(ctx)
+		if err != nil {
+			// Координатор мог еще не запуститься или перезапускается; минуту ждем
+			unavailable++
+			if unavailable >= 12 {
+				return fmt.Errorf("координатор недоступен: %v", err)
+			}
+			slog.Warn("Координатор недоступен, повтор", "err", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		unavailable = 0
+
+		switch status {
+		case http.StatusGone:
+			slog.Info("Координатор завершил обход", "jobs", jobs)
+			return nil
+		case http.StatusNoContent:
+			select {
+			case <-ctx.Done():
+			case <-time.After(2 * time.Second):
+			}
+			continue
+		}
+
+		result := w.run(ctx, job)
+		if ctx.Err() != nil {
+			result = crawlResult{Error: "исполнитель остановлен"}
+		}
+		result.Worker = w.name
+		if err := w.report(ctx, job.ID, result); err != nil {
+			slog.Error("Не удалось отправить результат координатору", "job", job.ID, "err", err)
+		}
+		jobs++
+	}
+	return nil
+}
+
+// run выполняет задание, продлевая его аренду
+func (w *crawlWorker) run(ctx context.Context, job crawlJob) crawlResult {
+	heartbeatCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go func() {
+		ticker := time.NewTicker(time.Duration(max(job.LeaseSeconds/3, 10)) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatCtx.Done():
+				return
+			case <-ticker.C:
+				if status, _, err := w.post(heartbeatCtx, fmt.Sprintf("/jobs/%d/heartbeat", job.ID), nil); err == nil && status == http.StatusNotFound {
+					slog.Warn("Задание передано другому исполнителю", "job", job.ID)
+				}
+			}
+		}
+	}()
+
+	switch job.Kind {
+	case jobCategory:
+		if job.Category == nil {
+			return crawlResult{Error: "в задании нет категории"}
+		}
+		slog.Info("Обход категории", "job", job.ID, "category", job.Category.Name)
+		products, err := getProductsFromCategory(ctx, *job.Category, w.semaphore, job.StartPage, job.EndPage, job.MaxPages, w.delayMs, job.PriceOnly, job.MaxProducts)
+		if err != nil {
+			return crawlResult{Error: err.Error()}
+		}
+		return crawlResult{Products: products}
+	case jobDetails:
+		slog.Info("Обогащение пачки товаров", "job", job.ID, "products", len(job.Products))
+		enrichProductsWithDetails(ctx, job.Products, w.enrichSem, w.delayMs, w.productTimeout, nil)
+		return crawlResult{Products: job.Products}
+	default:
+		return crawlResult{Error: fmt.Sprintf("неизвестный вид задания %q", job.Kind)}
+	}
+}
+
+// lease запрашивает задание; тело ответа есть только при коде 200
+func (w *crawlWorker) lease(ctx context.Context) (crawlJob, int, error) {
+	var job crawlJob
+	status, body, err := w.post(ctx, "/jobs/lease", nil)
+	if err != nil {
+		return job, 0, err
+	}
+	switch status {
+	case http.StatusOK:
+		return job, status, json.Unmarshal(body, &job)
+	case http.StatusNoContent, http.StatusGone:
+		return job, status, nil
+	default:
+		return job, status, fmt.Errorf("код ответа %d: %s", status, strings.TrimSpace(string(body)))
+	}
+}
+
+// report отправляет результат; при ошибках сети повторяет до трех раз, чтобы не потерять
+// выполненную работу
+func (w *crawlWorker) report(ctx context.Context, id int, result crawlResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryBackoff(attempt, 2000, 0))
+		}
+		// Результат отправляется и после остановки исполнителя, чтобы задание сразу вернулось в очередь
+		status, data, err := w.post(context.WithoutCancel(ctx), fmt.Sprintf("/jobs/%d/result", id), body)
+		switch {
+		case err != nil:
+			lastErr = err
+		case status == http.StatusOK:
+			return nil
+		default:
+			lastErr = fmt.Errorf("код ответа %d: %s", status, strings.TrimSpace(string(data)))
+		}
+	}
+	return lastErr
+}
+
+// post выполняет запрос к координатору с именем исполнителя и общим секретом
+func (w *crawlWorker) post(ctx context.Context, path string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.baseURL+path+"?worker="+url.QueryEscape(w.name), bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
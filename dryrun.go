@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxCategoryPages - больше страниц одной категории, начиная с -start-page, парсер не обходит
+// (флаг -max-pages-per-category, 0 - без ограничения)
+var maxCategoryPages = 100
+
+// categoryPlan - оценка объема работы по категории
+type categoryPlan struct {
+	Category Category
+	Pages    int  // Страниц списка, которые будут загружены
+	Products int  // Товаров, которые будут найдены
+	Exact    bool // Количество товаров взято со страницы, а не оценено
+	Error    string
+}
+
+// crawlPlanSettings - параметры запуска, от которых зависит объем работы и скорость
+type crawlPlanSettings struct {
+	StartPage, EndPage int
+	SampleSize         int
+	MaxProducts        int // -max-products, 0 - без ограничения
+	SkipDetails        bool
+	Threads            int
+	EnrichThreads      int
+	DelayMs            int
+	DelayJitterMs      int
+	RPS                float64
+}
+
+// runDryRun загружает первую страницу каждой категории, оценивает число страниц и товаров
+// и выводит план обхода с оценкой времени. Страницы товаров не загружаются, файлы не пишутся
+func runDryRun(ctx context.Context, categories []Category, groups []sitemapGroup, settings crawlPlanSettings) {
+	var plans []categoryPlan
+	var latency time.Duration
+
+	if groups != nil {
+		// Товары карты сайта уже известны, страницы списков не загружаются
+		for _, group := range groups {
+			plans = append(plans, categoryPlan{Category: group.Category, Products: len(group.Products), Exact: true})
+		}
+	} else {
+		plans, latency = planCategories(ctx, categories, settings)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Категория\tСтраниц\tТоваров\t")
+	var pages, products, failed, maxPages int
+	for _, plan := range plans {
+		if plan.Error != "" {
+			failed++
+			fmt.Fprintf(w, "%s\t-\t-\tошибка: %s\n", plan.Category.Name, plan.Error)
+			continue
+		}
+		count := fmt.Sprintf("%d", plan.Products)
+		if !plan.Exact {
+			count = "~" + count
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t\n", plan.Category.Name, plan.Pages, count)
+		pages += plan.Pages
+		products += plan.Products
+		maxPages = max(maxPages, plan.Pages)
+	}
+	w.Flush()
+
+	// Обход списков останавливается, когда найдено -max-products товаров
+	if settings.MaxProducts > 0 {
+		products = min(products, settings.MaxProducts)
+	}
+	details := products
+	if settings.SkipDetails {
+		details = 0
+	}
+	fmt.Printf("\nКатегорий: %d (с ошибками %d), страниц списков: %d, товаров: ~%d, страниц товаров: ~%d\n",
+		len(plans)-failed, failed, pages, products, details)
+
+	// Без измерений (режим sitemap) считаем, что сервер отвечает за полсекунды
+	if latency == 0 {
+		latency = 500 * time.Millisecond
+	}
+	listing := phaseDuration(pages, settings.Threads, latency, settings)
+	// Страницы одной категории загружаются по очереди, поэтому самая длинная категория - нижняя граница
+	listing = max(listing, phaseDuration(maxPages, 1, latency, settings))
+	enrich := phaseDuration(details, settings.EnrichThreads, latency, settings)
+	fmt.Printf("Средний ответ сервера: %s. Оценка времени: списки %s, страницы товаров %s, всего %s\n",
+		latency.Round(time.Millisecond), listing.Round(time.Second), enrich.Round(time.Second), (listing + enrich).Round(time.Second))
+}
+
+// planCategories загружает первые страницы категорий в -threads потоков и возвращает планы
+// и среднее время ответа сервера
+func planCategories(ctx context.Context, categories []Category, settings crawlPlanSettings) ([]categoryPlan, time.Duration) {
+	plans := make([]categoryPlan, len(categories))
+	semaphore := make(chan struct{}, settings.Threads)
+
+	var mu sync.Mutex
+	var total time.Duration
+	var measured int
+
+	var wg sync.WaitGroup
+	for i, category := range categories {
+		wg.Add(1)
+		go func(i int, category Category) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			plans[i].Category = category
+			started := time.Now()
+			doc, _, err := fetchCategoryDocument(ctx, category.URL, settings.DelayMs)
+			if err != nil {
+				plans[i].Error = err.Error()
+				slog.Error("Ошибка при загрузке категории", "category", category.Name, "url", category.URL, "err", err)
+				return
+			}
+			// Время ожидания очереди и задержки в ответ сервера не входит
+			elapsed := time.Since(started) - time.Duration(settings.DelayMs)*time.Millisecond
+			mu.Lock()
+			total += max(elapsed, 0)
+			measured++
+			mu.Unlock()
+
+			plans[i] = planCategory(doc, category, settings)
+			slog.Info("Категория", "category", category.Name, "pages", plans[i].Pages, "products", plans[i].Products, "exact", plans[i].Exact)
+		}(i, category)
+	}
+	wg.Wait()
+
+	if measured == 0 {
+		return plans, 0
+	}
+	return plans, total / time.Duration(measured)
+}
+
+// planCategory оценивает категорию по первой странице: число страниц - по ссылкам
+// пагинации и NavPageCount Bitrix или по счетчику товаров, с учетом -start-page, -end-page,
+// -max-pages-per-category и -sample
+func planCategory(doc *goquery.Document, category Category, settings crawlPlanSettings) categoryPlan {
+	plan := categoryPlan{Category: category}
+	page := parseListPage(doc, nil, category, true)
+	perPage := len(page.Products)
+
+	lastPage := 1
+	if page.HasNextPage {
+		lastPage = max(page.LastPage, 2)
+	}
+	plan.Products, plan.Exact = countCategoryProducts(doc, category)
+	if plan.Exact && perPage > 0 {
+		lastPage = max(lastPage, (plan.Products+perPage-1)/perPage)
+	}
+
+	first := max(settings.StartPage, 1)
+	last := lastPage
+	if maxCategoryPages > 0 {
+		last = min(last, first+maxCategoryPages-1)
+	}
+	if settings.EndPage > 0 {
+		last = min(last, settings.EndPage)
+	}
+	plan.Pages = max(last-first+1, 0)
+
+	// Часть страниц не обходится: товаров меньше, и точным их число уже не считается
+	if plan.Pages < lastPage && perPage > 0 {
+		plan.Products = min(plan.Products, plan.Pages*perPage)
+		plan.Exact = false
+	}
+	if settings.SampleSize > 0 {
+		plan.Products = min(plan.Products, settings.SampleSize)
+	}
+	return plan
+}
+
+// phaseDuration оценивает время загрузки requests страниц в threads потоков: каждый поток
+// выдерживает -delay со средней добавкой -delay-jitter и ждет ответа, а -rps ограничивает частоту запросов всех потоков
+func phaseDuration(requests, threads int, latency time.Duration, settings crawlPlanSettings) time.Duration {
+	if requests == 0 {
+		return 0
+	}
+	threads = max(min(threads, requests), 1)
+	perRequest := time.Duration(settings.DelayMs+settings.DelayJitterMs/2)*time.Millisecond + latency
+	estimate := perRequest * time.Duration(requests) / time.Duration(threads)
+	if settings.RPS > 0 {
+		estimate = max(estimate, time.Duration(float64(requests)/settings.RPS*float64(time.Second)))
+	}
+	return estimate
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// esIndexRe - допустимое имя индекса: строчные буквы, цифры и "-", "_", "."
+var esIndexRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// esDefaultMapping - схема индекса товаров: название, описание и характеристики разбираются
+// русским анализатором (морфология: "станок" находит "станки"), у названия есть точное значение
+// для сортировки и агрегаций, идентификаторы и справочные поля - keyword. Характеристики хранятся
+// в документе, но не индексируются по отдельности: названий тысячи, а полей в индексе не больше 1000
+const esDefaultMapping = `{
+  "mappings": {
+    "properties": {
+      "id":                {"type": "keyword"},
+      "name":              {"type": "text", "analyzer": "russian", "fields": {"keyword": {"type": "keyword", "ignore_above": 512}}},
+      "description":       {"type": "text", "analyzer": "russian"},
+      "url":               {"type": "keyword"},
+      "price":             {"type": "keyword"},
+      "price_value":       {"type": "double"},
+      "image_url":         {"type": "keyword", "index": false},
+      "category":          {"type": "keyword"},
+      "category_path":     {"type": "keyword"},
+      "features":          {"type": "text", "analyzer": "russian"},
+      "specs":             {"type": "object", "enabled": false},
+      "specs_text":        {"type": "text", "analyzer": "russian"},
+      "sku":               {"type": "keyword"},
+      "brand":             {"type": "keyword"},
+      "manufacturer":      {"type": "keyword"},
+      "availability":      {"type": "keyword"},
+      "availability_text": {"type": "text", "analyzer": "russian"},
+      "in_stock":          {"type": "boolean"},
+      "images":            {"type": "keyword", "index": false},
+      "gallery":           {"type": "object", "enabled": false},
+      "variants":          {"type": "object", "enabled": false},
+      "locale":            {"type": "keyword"},
+      "run_id":            {"type": "keyword"},
+      "indexed_at":        {"type": "date"}
+    }
+  }
+}`
+
+// esDocument - документ индекса: товар и поля для поиска и фильтров в Kibana
+type esDocument struct {
+	Product
+	PriceValue *float64  `json:"price_value,omitempty"` // Цена числом для диапазонов и сортировки
+	SpecsText  string    `json:"specs_text,omitempty"`  // Характеристики одной строкой для полнотекстового поиска
+	RunID      string    `json:"run_id,omitempty"`
+	IndexedAt  time.Time `json:"indexed_at"`
+}
+
+// esIndexer записывает товары в индекс Elasticsearch или OpenSearch через Bulk API
+type esIndexer struct {
+	client  *http.Client
+	baseURL string
+	index   string
+	user    *url.Userinfo
+	apiKey  string
+}
+
+// openElasticsearch проверяет подключение и создает индекс со схемой, если его еще нет.
+// Вызывается до начала парсинга, как и подключение к PostgreSQL. Логин и пароль берутся
+// из адреса, ключ API - из ES_API_KEY
+func openElasticsearch(ctx context.Context, rawURL, index, mappingFile string) (*esIndexer, error) {
+	if !esIndexRe.MatchString(index) {
+		return nil, fmt.Errorf("недопустимое имя индекса %q", index)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("некорректный адрес %q", rawURL)
+	}
+
+	e := &esIndexer{
+		client: &http.Client{Timeout: 2 * time.Minute},
+		index:  index,
+		user:   u.User,
+		apiKey: os.Getenv("ES_API_KEY"),
+	}
+	u.User = nil
+	e.baseURL = strings.TrimSuffix(u.String(), "/")
+
+	mapping := []byte(esDefaultMapping)
+	if mappingFile != "" {
+		if mapping, err = os.ReadFile(mappingFile); err != nil {
+			return nil, err
+		}
+		if !json.Valid(mapping) {
+			return nil, fmt.Errorf("файл схемы %s не является JSON", mappingFile)
+		}
+	}
+
+	status, _, err := e.do(ctx, http.MethodHead, "/"+index, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось подключиться к Elasticsearch: %v", err)
+	}
+	switch status {
+	case http.StatusOK:
+		return e, nil
+	case http.StatusNotFound:
+	default:
+		return nil, fmt.Errorf("проверка индекса %s: код ответа %d", index, status)
+	}
+
+	status, body, err := e.do(ctx, http.MethodPut, "/"+index, "application/json", mapping)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("ошибка при создании индекса %s: код ответа %d: %s", index, status, esErrorReason(body))
+	}
+	return e, nil
+}
+
+// do выполняет запрос к кластеру и возвращает код и тело ответа
+func (e *esIndexer) do(ctx context.Context, method, path, contentType string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, e.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	} else if e.user != nil {
+		password, _ := e.user.Password()
+		req.SetBasicAuth(e.user.Username(), password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// esErrorReason извлекает причину ошибки из ответа кластера
+func esErrorReason(body []byte) string {
+	var resp struct {
+		Error struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Error.Reason != "" {
+		return resp.Error.Type + ": " + resp.Error.Reason
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// Index записывает товары пачками через _bulk; документ с тем же ID заменяется, поэтому
+// повторные запуски обновляют индекс без дубликатов. Возвращает число записанных документов.
+// Отклоненные документы (например, из-за несовпадения со схемой) не прерывают запись остальных
+func (e *esIndexer) Index(ctx context.Context, products []Product) (int, error) {
+	now := time.Now()
+	runID := ""
+	if runMeta != nil {
+		runID = runMeta.RunID
+	}
+
+	indexed, failed := 0, 0
+	var firstFailure string
+	var batch bytes.Buffer
+	count := 0
+
+	flush := func() error {
+		if count == 0 {
+			return nil
+		}
+		ok, rejected, reason, err := e.bulk(ctx, batch.Bytes())
+		if err != nil {
+			return err
+		}
+		indexed += ok
+		failed += rejected
+		if firstFailure == "" {
+			firstFailure = reason
+		}
+		batch.Reset()
+		count = 0
+		return nil
+	}
+
+	for _, product := range products {
+		doc := esDocument{Product: product, SpecsText: specsText(product.Specs), RunID: runID, IndexedAt: now}
+		if price, ok := parsePrice(product.Price); ok {
+			doc.PriceValue = &price
+		}
+
+		action, _ := json.Marshal(map[string]map[string]string{"index": {"_index": e.index, "_id": product.ID}})
+		source, err := json.Marshal(doc)
+		if err != nil {
+			return indexed, err
+		}
+		batch.Write(action)
+		batch.WriteByte('\n')
+		batch.Write(source)
+		batch.WriteByte('\n')
+		count++
+
+		// Пачки ограничены и числом документов, и размером: описания бывают длинными
+		if count >= 1000 || batch.Len() >= 5<<20 {
+			if err := flush(); err != nil {
+				return indexed, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return indexed, err
+	}
+
+	if failed > 0 {
+		return indexed, fmt.Errorf("не записано документов: %d, например: %s", failed, firstFailure)
+	}
+	return indexed, nil
+}
+
+// bulk отправляет пачку и разбирает результат по документам. При 429 (очередь записи кластера
+// заполнена) и 5xx пачка повторяется с паузой
+func (e *esIndexer) bulk(ctx context.Context, body []byte) (indexed, failed int, reason string, err error) {
+	var status int
+	var data []byte
+	for attempt := 0; attempt < 5; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return 0, 0, "", ctx.Err()
+			case <-time.After(retryBackoff(attempt, 2000, 0)):
+			}
+		}
+		status, data, err = e.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body)
+		if err == nil && !retryableStatus(status) {
+			break
+		}
+	}
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if status != http.StatusOK {
+		return 0, 0, "", fmt.Errorf("код ответа %d: %s", status, esErrorReason(data))
+	}
+
+	var resp struct {
+		Items []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return 0, 0, "", err
+	}
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Status >= 300 {
+				failed++
+				if reason == "" {
+					reason = result.Error.Type + ": " + result.Error.Reason
+				}
+				continue
+			}
+			indexed++
+		}
+	}
+	return indexed, failed, reason, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// embeddedObjectRe находит объекты без вложенных объектов - так выглядят товары
+	// в dataLayer.push({ecommerce: {impressions: [{...}, {...}]}}) и аналогичных данных аналитики
+	embeddedObjectRe = regexp.MustCompile(`\{[^{}]*\}`)
+
+	// embeddedIDRe и embeddedPriceRe находят поля товара как в JSON, так и в литерале объекта JS
+	// (ключи без кавычек или в одинарных кавычках, значения-числа или строки)
+	embeddedIDRe    = regexp.MustCompile(`["']?\b(?:id|item_id|productId|product_id)["']?\s*:\s*["']?([\w-]+)`)
+	embeddedPriceRe = regexp.MustCompile(`["']?\bprice["']?\s*:\s*["']?(\d[\d\s.,]*)`)
+)
+
+// embeddedPrices извлекает цены товаров из данных аналитики в скриптах страницы
+// (dataLayer, ecommerce impressions/detail, GA4 items). Возвращает цены по ID товара;
+// цена без ID попадает под ключ "", если на странице она единственная
+func embeddedPrices(doc *goquery.Document) map[string]string {
+	prices := make(map[string]string)
+	var anonymous []string
+
+	doc.Find("script").Each(func(_ int, s *goquery.Selection) {
+		script := s.Text()
+		if !strings.Contains(script, "dataLayer") && !strings.Contains(script, "ecommerce") {
+			return
+		}
+
+		for _, object := range embeddedObjectRe.FindAllString(script, -1) {
+			priceMatch := embeddedPriceRe.FindStringSubmatch(object)
+			if priceMatch == nil {
+				continue
+			}
+			price, ok := normalizeEmbeddedPrice(priceMatch[1])
+			if !ok {
+				continue
+			}
+
+			if idMatch := embeddedIDRe.FindStringSubmatch(object); idMatch != nil {
+				if _, exists := prices[idMatch[1]]; !exists {
+					prices[idMatch[1]] = price
+				}
+				continue
+			}
+			anonymous = append(anonymous, price)
+		}
+	})
+
+	if len(anonymous) == 1 {
+		prices[""] = anonymous[0]
+	}
+
+	return prices
+}
+
+// embeddedPriceFor возвращает цену товара из данных аналитики: по ID, а если товар на странице
+// единственный (детальная страница) - единственную найденную цену
+func embeddedPriceFor(prices map[string]string, productID string) (string, bool) {
+	if price, ok := prices[productID]; ok {
+		return price, true
+	}
+	if len(prices) == 1 {
+		for _, price := range prices {
+			return price, true
+		}
+	}
+	return "", false
+}
+
+// normalizeEmbeddedPrice приводит цену из данных аналитики ("2787028.00", "2 787 028,5") к виду
+// "2787028" или "2787028.5". Нулевая цена означает, что цены на сайте нет, и не используется
+func normalizeEmbeddedPrice(raw string) (string, bool) {
+	value, ok := parsePrice(strings.TrimRight(raw, " .,"))
+	if !ok || value <= 0 {
+		return "", false
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64), true
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// sniffSize - сколько байт от начала страницы просматривается для определения кодировки.
+// Остальное перекодируется потоком, без чтения страницы в память целиком
+const sniffSize = 64 << 10
+
+// getUTF8Reader создает Reader с преобразованием в UTF-8 для страницы без заголовков ответа
+// (сохраненный файл, образец)
+func getUTF8Reader(r io.Reader) (io.Reader, error) {
+	return newUTF8Reader(r, "")
+}
+
+// responseUTF8Reader создает Reader с преобразованием тела ответа в UTF-8 с учетом charset
+// из заголовка Content-Type
+func responseUTF8Reader(resp *http.Response) (io.Reader, error) {
+	return newUTF8Reader(resp.Body, resp.Header.Get("Content-Type"))
+}
+
+// newUTF8Reader определяет кодировку по началу страницы (sniffSize байт) и перекодирует поток
+// в UTF-8. Если страница определена как UTF-8, байты, не образующие символов UTF-8, дальше по
+// странице декодируются однобайтовой кодировкой: вставка в windows-1251 после первых 64 КБ
+// не превращается в символы замены. BOM UTF-8 удаляется
+func newUTF8Reader(r io.Reader, contentType string) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	complete := err == io.EOF
+
+	if bytes.HasPrefix(head, utf8BOM) {
+		br.Discard(len(utf8BOM))
+		head = head[len(utf8BOM):]
+	}
+	// Символ, разорванный границей просмотра, не должен считаться однобайтовой кодировкой
+	if !complete {
+		head = trimPartialRune(head)
+	}
+
+	e, _ := sniffEncoding(head, contentType)
+	if e == unicode.UTF8BOM {
+		_, declared, _ := charset.DetermineEncoding(head, contentType)
+		fallback, fallbackName := guessCyrillicCharmap(nil, declared)
+		// Начало страницы без единой буквы, кроме латиницы, о кодировке ничего не говорит:
+		// доверяем объявленной однобайтовой кодировке
+		if !complete && isASCII(head) && declared == fallbackName {
+			return transform.NewReader(br, fallback.NewDecoder()), nil
+		}
+		e = mixedUTF8{fallback: fallback}
+	}
+	return transform.NewReader(br, e.NewDecoder()), nil
+}
+
+// utf8BOM - метка порядка байтов UTF-8
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// trimPartialRune отрезает незавершенный символ UTF-8 в конце
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if c := b[len(b)-i]; utf8.RuneStart(c) {
+			if c >= utf8.RuneSelf && !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// isASCII сообщает, что в b только символы ASCII
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// detectEncoding определяет кодировку страницы без заголовков ответа
+func detectEncoding(b []byte) (encoding.Encoding, string) {
+	return sniffEncoding(b, "")
+}
+
+// sniffEncoding определяет кодировку страницы и возвращает ее вместе с названием.
+// Объявленной кодировке (BOM, charset в Content-Type, meta) доверяем не слепо: сайты на Bitrix
+// нередко объявляют windows-1251, а отдают UTF-8, и наоборот. Поэтому корректный UTF-8
+// всегда читается как UTF-8, страница в однобайтовой кодировке - как windows-1251 или KOI8-R
+// по частоте строчных букв, а UTF-8 со вставками в однобайтовой кодировке - посимвольно.
+// Объявление решает, когда в тексте нет других букв, кроме латиницы, и различает KOI8-R
+// и windows-1251 на коротких текстах; без объявления используется windows-1251
+func sniffEncoding(b []byte, contentType string) (encoding.Encoding, string) {
+	declared, name, _ := charset.DetermineEncoding(b, contentType)
+
+	// UTF-16 распознается только по BOM, эвристики для него не нужны
+	if bytes.HasPrefix(b, []byte{0xFF, 0xFE}) || bytes.HasPrefix(b, []byte{0xFE, 0xFF}) {
+		return declared, name
+	}
+
+	if utf8.Valid(b) {
+		return unicode.UTF8BOM, "utf-8"
+	}
+
+	// Однобайтовые кириллические кодировки, которые эвристика не различает, оставляем как объявлены
+	switch name {
+	case "iso-8859-5", "ibm866", "x-mac-cyrillic":
+		return declared, name
+	}
+
+	// Байты, не образующие символов UTF-8, - текст в однобайтовой кодировке
+	var multibyte, invalid int
+	var single []byte
+	for rest := b; len(rest) > 0; {
+		r, size := utf8.DecodeRune(rest)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid++
+			single = append(single, rest[0])
+		case size > 1:
+			multibyte++
+		}
+		rest = rest[size:]
+	}
+
+	fallback, fallbackName := guessCyrillicCharmap(single, name)
+
+	// Страница в основном в UTF-8 со вставками в однобайтовой кодировке (шаблон сайта
+	// в одной кодировке, подключаемая область в другой): целиком ее не перекодируем
+	if multibyte > invalid {
+		return mixedUTF8{fallback: fallback}, "utf-8+" + fallbackName
+	}
+
+	return fallback, fallbackName
+}
+
+// guessCyrillicCharmap выбирает между windows-1251 и KOI8-R. В русском тексте строчных букв
+// намного больше, чем прописных, а строчные буквы windows-1251 (0xE0-0xFF) в KOI8-R прописные
+// и наоборот. Если перевеса нет (мало текста, только прописные), используется объявленная
+// кодировка, а без нее - windows-1251 как самая распространенная для русских сайтов
+func guessCyrillicCharmap(single []byte, declaredName string) (*charmap.Charmap, string) {
+	var upperHalf, lowerHalf int
+	for _, c := range single {
+		switch {
+		case c >= 0xE0:
+			upperHalf++
+		case c >= 0xC0:
+			lowerHalf++
+		}
+	}
+
+	switch {
+	case upperHalf > 2*lowerHalf:
+		return charmap.Windows1251, "windows-1251"
+	case lowerHalf > 2*upperHalf:
+		return charmap.KOI8R, "koi8-r"
+	case declaredName == "koi8-r" || declaredName == "koi8-u":
+		return charmap.KOI8R, "koi8-r"
+	default:
+		return charmap.Windows1251, "windows-1251"
+	}
+}
+
+// mixedUTF8 - UTF-8, в котором байты, не образующие символов UTF-8, декодируются
+// однобайтовой кодировкой fallback
+type mixedUTF8 struct {
+	fallback *charmap.Charmap
+}
+
+func (m mixedUTF8) NewDecoder() *encoding.Decoder {
+	return &encoding.Decoder{Transformer: &mixedUTF8Decoder{fallback: m.fallback}}
+}
+
+func (m mixedUTF8) NewEncoder() *encoding.Encoder {
+	return unicode.UTF8.NewEncoder()
+}
+
+// mixedUTF8Decoder копирует корректные символы UTF-8 и перекодирует остальные байты по одному
+type mixedUTF8Decoder struct {
+	transform.NopResetter
+	fallback *charmap.Charmap
+}
+
+func (d *mixedUTF8Decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if r == utf8.RuneError && size == 1 {
+			// Начало символа, продолжение которого еще не прочитано
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			r = d.fallback.DecodeByte(src[nSrc])
+		}
+
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+// Тексты, которые есть на каждой странице корпуса testdata/encoding
+var encodingCorpusTexts = []string{
+	"Станки - каталог",
+	"Токарно-винторезный станок ТВ-16",
+	"Цена: 125 000 руб.",
+	"ёмкость бака СОЖ 12 л",
+}
+
+// Текст вставки в другой кодировке на страницах mixed_*
+const encodingCorpusInsert = "Фрезерный станок в наличии на складе в Москве"
+
+// TestGetUTF8ReaderCorpus проверяет перекодирование страниц в windows-1251, UTF-8 и KOI8-R,
+// в том числе с неверно объявленной кодировкой и вставками в другой кодировке.
+// Имя файла: <фактическая кодировка>[_declared_<объявленная>|_no_charset].html
+func TestGetUTF8ReaderCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "encoding", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("корпус testdata/encoding пуст")
+	}
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			text := decodeForTest(t, data)
+			_, encodingName := detectEncoding(data)
+
+			if !utf8.ValidString(text) {
+				t.Fatalf("результат (%s) не является корректным UTF-8", encodingName)
+			}
+			if strings.ContainsRune(text, utf8.RuneError) {
+				t.Errorf("в результате (%s) есть символы замены U+FFFD", encodingName)
+			}
+			if strings.HasPrefix(text, "\ufeff") {
+				t.Errorf("BOM не удален")
+			}
+
+			want := encodingCorpusTexts
+			if strings.HasPrefix(name, "mixed_") {
+				want = append(want[:len(want):len(want)], encodingCorpusInsert)
+			}
+			for _, s := range want {
+				if !strings.Contains(text, s) {
+					t.Errorf("кодировка определена как %s, текст %q не найден", encodingName, s)
+				}
+			}
+		})
+	}
+}
+
+// FuzzGetUTF8Reader проверяет, что на любых данных результат - корректный UTF-8,
+// корректный UTF-8 не изменяется (кроме удаления BOM), а результат не зависит
+// от того, какими порциями читаются данные
+func FuzzGetUTF8Reader(f *testing.F) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "encoding", "*.html"))
+	for _, file := range files {
+		if data, err := os.ReadFile(file); err == nil {
+			f.Add(data)
+		}
+	}
+	f.Add([]byte(""))
+	f.Add([]byte("plain ascii"))
+	f.Add([]byte("\xef\xbb\xbf"))
+	f.Add([]byte("Станок \xd1\xf2\xe0\xed\xee\xea"))
+	f.Add([]byte("\xd0"))
+	f.Add([]byte("\xff\xfeT\x00e\x00"))
+	f.Add([]byte("\ufeff\xd1"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		text := decodeForTest(t, data)
+
+		if !utf8.ValidString(text) {
+			t.Fatalf("результат не является корректным UTF-8: %q", text)
+		}
+
+		if utf8.Valid(data) {
+			if want := strings.TrimPrefix(string(data), "\ufeff"); text != want {
+				t.Fatalf("корректный UTF-8 изменен: %q -> %q", data, text)
+			}
+		}
+
+		// Побайтовое чтение заставляет декодер работать с символами, разорванными между порциями
+		r, err := getUTF8Reader(iotest.OneByteReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		oneByte, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(oneByte) != text {
+			t.Fatalf("результат зависит от порций чтения: %q и %q", text, oneByte)
+		}
+	})
+}
+
+// decodeForTest перекодирует данные через getUTF8Reader
+func decodeForTest(t *testing.T, data []byte) string {
+	t.Helper()
+
+	r, err := getUTF8Reader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(text)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// loadProductsJSON читает товары из файла JSON, сохраненного парсером (BOM допускается)
+func loadProductsJSON(filename string) ([]Product, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+
+	var products []Product
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil, fmt.Errorf("%s не является выгрузкой товаров в JSON: %v", filename, err)
+	}
+	return products, nil
+}
+
+// needsDetails сообщает, что у товара нет описания или характеристик: такие товары
+// обогащение загружает, остальные пропускает
+func needsDetails(product Product) bool {
+	return product.Description == "" || len(product.Features) == 0
+}
+
+// runEnrichOnly дообогащает выгрузку: загружает страницы только тех товаров файла, у которых
+// нет описания или характеристик, и перезаписывает файл. Порядок товаров сохраняется.
+// При прерывании записывается то, что успели загрузить, поэтому запуск можно повторить
+func runEnrichOnly(ctx context.Context, filename string, enrichThreads, delayMs int, productTimeout time.Duration) error {
+	products, err := loadProductsJSON(filename)
+	if err != nil {
+		return err
+	}
+
+	// Обогащение меняет порядок товаров, поэтому запоминаем их места по ID и адресу
+	positions := make(map[string]int)
+	var pending []Product
+	for i, product := range products {
+		if needsDetails(product) && product.URL != "" {
+			positions[product.ID+"\x00"+product.URL] = i
+			pending = append(pending, product)
+		}
+	}
+	fmt.Printf("В файле %s %d товаров, без описания или характеристик %d\n", filename, len(products), len(pending))
+	if len(pending) == 0 {
+		return nil
+	}
+
+	sdNotify(fmt.Sprintf("STATUS=Обогащение %d товаров", len(pending)))
+	enrichSemaphore := make(chan struct{}, enrichThreads)
+	status.TrackQueue("обогащения", enrichSemaphore)
+	enrichProductsWithDetails(ctx, pending, enrichSemaphore, delayMs, productTimeout, nil)
+	bars.Stop()
+
+	filled := 0
+	for _, product := range pending {
+		i, ok := positions[product.ID+"\x00"+product.URL]
+		if !ok {
+			continue
+		}
+		if !needsDetails(product) {
+			filled++
+		}
+		products[i] = product
+	}
+
+	// Файл заменяется целиком после записи, чтобы прерванная запись не испортила выгрузку
+	tmp := filename + ".tmp"
+	if err := saveToJSON(products, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return err
+	}
+	saveRunMetadata(filename, "json", len(products))
+
+	if ctx.Err() != nil {
+		slog.Warn("Обогащение прервано, загруженные данные сохранены", "file", filename)
+	}
+	fmt.Printf("Дополнено товаров: %d из %d. Результаты сохранены в файл %s\n", filled, len(pending), filename)
+	return nil
+}
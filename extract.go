@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Разбор страниц отделен от загрузки: функции этого файла получают готовый документ
+// и заголовки ответа, ничего не загружают и не пишут в журнал, поэтому их результат
+// проверяется на сохраненных страницах (testdata/golden)
+
+// listPage - результат разбора страницы списка товаров
+type listPage struct {
+	Products    []Product `json:"products"`
+	HasNextPage bool      `json:"has_next_page"`
+	LastPage    int       `json:"last_page"` // Наибольший номер страницы в пагинации и NavPageCount
+	NoIndex     bool      `json:"noindex"`   // Страница запрещена к индексации
+}
+
+// parseListPage разбирает страницу списка адаптером сайта: товары в области обхода, признак
+// следующей страницы и номер последней. header - заголовки ответа, nil для сохраненной страницы
+func parseListPage(doc *goquery.Document, header http.Header, category Category, priceOnly bool) listPage {
+	products, hasNextPage := site.ParseProductList(doc, category, priceOnly)
+	return listPage{
+		Products:    scope.FilterProducts(products),
+		HasNextPage: hasNextPage,
+		LastPage:    site.LastPage(doc),
+		NoIndex:     pageNoIndex(doc, header),
+	}
+}
+
+// parseProductPage разбирает страницу товара pageURL адаптером сайта и отмечает запрет индексации
+// из разметки или заголовков ответа
+func parseProductPage(doc *goquery.Document, header http.Header, pageURL string) Product {
+	product := site.ParseProductDetails(doc, pageURL)
+	product.NoIndex = pageNoIndex(doc, header)
+	return product
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// updateGolden перезаписывает эталоны результатом разбора: go test -run Golden -update
+var updateGolden = flag.Bool("update", false, "перезаписать эталоны testdata/golden")
+
+// TestParseGolden разбирает сохраненные страницы testdata/golden/<вид>/<имя>.html и сравнивает
+// результат с эталоном <имя>.json. Вид list - страница списка категории, product - страница товара.
+// Адрес страницы берется из <имя>.url, а без него - /catalog/<имя>/ или /catalog/golden/<имя>.html
+func TestParseGolden(t *testing.T) {
+	if err := useSiteAdapter("stanki.ru"); err != nil {
+		t.Fatal(err)
+	}
+
+	parsers := map[string]struct {
+		pageURL func(name string) string
+		parse   func(doc *goquery.Document, pageURL string) any
+	}{
+		"list": {
+			func(name string) string { return catalogURL + name + "/" },
+			func(doc *goquery.Document, pageURL string) any {
+				return parseListPage(doc, nil, Category{Name: "Golden", URL: pageURL}, false)
+			},
+		},
+		"product": {
+			func(name string) string { return catalogURL + "golden/" + name + ".html" },
+			func(doc *goquery.Document, pageURL string) any {
+				return parseProductPage(doc, nil, pageURL)
+			},
+		},
+	}
+
+	for kind, parser := range parsers {
+		files, err := filepath.Glob(filepath.Join("testdata", "golden", kind, "*.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Fatalf("в testdata/golden/%s нет страниц", kind)
+		}
+
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), ".html")
+			t.Run(kind+"/"+name, func(t *testing.T) {
+				f, err := os.Open(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+
+				utf8Reader, err := getUTF8Reader(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				doc, err := goquery.NewDocumentFromReader(utf8Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				pageURL := parser.pageURL(name)
+				if data, err := os.ReadFile(strings.TrimSuffix(file, ".html") + ".url"); err == nil {
+					pageURL = strings.TrimSpace(string(data))
+				}
+
+				var got bytes.Buffer
+				encoder := json.NewEncoder(&got)
+				encoder.SetEscapeHTML(false)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(parser.parse(doc, pageURL)); err != nil {
+					t.Fatal(err)
+				}
+
+				golden := strings.TrimSuffix(file, ".html") + ".json"
+				if *updateGolden {
+					if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("нет эталона (создать: go test -run TestParseGolden -update): %v", err)
+				}
+				if !bytes.Equal(got.Bytes(), want) {
+					t.Errorf("результат разбора отличается от эталона %s\nполучено:\n%s\nожидалось:\n%s", golden, got.Bytes(), want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// runFetch выполняет команду fetch: загружает один адрес тем же клиентом,
+// что и парсер (прокси, robots.txt, задержки), и выводит статус, заголовки,
+// определенную кодировку и тело ответа в UTF-8
+func runFetch(ctx context.Context, args []string, delayMs int) error {
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	output := fs.String("o", "", "Файл для записи результата (по умолчанию stdout)")
+	retries := fs.Int("retries", 1, "Количество попыток запроса")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: parserEol [флаги] fetch [-o файл] [-retries N] <url>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("нужно указать ровно один URL")
+	}
+	url := fs.Arg(0)
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	start := time.Now()
+	resp, err := doRequestWithRetry(ctx, url, *retries, delayMs)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ошибка при чтении тела ответа: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	fmt.Fprintf(out, "URL: %s\n", url)
+	fmt.Fprintf(out, "Итоговый URL: %s\n", resp.Request.URL)
+	fmt.Fprintf(out, "Статус: %s\n", resp.Status)
+	fmt.Fprintf(out, "Протокол: %s\n", resp.Proto)
+	fmt.Fprintf(out, "Время: %v\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(out, "Размер тела: %d байт\n", len(body))
+
+	fmt.Fprintln(out, "\n=== ЗАГОЛОВКИ ===")
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range resp.Header[name] {
+			fmt.Fprintf(out, "%s: %s\n", name, value)
+		}
+	}
+
+	_, encodingName := sniffEncoding(bytes.TrimPrefix(body, utf8BOM), resp.Header.Get("Content-Type"))
+	fmt.Fprintf(out, "\n=== КОДИРОВКА ===\n%s\n", encodingName)
+
+	// Тело перекодируется так же, как страницы при обходе
+	reader, err := newUTF8Reader(bytes.NewReader(body), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("ошибка при перекодировании тела ответа: %v", err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("ошибка при перекодировании тела ответа: %v", err)
+	}
+
+	fmt.Fprintln(out, "\n=== ТЕЛО ОТВЕТА ===")
+	if _, err := out.Write(decoded); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+
+	return nil
+}
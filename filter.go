@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// productFilter отбирает товары для выгрузки по диапазону цены и названию
+// (-filter-min-price, -filter-max-price, -filter-name-regex). Фильтр применяется только
+// к файлам результатов и PostgreSQL: снимок -incremental, хранилище известных товаров
+// и статистика цен по-прежнему строятся по всем товарам, иначе отфильтрованные товары
+// в следующем запуске считались бы пропавшими
+type productFilter struct {
+	minPrice float64
+	maxPrice float64
+	name     *regexp.Regexp
+}
+
+// newProductFilter создает фильтр; nil означает, что фильтр не задан. Нулевая граница цены не проверяется
+func newProductFilter(minPrice, maxPrice float64, namePattern string) (*productFilter, error) {
+	if minPrice < 0 || maxPrice < 0 {
+		return nil, fmt.Errorf("границы цены не могут быть отрицательными")
+	}
+	if maxPrice > 0 && minPrice > maxPrice {
+		return nil, fmt.Errorf("минимальная цена %v больше максимальной %v", minPrice, maxPrice)
+	}
+	if minPrice == 0 && maxPrice == 0 && namePattern == "" {
+		return nil, nil
+	}
+
+	f := &productFilter{minPrice: minPrice, maxPrice: maxPrice}
+	if namePattern != "" {
+		re, err := regexp.Compile(namePattern)
+		if err != nil {
+			return nil, fmt.Errorf("регулярное выражение %q: %v", namePattern, err)
+		}
+		f.name = re
+	}
+	return f, nil
+}
+
+// Match сообщает, попадает ли товар в выгрузку. Товар без цены при заданных границах цены
+// не попадает: проверить, что цена в диапазоне, нельзя
+func (f *productFilter) Match(product Product) bool {
+	if f == nil {
+		return true
+	}
+	if f.minPrice > 0 || f.maxPrice > 0 {
+		price, ok := parsePrice(product.Price)
+		if !ok || (f.minPrice > 0 && price < f.minPrice) || (f.maxPrice > 0 && price > f.maxPrice) {
+			return false
+		}
+	}
+	if f.name != nil && !f.name.MatchString(product.Name) {
+		return false
+	}
+	return true
+}
+
+// Filter возвращает товары, попадающие в выгрузку
+func (f *productFilter) Filter(products []Product) []Product {
+	if f == nil {
+		return products
+	}
+	kept := make([]Product, 0, len(products))
+	for _, product := range products {
+		if f.Match(product) {
+			kept = append(kept, product)
+		}
+	}
+	return kept
+}
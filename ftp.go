@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ftpConn - управляющее соединение FTP. Данные передаются в пассивном режиме (EPSV, затем PASV):
+// активный режим не проходит через NAT и межсетевые экраны
+type ftpConn struct {
+	conn    net.Conn
+	text    *textproto.Conn
+	host    string
+	tlsConf *tls.Config // Для ftps: TLS управляющего соединения и соединений данных
+}
+
+func dialFTP(ctx context.Context, d *fileDelivery) (uploadConn, error) {
+	host := d.target.Host
+	if d.target.Port() == "" {
+		host = net.JoinHostPort(d.target.Hostname(), "21")
+	}
+
+	dialer := net.Dialer{Timeout: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	c := &ftpConn{conn: conn, text: textproto.NewConn(conn), host: d.target.Hostname()}
+	if err := c.login(d); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// login приветствует сервер, для ftps включает TLS (AUTH TLS, PROT P) и входит
+func (c *ftpConn) login(d *fileDelivery) error {
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		return err
+	}
+
+	if d.target.Scheme == "ftps" {
+		if _, err := c.cmd(234, "AUTH TLS"); err != nil {
+			return err
+		}
+		c.tlsConf = &tls.Config{ServerName: c.host, ClientSessionCache: tls.NewLRUClientSessionCache(4)}
+		c.conn = tls.Client(c.conn, c.tlsConf)
+		c.text = textproto.NewConn(c.conn)
+	}
+
+	// 230 - вход без пароля, 331 - нужен пароль
+	code, message, err := c.cmdCode("USER %s", d.user())
+	if err != nil {
+		return err
+	}
+	if code == 331 {
+		code, message, err = c.cmdCode("PASS %s", d.password)
+		if err != nil {
+			return err
+		}
+	}
+	if code != 230 {
+		return fmt.Errorf("вход на сервер FTP: %d %s", code, message)
+	}
+
+	if c.tlsConf != nil {
+		if _, err := c.cmd(200, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, err := c.cmd(200, "PROT P"); err != nil {
+			return err
+		}
+	}
+	_, err = c.cmd(200, "TYPE I")
+	return err
+}
+
+// cmd отправляет команду и проверяет код ответа: 200 - точное совпадение, 1 - первая цифра
+func (c *ftpConn) cmd(expect int, format string, args ...any) (string, error) {
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return "", err
+	}
+	_, message, err := c.text.ReadResponse(expect)
+	return message, err
+}
+
+// cmdCode отправляет команду и возвращает код ответа без проверки
+func (c *ftpConn) cmdCode(format string, args ...any) (int, string, error) {
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(0)
+}
+
+func (c *ftpConn) Close() error {
+	c.text.Cmd("QUIT")
+	return c.conn.Close()
+}
+
+// dataConn открывает пассивное соединение данных. Адрес из ответа PASV не используется:
+// за NAT сервер часто сообщает внутренний адрес, поэтому подключаемся к тому же серверу
+func (c *ftpConn) dataConn(ctx context.Context) (net.Conn, error) {
+	port, err := c.epsv()
+	if err != nil {
+		if port, err = c.pasv(); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer := net.Dialer{Timeout: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	if c.tlsConf != nil {
+		conn = tls.Client(conn, c.tlsConf)
+	}
+	return conn, nil
+}
+
+// epsv разбирает ответ "229 Entering Extended Passive Mode (|||6446|)"
+func (c *ftpConn) epsv() (int, error) {
+	message, err := c.cmd(229, "EPSV")
+	if err != nil {
+		return 0, err
+	}
+	start, end := strings.Index(message, "(|||"), strings.LastIndex(message, "|)")
+	if start < 0 || end < start+4 {
+		return 0, fmt.Errorf("некорректный ответ EPSV: %s", message)
+	}
+	return strconv.Atoi(message[start+4 : end])
+}
+
+// pasv разбирает ответ "227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)"
+func (c *ftpConn) pasv() (int, error) {
+	message, err := c.cmd(227, "PASV")
+	if err != nil {
+		return 0, err
+	}
+	start, end := strings.Index(message, "("), strings.LastIndex(message, ")")
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("некорректный ответ PASV: %s", message)
+	}
+	parts := strings.Split(message[start+1:end], ",")
+	if len(parts) != 6 {
+		return 0, fmt.Errorf("некорректный ответ PASV: %s", message)
+	}
+	high, err1 := strconv.Atoi(strings.TrimSpace(parts[4]))
+	low, err2 := strconv.Atoi(strings.TrimSpace(parts[5]))
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("некорректный ответ PASV: %s", message)
+	}
+	return high<<8 | low, nil
+}
+
+// Put загружает файл командой STOR во временный remote.part и переименовывает его (RNFR/RNTO)
+func (c *ftpConn) Put(ctx context.Context, local, remote string) error {
+	stop := context.AfterFunc(ctx, func() { c.conn.Close() })
+	defer stop()
+
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := c.dataConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	part := remote + uploadPartSuffix
+	// 125 - соединение данных уже открыто, 150 - сервер его открывает
+	if _, err := c.cmd(1, "STOR %s", part); err != nil {
+		return fmt.Errorf("STOR %s: %w", part, err)
+	}
+	if _, err := io.Copy(data, f); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	if _, _, err := c.text.ReadResponse(226); err != nil {
+		return fmt.Errorf("STOR %s: %w", part, err)
+	}
+
+	if _, err := c.cmd(350, "RNFR %s", part); err != nil {
+		return fmt.Errorf("переименование %s: %w", part, err)
+	}
+	if _, err := c.cmd(250, "RNTO %s", remote); err != nil {
+		return fmt.Errorf("переименование %s: %w", part, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// galleryImage - изображение галереи товара с текстом alt и подписью
+type galleryImage struct {
+	URL     string `json:"url"`
+	Alt     string `json:"alt,omitempty"`
+	Caption string `json:"caption,omitempty"`
+}
+
+// extractGallery собирает изображения из блоков галереи containers вместе с alt и подписями.
+// Подпись берется из figcaption, data-caption или title ссылки на полноразмерное изображение
+// (так их задают fancybox и подобные скрипты) или из title самого изображения
+func extractGallery(doc *goquery.Document, pageURL, containers string) []galleryImage {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+
+	var images []galleryImage
+	seen := make(map[string]bool)
+
+	doc.Find(containers).Find("img").Each(func(_ int, img *goquery.Selection) {
+		src := imageSource(img)
+		if src == "" {
+			return
+		}
+		u, err := base.Parse(src)
+		if err != nil || seen[u.String()] {
+			return
+		}
+		seen[u.String()] = true
+
+		images = append(images, galleryImage{
+			URL:     u.String(),
+			Alt:     cleanImageText(img.AttrOr("alt", "")),
+			Caption: imageCaption(img),
+		})
+	})
+
+	return images
+}
+
+// imageSource возвращает адрес изображения с учетом отложенной загрузки:
+// до прокрутки в src часто стоит заглушка, а настоящий адрес - в data-src
+func imageSource(img *goquery.Selection) string {
+	for _, attr := range []string{"data-src", "data-lazy", "data-original", "src"} {
+		if src := strings.TrimSpace(img.AttrOr(attr, "")); src != "" && !strings.HasPrefix(src, "data:") {
+			return src
+		}
+	}
+	return ""
+}
+
+// imageCaption ищет подпись к изображению
+func imageCaption(img *goquery.Selection) string {
+	if caption := cleanImageText(img.Closest("figure").Find("figcaption").First().Text()); caption != "" {
+		return caption
+	}
+
+	link := img.Closest("a")
+	for _, attr := range []string{"data-caption", "data-title", "title"} {
+		if caption := cleanImageText(link.AttrOr(attr, "")); caption != "" {
+			return caption
+		}
+	}
+
+	return cleanImageText(img.AttrOr("title", ""))
+}
+
+// galleryTexts объединяет alt и подписи изображений галереи через "|" для таблиц CSV и XLSX
+func galleryTexts(images []galleryImage) string {
+	var texts []string
+	for _, image := range images {
+		text := image.Caption
+		if text == "" {
+			text = image.Alt
+		} else if image.Alt != "" && image.Alt != image.Caption {
+			text = image.Alt + " - " + image.Caption
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "|")
+}
+
+// cleanImageText убирает лишние пробелы и переводы строк из alt и подписей
+func cleanImageText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
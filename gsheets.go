@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Режимы -gsheet-mode
+const (
+	gsheetReplace = "replace" // Лист очищается и заполняется товарами запуска
+	gsheetAppend  = "append"  // Товары дописываются под уже имеющимися строками
+)
+
+const (
+	sheetsAPI   = "https://sheets.googleapis.com/v4/spreadsheets/"
+	sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+	// gsheetBatch - строк в одном запросе записи: запрос Sheets API ограничен по размеру
+	gsheetBatch = 2000
+	// gsheetCellLimit - максимальная длина текста в ячейке Google Sheets
+	gsheetCellLimit = 50000
+)
+
+// serviceAccountKey - нужные поля JSON-ключа сервисного аккаунта Google
+type serviceAccountKey struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// sheetsExporter записывает товары на лист таблицы Google Sheets через Sheets API v4.
+// Доступ - по ключу сервисного аккаунта; таблицу нужно открыть для его client_email
+// с правом редактирования, как для обычного пользователя
+type sheetsExporter struct {
+	client        *http.Client
+	spreadsheetID string
+	sheet         string
+	mode          string
+	key           serviceAccountKey
+	signer        *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// newSheetsExporter читает ключ сервисного аккаунта (-gsheet-key или GOOGLE_APPLICATION_CREDENTIALS)
+func newSheetsExporter(spreadsheetID, keyFile, sheet, mode string) (*sheetsExporter, error) {
+	switch mode {
+	case gsheetReplace, gsheetAppend:
+	default:
+		return nil, fmt.Errorf("неизвестный режим %q (допустимо: replace, append)", mode)
+	}
+	if keyFile == "" {
+		keyFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if keyFile == "" {
+		return nil, fmt.Errorf("не указан ключ сервисного аккаунта: -gsheet-key или GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	e := &sheetsExporter{
+		client:        &http.Client{Timeout: 2 * time.Minute},
+		spreadsheetID: spreadsheetID,
+		sheet:         sheet,
+		mode:          mode,
+	}
+	if err := json.Unmarshal(data, &e.key); err != nil {
+		return nil, fmt.Errorf("ключ %s: %v", keyFile, err)
+	}
+	if e.key.Type != "service_account" || e.key.ClientEmail == "" {
+		return nil, fmt.Errorf("%s - не ключ сервисного аккаунта", keyFile)
+	}
+	if e.key.TokenURI == "" {
+		e.key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(e.key.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("ключ %s: не найден private_key", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("ключ %s: %v", keyFile, err)
+	}
+	signer, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("ключ %s: ожидается ключ RSA", keyFile)
+	}
+	e.signer = signer
+	return e, nil
+}
+
+// accessToken возвращает токен доступа OAuth 2.0, полученный обменом подписанного JWT.
+// Токен живет час, а обход бывает дольше, поэтому он обновляется незадолго до истечения
+func (e *sheetsExporter) accessToken(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token != "" && time.Until(e.expires) > time.Minute {
+		return e.token, nil
+	}
+
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   e.key.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   e.key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, e.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("получение токена Google: код ответа %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("получение токена Google: некорректный ответ")
+	}
+	e.token = token.AccessToken
+	e.expires = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return e.token, nil
+}
+
+// call выполняет запрос к Sheets API; при 429 и 5xx (квота на запросы в минуту) повторяет его
+func (e *sheetsExporter) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var payload []byte
+	if in != nil {
+		var err error
+		if payload, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < 5; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryBackoff(attempt, 2000, 0)):
+			}
+		}
+
+		token, err := e.accessToken(ctx)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, sheetsAPI+e.spreadsheetID+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := e.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("Sheets API: код ответа %d: %s", resp.StatusCode, sheetsErrorMessage(body))
+			if retryableStatus(resp.StatusCode) {
+				continue
+			}
+			return lastErr
+		}
+		if out != nil {
+			return json.Unmarshal(body, out)
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// sheetsErrorMessage извлекает текст ошибки из ответа Google API
+func sheetsErrorMessage(body []byte) string {
+	var apiErr struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+		return apiErr.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// sheetRange возвращает диапазон листа в нотации A1 с названием в кавычках
+func (e *sheetsExporter) sheetRange(cells string) string {
+	name := "'" + strings.ReplaceAll(e.sheet, "'", "''") + "'"
+	if cells != "" {
+		name += "!" + cells
+	}
+	return url.PathEscape(name)
+}
+
+// Prepare проверяет доступ к таблице и создает лист, если его нет. Вызывается до обхода,
+// чтобы ошибка в ключе или правах доступа обнаружилась сразу
+func (e *sheetsExporter) Prepare(ctx context.Context) error {
+	var spreadsheet struct {
+		Sheets []struct {
+			Properties struct {
+				Title string `json:"title"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	if err := e.call(ctx, http.MethodGet, "?fields=sheets.properties.title", nil, &spreadsheet); err != nil {
+		return err
+	}
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties.Title == e.sheet {
+			return nil
+		}
+	}
+
+	addSheet := map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{"addSheet": map[string]interface{}{"properties": map[string]string{"title": e.sheet}}},
+		},
+	}
+	return e.call(ctx, http.MethodPost, ":batchUpdate", addSheet, nil)
+}
+
+// Export записывает товары на лист: колонки те же, что в CSV (с учетом -csv-columns).
+// В режиме append строки подстраиваются под заголовок, уже записанный на листе,
+// чтобы колонки не съехали, если в этом запуске набор колонок другой
+func (e *sheetsExporter) Export(ctx context.Context, products []Product) (int, error) {
+	var columns tableColumns = newProductColumns(products)
+	if len(csvColumns) > 0 {
+		columns = csvColumns
+	}
+	headers := columns.Headers()
+
+	// order[i] - индекс колонки товара для i-й колонки листа; -1 - колонки у товаров нет
+	order := make([]int, len(headers))
+	for i := range order {
+		order[i] = i
+	}
+	sheetHeaders := headers
+	writeHeader := true
+
+	if e.mode == gsheetReplace {
+		if err := e.call(ctx, http.MethodPost, "/values/"+e.sheetRange("")+":clear", struct{}{}, nil); err != nil {
+			return 0, err
+		}
+	} else {
+		var existing struct {
+			Values [][]string `json:"values"`
+		}
+		if err := e.call(ctx, http.MethodGet, "/values/"+e.sheetRange("1:1"), nil, &existing); err != nil {
+			return 0, err
+		}
+		if len(existing.Values) > 0 && len(existing.Values[0]) > 0 {
+			sheetHeaders, writeHeader = existing.Values[0], false
+			index := make(map[string]int, len(headers))
+			for i, header := range headers {
+				index[header] = i
+			}
+			order = make([]int, len(sheetHeaders))
+			for i, header := range sheetHeaders {
+				if j, ok := index[header]; ok {
+					order[i] = j
+				} else {
+					order[i] = -1
+				}
+			}
+		}
+	}
+
+	// Цена записывается числом, чтобы по ней работали сортировка и формулы
+	priceColumn := -1
+	for i, header := range sheetHeaders {
+		if header == productFields["price"].header {
+			priceColumn = i
+		}
+	}
+
+	var rows [][]interface{}
+	if writeHeader {
+		header := make([]interface{}, len(headers))
+		for i, h := range headers {
+			header[i] = h
+		}
+		rows = append(rows, header)
+	}
+
+	written := 0
+	for i, product := range products {
+		values := columns.Row(product)
+		row := make([]interface{}, len(order))
+		for col, j := range order {
+			value := ""
+			if j >= 0 {
+				value = values[j]
+			}
+			if col == priceColumn {
+				if price, ok := parsePrice(value); ok {
+					row[col] = price
+					continue
+				}
+			}
+			row[col] = truncateRunes(value, gsheetCellLimit)
+		}
+		rows = append(rows, row)
+
+		if len(rows) >= gsheetBatch || i == len(products)-1 {
+			if err := e.appendRows(ctx, rows); err != nil {
+				return written, err
+			}
+			written = i + 1
+			rows = rows[:0]
+		}
+	}
+	// Пустой запуск в режиме replace оставляет на листе только заголовок
+	if len(rows) > 0 {
+		if err := e.appendRows(ctx, rows); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// appendRows дописывает строки под таблицей листа. Значения передаются как есть (RAW):
+// название товара, начинающееся с "=", не станет формулой
+func (e *sheetsExporter) appendRows(ctx context.Context, rows [][]interface{}) error {
+	body := map[string]interface{}{"values": rows}
+	path := "/values/" + e.sheetRange("A1") + ":append?valueInputOption=RAW&insertDataOption=OVERWRITE"
+	return e.call(ctx, http.MethodPost, path, body, nil)
+}
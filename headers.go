@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// defaultUserAgent - User-Agent обычного браузера, используемый по умолчанию вместо Go-http-client
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+// headerTransport добавляет к запросам заголовки, которые отправляет браузер,
+// и выбирает User-Agent из списка для каждого запроса
+type headerTransport struct {
+	base       http.RoundTripper
+	userAgents []string
+}
+
+// newHeaderTransport оборачивает транспорт base. Если base не задан, используется стандартный
+func newHeaderTransport(base http.RoundTripper, userAgents []string) *headerTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if len(userAgents) == 0 {
+		userAgents = []string{defaultUserAgent}
+	}
+	return &headerTransport{base: base, userAgents: userAgents}
+}
+
+// RoundTrip дополняет заголовки запроса, не перезаписывая уже заданные
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// По контракту RoundTripper исходный запрос менять нельзя
+	req = req.Clone(req.Context())
+
+	if req.Header.Get("User-Agent") == "" {
+		userAgent := t.userAgents[0]
+		if len(t.userAgents) > 1 {
+			userAgent = t.userAgents[randIntn(len(t.userAgents))]
+		}
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8")
+	}
+	if req.Header.Get("Accept-Language") == "" {
+		if siteLocale == "en" {
+			req.Header.Set("Accept-Language", "en-US,en;q=0.9,ru;q=0.5")
+		} else {
+			req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7")
+		}
+	}
+
+	// Переход на страницу сайта выглядит как переход из каталога
+	if req.Header.Get("Referer") == "" && req.URL.String() != catalogURL {
+		req.Header.Set("Referer", catalogURL)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// requestHeaderKey - ключ контекста с дополнительными заголовками запроса
+type requestHeaderKey struct{}
+
+// withRequestHeader возвращает контекст, запросы с которым doRequestWithRetry отправляет
+// с заголовками header, например заголовками запроса подгрузки страницы
+func withRequestHeader(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, requestHeaderKey{}, header)
+}
+
+// applyRequestHeader добавляет к запросу заголовки из его контекста
+func applyRequestHeader(req *http.Request) {
+	header, _ := req.Context().Value(requestHeaderKey{}).(http.Header)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+}
+
+// loadUserAgents собирает список User-Agent из флага и файла (по одному в строке)
+func loadUserAgents(userAgent, file string) ([]string, error) {
+	var agents []string
+	if userAgent != "" {
+		agents = append(agents, userAgent)
+	}
+
+	if file == "" {
+		return agents, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		agents = append(agents, line)
+	}
+
+	return agents, scanner.Err()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimits ограничивает число запросов в секунду к каждому хосту; nil - без ограничения
+var hostLimits *hostRateLimiter
+
+// hostLimitTransport берет токен hostLimits перед каждой отправкой запроса в сеть. Предел
+// действует на уровне транспорта, поэтому распространяется на повторные попытки и на все
+// запросы запуска (robots.txt, категории, бренды, -fetch), а не только на те, что ждут очереди
+// в waitTurn
+type hostLimitTransport struct {
+	next http.RoundTripper
+}
+
+// newHostLimitTransport создает транспорт с пределом -rps поверх next
+func newHostLimitTransport(next http.RoundTripper) *hostLimitTransport {
+	return &hostLimitTransport{next: next}
+}
+
+func (t *hostLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := hostLimits.Wait(req.Context(), req.URL.String()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// hostRateLimiter - корзина токенов для каждого хоста. В отличие от -delay, которую выдерживает
+// каждый поток, ограничение общее для всех потоков: увеличение -threads ускоряет разбор
+// и обогащение, но не частоту запросов к сайту
+type hostRateLimiter struct {
+	rate  float64 // Токенов в секунду
+	burst float64 // Сколько запросов можно выполнить подряд после простоя
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newHostRateLimiter создает ограничитель rps запросов в секунду с запасом burst
+func newHostRateLimiter(rps float64, burst int) *hostRateLimiter {
+	return &hostRateLimiter{rate: rps, burst: float64(max(burst, 1)), buckets: make(map[string]*tokenBucket)}
+}
+
+// lowerToCrawlDelay снижает частоту до 1/Crawl-delay, если robots.txt требует большую паузу
+func (l *hostRateLimiter) lowerToCrawlDelay(crawlDelay time.Duration) bool {
+	if crawlDelay <= 0 || l.rate <= float64(time.Second)/float64(crawlDelay) {
+		return false
+	}
+	l.rate = float64(time.Second) / float64(crawlDelay)
+	l.burst = 1
+	return true
+}
+
+// Wait дожидается токена хоста адреса. Токен резервируется сразу, поэтому потоки
+// получают очередь в порядке обращения, а не соревнуются за освободившийся токен
+func (l *hostRateLimiter) Wait(ctx context.Context, rawURL string) error {
+	if l == nil {
+		return nil
+	}
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = strings.ToLower(u.Hostname())
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	bucket := l.buckets[host]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[host] = bucket
+	}
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	bucket.tokens--
+	var wait time.Duration
+	if bucket.tokens < 0 {
+		wait = time.Duration(-bucket.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
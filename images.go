@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// maxImageSize ограничивает размер загружаемого изображения: ответ больше этого - скорее всего не картинка
+const maxImageSize = 20 << 20
+
+// imageFileNameRe - символы ID товара, недопустимые в имени файла
+var imageFileNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// imageExtensions - расширения файлов по типу содержимого; mime.ExtensionsByType для image/jpeg
+// может вернуть .jfif или .jpe, поэтому основные типы заданы явно
+var imageExtensions = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/avif":    ".avif",
+	"image/svg+xml": ".svg",
+	"image/bmp":     ".bmp",
+}
+
+// imageDownloader загружает изображения товаров в каталог. Одинаковые изображения
+// (по адресу или по содержимому) сохраняются один раз, и товары ссылаются на общий файл
+type imageDownloader struct {
+	dir     string
+	delayMs int
+
+	mu     sync.Mutex
+	byURL  map[string]string // Адрес изображения -> локальный файл
+	byHash map[string]string // SHA-256 содержимого -> локальный файл
+
+	downloaded int
+	reused     int
+	failed     int
+}
+
+// downloadProductImages загружает изображения товаров в каталог dir не более чем в threads потоков
+// и заполняет LocalImagePath. Файл называется по ID товара: 12345.jpg
+func downloadProductImages(ctx context.Context, products []Product, dir string, threads, delayMs int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("не удалось создать каталог изображений %s: %v", dir, err)
+	}
+
+	d := &imageDownloader{
+		dir:     dir,
+		delayMs: delayMs,
+		byURL:   make(map[string]string),
+		byHash:  make(map[string]string),
+	}
+
+	semaphore := make(chan struct{}, threads)
+	status.TrackQueue("изображений", semaphore)
+
+	var wg sync.WaitGroup
+	for i := range products {
+		if !hasImage(products[i]) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(product *Product) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			localPath, err := d.download(ctx, product.ID, product.ImageURL)
+			if err != nil {
+				d.mu.Lock()
+				d.failed++
+				d.mu.Unlock()
+				status.CountError("изображения")
+				slog.Error("Ошибка при загрузке изображения", "id", product.ID, "url", product.ImageURL, "err", err)
+				return
+			}
+			product.LocalImagePath = localPath
+		}(&products[i])
+	}
+	wg.Wait()
+
+	fmt.Printf("Изображения: загружено %d, повторов %d, ошибок %d (каталог %s)\n", d.downloaded, d.reused, d.failed, dir)
+	return nil
+}
+
+// hasImage проверяет, что у товара есть адрес изображения: без изображения в карточке
+// ImageURL содержит только адрес сайта
+func hasImage(product Product) bool {
+	return product.ImageURL != "" && strings.TrimSuffix(product.ImageURL, "/") != baseURL
+}
+
+// download загружает изображение и возвращает путь к локальному файлу.
+// Повторная загрузка (ошибки сети, 429/5xx) выполняется doRequestWithRetry
+func (d *imageDownloader) download(ctx context.Context, productID, imageURL string) (string, error) {
+	d.mu.Lock()
+	if localPath, ok := d.byURL[imageURL]; ok {
+		d.reused++
+		d.mu.Unlock()
+		return localPath, nil
+	}
+	d.mu.Unlock()
+
+	if !robots.Allowed(imageURL) {
+		return "", fmt.Errorf("адрес запрещен robots.txt")
+	}
+
+	if err := waitTurn(ctx, imageURL); err != nil {
+		return "", err
+	}
+
+	resp, err := doRequestWithRetry(ctx, imageURL, 3, d.delayMs)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("код ответа %d", resp.StatusCode)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType != "" && !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("ответ не является изображением: %s", contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxImageSize {
+		return "", fmt.Errorf("изображение больше %d МБ", maxImageSize>>20)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if localPath, ok := d.byHash[hash]; ok {
+		d.byURL[imageURL] = localPath
+		d.reused++
+		return localPath, nil
+	}
+
+	localPath := filepath.Join(d.dir, imageFileName(productID, imageURL, contentType))
+	if err := writeFileAtomic(localPath, data); err != nil {
+		return "", err
+	}
+
+	d.byHash[hash] = localPath
+	d.byURL[imageURL] = localPath
+	d.downloaded++
+	return localPath, nil
+}
+
+// imageFileName строит имя файла из ID товара и расширения по типу содержимого или адресу
+func imageFileName(productID, imageURL, contentType string) string {
+	name := imageFileNameRe.ReplaceAllString(productID, "_")
+	if name == "" {
+		name = "image"
+	}
+
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		if u, err := url.Parse(imageURL); err == nil {
+			ext = strings.ToLower(path.Ext(u.Path))
+		}
+	}
+	if ext == "" {
+		ext = ".img"
+	}
+
+	return name + ext
+}
+
+// writeFileAtomic записывает файл через временный, чтобы прерванная запись не оставила обрезанное изображение
+func writeFileAtomic(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
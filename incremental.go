@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Значения поля change_type в инкрементальном режиме
+const (
+	changeNew     = "new"
+	changeChanged = "changed"
+	changeRemoved = "removed"
+)
+
+// snapshotBucket - бакет bbolt с товарами предыдущего запуска по ключу дедупликации
+var snapshotBucket = []byte("products")
+
+// incrementalState хранит снимок товаров предыдущего запуска и определяет,
+// какие товары нового запуска появились, изменились или исчезли
+type incrementalState struct {
+	db *bolt.DB
+}
+
+// openIncrementalState открывает (или создает) файл снимка.
+// Файл блокируется на время работы, поэтому два запуска с одним снимком не смешают данные
+func openIncrementalState(filename string) (*incrementalState, error) {
+	db, err := bolt.Open(filename, 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть снимок %s: %v", filename, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(snapshotBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &incrementalState{db: db}, nil
+}
+
+// Close закрывает файл снимка
+func (s *incrementalState) Close() error {
+	return s.db.Close()
+}
+
+// previous возвращает товар из снимка по ключу
+func (s *incrementalState) previous(key string) (Product, bool) {
+	var product Product
+	found := false
+
+	s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(snapshotBucket).Get([]byte(key))
+		if data != nil && json.Unmarshal(data, &product) == nil {
+			found = true
+		}
+		return nil
+	})
+
+	return product, found
+}
+
+// Classify сравнивает товар со снимком и возвращает его с заполненным ChangeType.
+// Для товаров без изменений второе значение - false: их не нужно выводить
+func (s *incrementalState) Classify(product Product) (Product, bool) {
+	key := dedupeBy.Key(product)
+	if key == "" {
+		return product, false
+	}
+
+	prev, found := s.previous(key)
+	switch {
+	case !found:
+		product.ChangeType = changeNew
+	case productChanged(prev, product):
+		product.ChangeType = changeChanged
+	default:
+		return product, false
+	}
+
+	return product, true
+}
+
+// Changes возвращает новые и измененные товары запуска, а также товары снимка,
+// которые пропали из каталога. Пропавшими считаются только товары категорий,
+// в которых в этом запуске найдены товары: категории, не обойденные из-за -categories,
+// -limit или ошибки, не превращают весь свой ассортимент в удаленный
+func (s *incrementalState) Changes(products []Product) (changed []Product, removed []Product) {
+	currentKeys := make(map[string]bool, len(products))
+	crawledCategories := make(map[string]bool)
+
+	for _, product := range products {
+		if p, ok := s.Classify(product); ok {
+			changed = append(changed, p)
+		}
+		currentKeys[dedupeBy.Key(product)] = true
+		crawledCategories[product.Category] = true
+	}
+
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotBucket).ForEach(func(k, v []byte) error {
+			if currentKeys[string(k)] {
+				return nil
+			}
+			var prev Product
+			if json.Unmarshal(v, &prev) != nil || !crawledCategories[prev.Category] {
+				return nil
+			}
+			prev.ChangeType = changeRemoved
+			removed = append(removed, prev)
+			return nil
+		})
+	})
+
+	return changed, removed
+}
+
+// Commit сохраняет товары запуска в снимок и удаляет из него пропавшие товары
+func (s *incrementalState) Commit(products []Product, removed []Product) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(snapshotBucket)
+
+		for _, product := range removed {
+			if err := bucket.Delete([]byte(dedupeBy.Key(product))); err != nil {
+				return err
+			}
+		}
+
+		for _, product := range products {
+			key := dedupeBy.Key(product)
+			if key == "" {
+				continue
+			}
+
+			// Если в этом запуске детали не загружались, сохраняем их из снимка,
+			// чтобы следующий полный запуск не счел все товары измененными
+			if prev, found := s.previousTx(bucket, key); found {
+				product = mergeKnownFields(prev, product)
+			}
+			product.ChangeType = ""
+
+			data, err := json.Marshal(product)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// previousTx читает товар из снимка внутри уже открытой транзакции
+func (s *incrementalState) previousTx(bucket *bolt.Bucket, key string) (Product, bool) {
+	var product Product
+	data := bucket.Get([]byte(key))
+	if data == nil || json.Unmarshal(data, &product) != nil {
+		return product, false
+	}
+	return product, true
+}
+
+// productChanged сравнивает товары по полям, которые есть в обоих.
+// Описание, характеристики, наличие и предложения без загрузки деталей (-skip-details) пусты и не сравниваются
+func productChanged(prev, cur Product) bool {
+	if prev.Name != cur.Name || prev.URL != cur.URL || prev.Price != cur.Price ||
+		prev.ImageURL != cur.ImageURL || prev.Category != cur.Category {
+		return true
+	}
+	if cur.Description != "" && prev.Description != "" && cur.Description != prev.Description {
+		return true
+	}
+	if len(cur.Features) > 0 && len(prev.Features) > 0 && !slices.Equal(cur.Features, prev.Features) {
+		return true
+	}
+	if len(cur.Specs) > 0 && len(prev.Specs) > 0 && !maps.Equal(cur.Specs, prev.Specs) {
+		return true
+	}
+	if cur.Availability != "" && prev.Availability != "" && cur.Availability != prev.Availability {
+		return true
+	}
+	if len(cur.Variants) > 0 && len(prev.Variants) > 0 && !variantsEqual(cur.Variants, prev.Variants) {
+		return true
+	}
+	return false
+}
+
+// mergeKnownFields дополняет товар полями со страницы товара (описание, характеристики, разметка schema.org)
+// и локальным изображением из снимка, если их нет в текущем запуске
+func mergeKnownFields(prev, cur Product) Product {
+	if cur.Description == "" {
+		cur.Description = prev.Description
+	}
+	if len(cur.Features) == 0 {
+		cur.Features = prev.Features
+	}
+	if len(cur.Specs) == 0 {
+		cur.Specs = prev.Specs
+	}
+	if cur.LocalImagePath == "" {
+		cur.LocalImagePath = prev.LocalImagePath
+	}
+	if cur.SKU == "" {
+		cur.SKU = prev.SKU
+	}
+	if cur.Brand == "" {
+		cur.Brand = prev.Brand
+	}
+	if cur.Manufacturer == "" {
+		cur.Manufacturer = prev.Manufacturer
+	}
+	if cur.Availability == "" {
+		cur.Availability = prev.Availability
+		cur.InStock = prev.InStock
+	}
+	if cur.AvailabilityText == "" {
+		cur.AvailabilityText = prev.AvailabilityText
+		cur.DeliveryTime = prev.DeliveryTime
+	}
+	if len(cur.Images) == 0 {
+		cur.Images = prev.Images
+	}
+	if len(cur.Gallery) == 0 {
+		cur.Gallery = prev.Gallery
+	}
+	if len(cur.Variants) == 0 {
+		cur.Variants = prev.Variants
+	}
+	if len(cur.CategoryPath) == 0 {
+		cur.CategoryPath = prev.CategoryPath
+	}
+	return cur
+}
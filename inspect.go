@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"strings"
@@ -13,37 +13,48 @@ import (
 // Эта программа используется для изучения HTML-структуры сайта
 // и настройки селекторов для парсера
 
-func inspectMain() {
+func inspectMain(ctx context.Context) {
 	// Исследуем структуру каталога
-	err := inspectCatalogPage()
+	err := inspectCatalogPage(ctx)
 	if err != nil {
-		log.Fatalf("Ошибка при исследовании каталога: %v", err)
+		fatal("Ошибка при исследовании каталога", "err", err)
 	}
 
 	fmt.Println("Исследование каталога завершено. Результаты сохранены в catalog_structure.txt")
 
 	// Исследуем страницу категории
-	err = inspectCategoryPage("https://www.stanki.ru/catalog/metalloobrabatyvayuschee_oborudovanie/")
+	err = inspectCategoryPage(ctx, "https://www.stanki.ru/catalog/metalloobrabatyvayuschee_oborudovanie/")
 	if err != nil {
-		log.Fatalf("Ошибка при исследовании категории: %v", err)
+		fatal("Ошибка при исследовании категории", "err", err)
 	}
 
 	fmt.Println("Исследование категории завершено. Результаты сохранены в category_structure.txt")
 }
 
-// inspectCatalogPage исследует структуру главной страницы каталога
-func inspectCatalogPage() error {
-	resp, err := http.Get("https://www.stanki.ru/catalog/")
+// inspectDocument загружает страницу для исследования так же, как при обходе: через прокси,
+// с заголовками браузера, с учетом robots.txt и задержек, и перекодирует ее в UTF-8.
+// what - что за страница, для сообщения об ошибке
+func inspectDocument(ctx context.Context, url, what string) (*goquery.Document, error) {
+	resp, err := doRequestWithRetry(ctx, url, 3, delay)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ошибка при получении страницы каталога: %d", resp.StatusCode)
+		return nil, fmt.Errorf("ошибка при получении страницы %s: %d", what, resp.StatusCode)
+	}
+
+	utf8Reader, err := responseUTF8Reader(resp)
+	if err != nil {
+		return nil, err
 	}
+	return goquery.NewDocumentFromReader(utf8Reader)
+}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+// inspectCatalogPage исследует структуру главной страницы каталога
+func inspectCatalogPage(ctx context.Context) error {
+	doc, err := inspectDocument(ctx, catalogURL, "каталога")
 	if err != nil {
 		return err
 	}
@@ -171,18 +182,8 @@ func inspectCatalogPage() error {
 }
 
 // inspectCategoryPage исследует структуру страницы категории
-func inspectCategoryPage(url string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ошибка при получении страницы категории: %d", resp.StatusCode)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+func inspectCategoryPage(ctx context.Context, url string) error {
+	doc, err := inspectDocument(ctx, url, "категории")
 	if err != nil {
 		return err
 	}
@@ -355,18 +356,8 @@ func inspectCategoryPage(url string) error {
 }
 
 // inspectProductPage исследует структуру страницы товара
-func inspectProductPage(url string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ошибка при получении страницы товара: %d", resp.StatusCode)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+func inspectProductPage(ctx context.Context, url string) error {
+	doc, err := inspectDocument(ctx, url, "товара")
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// siteLocale - языковая версия сайта ("en" для /en/); пустая строка означает основную версию
+var siteLocale string
+
+// catalogPath возвращает путь каталога с учетом языковой версии
+func catalogPath() string {
+	if siteLocale == "" {
+		return site.CatalogPath()
+	}
+	return "/" + siteLocale + site.CatalogPath()
+}
+
+// localizeURL переводит адрес каталога основной версии сайта в выбранную языковую версию.
+// ID товаров в разных версиях совпадают, меняется только префикс пути
+func localizeURL(rawURL string) string {
+	if siteLocale == "" {
+		return rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.HasPrefix(u.Path, site.CatalogPath()) {
+		return rawURL
+	}
+
+	u.Path = "/" + siteLocale + u.Path
+	return u.String()
+}
+
+// delocalizePath убирает из пути префикс языковой версии
+func delocalizePath(path string) string {
+	if siteLocale == "" {
+		return path
+	}
+	return strings.Replace(path, "/"+siteLocale+"/", "/", 1)
+}
+
+// probeLocale проверяет, что сайт действительно предоставляет языковую версию
+func probeLocale(ctx context.Context, locale string, delayMs int) error {
+	probeURL := baseURL + "/" + locale + site.CatalogPath()
+
+	resp, err := doRequestWithRetry(ctx, probeURL, 2, delayMs)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("страница %s вернула код %d", probeURL, resp.StatusCode)
+	}
+
+	// Несуществующая версия может перенаправлять на главную или на основной каталог
+	if !strings.HasPrefix(resp.Request.URL.Path, "/"+locale+"/") {
+		return fmt.Errorf("запрос %s перенаправлен на %s", probeURL, resp.Request.URL)
+	}
+
+	return nil
+}
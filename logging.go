@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// setupLogging настраивает журнал через log/slog: уровень (debug, info, warn, error),
+// формат (text или json) и файл, в который дописываются записи (по умолчанию stderr).
+// Возвращает функцию, закрывающую файл журнала
+func setupLogging(level, format, file string) (func(), error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("неизвестный уровень %q (допустимо: debug, info, warn, error)", level)
+	}
+
+	format = strings.ToLower(format)
+	if format != "text" && format != "json" {
+		return nil, fmt.Errorf("неизвестный формат %q (допустимо: text, json)", format)
+	}
+
+	var out io.Writer = os.Stderr
+	closeLog := func() {}
+	if file == "" && bars != nil {
+		// Записи журнала выводятся над индикаторами прогресса, не разрывая их
+		out = bars.LogWriter()
+	}
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+		closeLog = func() { f.Close() }
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	// Журнал systemd сам добавляет время, а уровень передается префиксом приоритета syslog
+	journald := file == "" && underJournald()
+	if journald {
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(out, opts)
+	} else {
+		handler = slog.NewTextHandler(out, opts)
+	}
+	if journald {
+		handler = newJournaldHandler(handler, out)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return closeLog, nil
+}
+
+// fatal записывает ошибку в журнал и завершает работу с кодом 1
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// journaldHandler добавляет перед каждой записью префикс приоритета syslog,
+// который journald использует для уровня записи
+type journaldHandler struct {
+	inner slog.Handler
+	out   io.Writer
+	mu    *sync.Mutex // общий для копий из WithAttrs/WithGroup: префикс и запись не должны перемешиваться
+}
+
+// newJournaldHandler оборачивает обработчик, пишущий в out
+func newJournaldHandler(inner slog.Handler, out io.Writer) *journaldHandler {
+	return &journaldHandler{inner: inner, out: out, mu: &sync.Mutex{}}
+}
+
+func (h *journaldHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *journaldHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := io.WriteString(h.out, journaldPriority(r.Level)); err != nil {
+		return err
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *journaldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &journaldHandler{inner: h.inner.WithAttrs(attrs), out: h.out, mu: h.mu}
+}
+
+func (h *journaldHandler) WithGroup(name string) slog.Handler {
+	return &journaldHandler{inner: h.inner.WithGroup(name), out: h.out, mu: h.mu}
+}
+
+// journaldPriority сопоставляет уровень slog приоритету syslog (см. sd-daemon(3))
+func journaldPriority(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "<3>"
+	case level >= slog.LevelWarn:
+		return "<4>"
+	case level >= slog.LevelInfo:
+		return "<6>"
+	default:
+		return "<7>"
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// bufferSizes - размеры внутренних буферов и пачек записи. Под ограничение памяти
+// (-gomemlimit или GOMEMLIMIT) они уменьшаются, чтобы в небольшом контейнере
+// память занимали не пачки записи, а страницы и товары
+type bufferSizes struct {
+	csvBatch     int  // Строк CSV, записываемых за один раз
+	zstdBatch    int  // Наибольшее число товаров в zstd-фрейме; -zstd-batch больше него уменьшается
+	zstdLowerMem bool // Кодировщик zstd экономит память ценой скорости
+}
+
+// buffers - размеры буферов запуска; задаются setupMemoryLimit
+var buffers = bufferSizes{csvBatch: 1000, zstdBatch: math.MaxInt}
+
+// setupMemoryLimit задает мягкое ограничение памяти среды выполнения и подбирает под него
+// размеры буферов. Пустое значение оставляет ограничение из GOMEMLIMIT, если оно есть:
+// так размеры буферов учитывают его, а не только сборщик мусора
+func setupMemoryLimit(value string) error {
+	limit := debug.SetMemoryLimit(-1) // Текущее значение, в том числе из GOMEMLIMIT
+	fromEnvironment := true
+
+	if value != "" {
+		parsed, err := parseMemoryLimit(value)
+		if err != nil {
+			return err
+		}
+		limit = parsed
+		fromEnvironment = false
+		debug.SetMemoryLimit(limit)
+	}
+
+	if limit == math.MaxInt64 {
+		return nil
+	}
+
+	buffers = bufferSizesFor(limit)
+	slog.Info("Ограничение памяти", "limit", formatBytes(limit), "from_env", fromEnvironment,
+		"csv_batch", buffers.csvBatch, "zstd_batch", buffers.zstdBatch, "zstd_lower_mem", buffers.zstdLowerMem)
+	return nil
+}
+
+// bufferSizesFor подбирает размеры буферов под ограничение памяти limit
+func bufferSizesFor(limit int64) bufferSizes {
+	const mib = 1 << 20
+
+	sizes := bufferSizes{csvBatch: 1000, zstdBatch: math.MaxInt}
+	switch {
+	case limit < 256*mib:
+		sizes.csvBatch = 100
+		sizes.zstdBatch = 100
+		sizes.zstdLowerMem = true
+	case limit < 1024*mib:
+		sizes.csvBatch = 500
+		sizes.zstdBatch = 500
+		sizes.zstdLowerMem = true
+	}
+	return sizes
+}
+
+// parseMemoryLimit разбирает значение в формате GOMEMLIMIT: число байт с необязательным
+// суффиксом B, KiB, MiB, GiB, TiB, например 512MiB. "off" снимает ограничение
+func parseMemoryLimit(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" {
+		return math.MaxInt64, nil
+	}
+
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1},
+	}
+
+	number, multiplier := value, int64(1)
+	for _, unit := range units {
+		if rest, found := strings.CutSuffix(value, unit.suffix); found {
+			number, multiplier = rest, unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("некорректное ограничение памяти %q, ожидается, например, 512MiB или 2GiB", value)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("ограничение памяти %q слишком велико", value)
+	}
+	return n * multiplier, nil
+}
+
+// formatBytes выводит размер в MiB или GiB
+func formatBytes(n int64) string {
+	if n >= 1<<30 && n%(1<<30) == 0 {
+		return fmt.Sprintf("%dGiB", n>>30)
+	}
+	return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Правила выбора записи при совпадении ID в команде merge
+const (
+	preferRecent   = "recent"   // Запись из более нового файла
+	preferComplete = "complete" // Запись с большим числом заполненных полей
+)
+
+// mergedRecord - запись товара и время запуска, в котором она получена
+type mergedRecord struct {
+	product Product
+	time    time.Time
+	fields  int
+}
+
+// runMerge объединяет выгрузки нескольких запусков (JSON, CSV, NDJSON) в одну без дубликатов
+func runMerge(args []string, xlsxLayout string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	output := fs.String("o", "merged.json", "Файл результата; формат по расширению: .json, .csv, .ndjson, .xlsx")
+	prefer := fs.String("prefer", preferRecent, "Какую запись оставить при совпадении ID: recent - из более нового запуска, complete - с большим числом заполненных полей")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: parserEol [флаги] merge [-o файл] [-prefer recent|complete] <файл> <файл>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("не указаны файлы для объединения")
+	}
+	if *prefer != preferRecent && *prefer != preferComplete {
+		return fmt.Errorf("неизвестное правило -prefer %q (допустимо: recent, complete)", *prefer)
+	}
+	save, err := mergeWriter(*output, xlsxLayout)
+	if err != nil {
+		return err
+	}
+
+	var order []string
+	records := make(map[string]mergedRecord)
+	replaced, total := 0, 0
+	for _, filename := range fs.Args() {
+		products, err := readProductsFile(filename)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		runTime := productsFileTime(filename)
+		fmt.Printf("%s: %d товаров, запуск %s\n", filename, len(products), runTime.Format("2006-01-02 15:04"))
+
+		for _, product := range products {
+			key := productIdentity(product)
+			if key == "" {
+				continue
+			}
+			total++
+
+			record := mergedRecord{product: product, time: runTime, fields: filledFields(product)}
+			current, exists := records[key]
+			if !exists {
+				order = append(order, key)
+				records[key] = record
+				continue
+			}
+			if record.betterThan(current, *prefer) {
+				records[key] = record
+				replaced++
+			}
+		}
+	}
+
+	merged := make([]Product, 0, len(order))
+	for _, key := range order {
+		merged = append(merged, records[key].product)
+	}
+	if err := save(merged); err != nil {
+		return err
+	}
+	fmt.Printf("Объединено %d записей из %d файлов: %d товаров, заменено при совпадении ID %d. Результаты сохранены в файл %s\n",
+		total, fs.NArg(), len(merged), replaced, *output)
+	return nil
+}
+
+// productIdentity - ключ, по которому сопоставляются записи одного товара из разных выгрузок:
+// ID, а без него - адрес, по которому товар только и можно опознать
+func productIdentity(product Product) string {
+	if product.ID != "" {
+		return product.ID
+	}
+	return product.URL
+}
+
+// betterThan сравнивает записи одного товара по правилу prefer; при равенстве решает второй признак,
+// а при полном равенстве остается прежняя запись
+func (r mergedRecord) betterThan(current mergedRecord, prefer string) bool {
+	if prefer == preferComplete {
+		if r.fields != current.fields {
+			return r.fields > current.fields
+		}
+		return r.time.After(current.time)
+	}
+	if !r.time.Equal(current.time) {
+		return r.time.After(current.time)
+	}
+	return r.fields > current.fields
+}
+
+// filledFields считает заполненные поля товара: непустые строки, списки и таблицы, истинные флаги
+func filledFields(product Product) int {
+	value := reflect.ValueOf(product)
+	filled := 0
+	for i := 0; i < value.NumField(); i++ {
+		if !value.Field(i).IsZero() {
+			filled++
+		}
+	}
+	return filled
+}
+
+// productsFileTime возвращает время запуска из сведений о запуске (<файл>.meta.json), а если
+// их нет - время изменения файла
+func productsFileTime(filename string) time.Time {
+	if data, err := os.ReadFile(filename + ".meta.json"); err == nil {
+		var meta runMetadata
+		if json.Unmarshal(data, &meta) == nil && !meta.StartedAt.IsZero() {
+			return meta.StartedAt
+		}
+	}
+	if info, err := os.Stat(filename); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// readProductsFile читает выгрузку по расширению: .json, .csv, .ndjson или .ndjson.zst
+func readProductsFile(filename string) ([]Product, error) {
+	switch {
+	case strings.HasSuffix(filename, ".json"):
+		return loadProductsJSON(filename)
+	case strings.HasSuffix(filename, ".csv"):
+		return readProductsCSV(filename)
+	case strings.HasSuffix(filename, ".ndjson"), strings.HasSuffix(filename, ".ndjson.zst"):
+		return readProductsNDJSON(filename)
+	default:
+		return nil, fmt.Errorf("неизвестный формат файла (допустимо: .json, .csv, .ndjson, .ndjson.zst)")
+	}
+}
+
+// readProductsNDJSON читает товары по одному на строке; файл .zst распаковывается
+func readProductsNDJSON(filename string) ([]Product, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(filename, ".zst") {
+		decoder, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		r = decoder
+	}
+
+	var products []Product
+	scanner := bufio.NewScanner(r)
+	// Строка - товар целиком, с описанием и характеристиками
+	scanner.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var product Product
+		if err := json.Unmarshal(data, &product); err != nil {
+			return nil, fmt.Errorf("строка %d: %v", line, err)
+		}
+		products = append(products, product)
+	}
+	return products, scanner.Err()
+}
+
+// csvFieldSetters заполняют поля товара по заголовкам CSV; разбираются колонки, из которых
+// поле восстанавливается без потерь. Подписи изображений и варианты в CSV сведены в текст
+// и не восстанавливаются
+var csvFieldSetters = map[string]func(*Product, string){
+	"ID":               func(p *Product, v string) { p.ID = v },
+	"Название":         func(p *Product, v string) { p.Name = v },
+	"URL":              func(p *Product, v string) { p.URL = v },
+	"Описание":         func(p *Product, v string) { p.Description = v },
+	"Цена":             func(p *Product, v string) { p.Price = v },
+	"URL изображения":  func(p *Product, v string) { p.ImageURL = v },
+	"Alt изображения":  func(p *Product, v string) { p.ImageAlt = v },
+	"Изображения":      func(p *Product, v string) { p.Images = splitNonEmpty(v, "|") },
+	"Категория":        func(p *Product, v string) { p.Category = v },
+	"Путь категории":   func(p *Product, v string) { p.CategoryPath = splitNonEmpty(v, " > ") },
+	"Характеристики":   func(p *Product, v string) { p.Features = splitNonEmpty(v, "|") },
+	"Артикул":          func(p *Product, v string) { p.SKU = v },
+	"Бренд":            func(p *Product, v string) { p.Brand = v },
+	"Производитель":    func(p *Product, v string) { p.Manufacturer = v },
+	"Наличие":          func(p *Product, v string) { p.Availability = v },
+	"Наличие на сайте": func(p *Product, v string) { p.AvailabilityText = v },
+	"Срок поставки":    func(p *Product, v string) { p.DeliveryTime = v },
+	"В наличии":        func(p *Product, v string) { p.InStock = v == "да" },
+	"Язык":             func(p *Product, v string) { p.Locale = v },
+	"Локальное изображение": func(p *Product, v string) { p.LocalImagePath = v },
+	"Noindex":             func(p *Product, v string) { p.NoIndex = v == "да" },
+	"Изменение":           func(p *Product, v string) { p.ChangeType = v },
+	"Известен ранее":      func(p *Product, v string) { p.SeenBefore = v == "да" },
+	"Впервые найден":      func(p *Product, v string) { p.FirstSeen = v },
+	"Подписи изображений": func(*Product, string) {},
+	"Варианты":            func(*Product, string) {},
+}
+
+// readProductsCSV читает CSV парсера (BOM необязателен, разделитель определяется по строке заголовков).
+// Колонки с незнакомыми заголовками -
+// характеристики, выбранные через -csv-columns specs.<название>
+func readProductsCSV(filename string) ([]Product, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if bom, err := r.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		r.Discard(3)
+	}
+	header, _ := r.Peek(r.Size())
+	reader := csv.NewReader(r)
+	reader.Comma = detectCSVDelimiter(header)
+	reader.FieldsPerRecord = -1
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	var products []Product
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var product Product
+		for i, value := range row {
+			if i >= len(headers) || value == "" {
+				continue
+			}
+			if set, ok := csvFieldSetters[headers[i]]; ok {
+				set(&product, value)
+				continue
+			}
+			if product.Specs == nil {
+				product.Specs = make(map[string]string)
+			}
+			product.Specs[headers[i]] = value
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+// splitNonEmpty разбивает строку, пропуская пустые части
+func splitNonEmpty(value, sep string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// mergeWriter выбирает запись результата по расширению файла
+func mergeWriter(filename, xlsxLayout string) (func([]Product) error, error) {
+	switch {
+	case strings.HasSuffix(filename, ".json"):
+		return func(products []Product) error { return saveToJSON(products, filename) }, nil
+	case strings.HasSuffix(filename, ".csv"):
+		return func(products []Product) error { return saveToCSV(products, filename) }, nil
+	case strings.HasSuffix(filename, ".xlsx"):
+		return func(products []Product) error { return saveToXLSX(products, filename, xlsxLayout) }, nil
+	case strings.HasSuffix(filename, ".ndjson"):
+		return func(products []Product) error {
+			w, err := newNDJSONWriter(filename)
+			if err != nil {
+				return err
+			}
+			for _, product := range products {
+				if err := w.WriteProduct(product); err != nil {
+					w.Close()
+					return err
+				}
+			}
+			return w.Close()
+		}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат файла результата %s (допустимо: .json, .csv, .ndjson, .xlsx)", filename)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// mongoBatch - документов в одной пачке BulkWrite
+const mongoBatch = 1000
+
+// openMongo подключается к MongoDB и возвращает коллекцию товаров. Вызывается до начала
+// парсинга, как и подключение к PostgreSQL, чтобы ошибка в адресе не обнаружилась в конце
+func openMongo(ctx context.Context, uri, database, collection string) (*mongo.Collection, error) {
+	client, err := mongo.Connect(options.Client().ApplyURI(uri).SetConnectTimeout(30 * time.Second))
+	if err != nil {
+		return nil, err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("не удалось подключиться к MongoDB: %v", err)
+	}
+	return client.Database(database).Collection(collection), nil
+}
+
+// mongoDocument преобразует товар в документ с теми же именами полей, что в JSON, и добавляет
+// _id (ID товара), run_id, scraped_at и цену числом price_value
+func mongoDocument(product Product, runID string, scrapedAt time.Time) (bson.M, error) {
+	data, err := json.Marshal(product)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	doc["_id"] = product.ID
+	doc["scraped_at"] = scrapedAt
+	if runID != "" {
+		doc["run_id"] = runID
+	}
+	if price, ok := parsePrice(product.Price); ok {
+		doc["price_value"] = price
+	}
+	return doc, nil
+}
+
+// saveToMongo записывает товары с заменой документа по ID (upsert): повторные запуски
+// обновляют документы, и коллекция содержит актуальный список товаров без дубликатов.
+// Возвращает число добавленных и обновленных документов
+func saveToMongo(ctx context.Context, coll *mongo.Collection, products []Product) (int, error) {
+	runID := ""
+	if runMeta != nil {
+		runID = runMeta.RunID
+	}
+	scrapedAt := time.Now().UTC()
+
+	written := 0
+	models := make([]mongo.WriteModel, 0, mongoBatch)
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		// Без упорядочивания ошибка в одном документе не останавливает запись остальных
+		result, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if result != nil {
+			written += int(result.UpsertedCount + result.MatchedCount)
+		}
+		models = models[:0]
+		return err
+	}
+
+	for _, product := range products {
+		doc, err := mongoDocument(product, runID, scrapedAt)
+		if err != nil {
+			return written, err
+		}
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: product.ID}}).
+			SetReplacement(doc).
+			SetUpsert(true))
+		if len(models) >= mongoBatch {
+			if err := flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, flush()
+}
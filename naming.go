@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultOutputName - шаблон имени файлов результатов по умолчанию
+const defaultOutputName = "products"
+
+// outputVars - переменные, доступные в шаблоне -out-name
+type outputVars struct {
+	Date     string // Дата запуска, 2006-01-02
+	Time     string // Время запуска, 150405
+	DateTime string // Дата и время запуска, 20060102-150405
+	Site     string // Домен сайта без www
+	Locale   string // Языковая версия сайта (-locale), пусто для основной
+	Format   string // Формат файла: json, csv, xlsx, ndjson, ndjson.zst
+	Ext      string // Расширение с точкой: .json, .csv и т.д.
+	Shard    string // Номер части при -shards ("03"), пусто для файла без разбиения
+}
+
+// shortPlaceholders - краткая запись переменных шаблона: products_{date} вместо products_{{.Date}}
+var shortPlaceholders = strings.NewReplacer(
+	"{date}", "{{.Date}}",
+	"{time}", "{{.Time}}",
+	"{datetime}", "{{.DateTime}}",
+	"{site}", "{{.Site}}",
+	"{locale}", "{{.Locale}}",
+	"{format}", "{{.Format}}",
+	"{ext}", "{{.Ext}}",
+	"{shard}", "{{.Shard}}",
+)
+
+// outputNamer строит имена файлов результатов по шаблону, вычисленному один раз на запуск:
+// все файлы одного запуска получают одинаковые дату и время
+type outputNamer struct {
+	tmpl      *template.Template
+	dir       string // Каталог результатов (-out-dir) с подставленными переменными
+	output    string // Файл результатов единственного формата (-o) или "-" для stdout
+	vars      outputVars
+	withExt   bool // Шаблон сам задает расширение через .Ext или .Format
+	withShard bool // Шаблон сам задает номер части через .Shard
+}
+
+// newOutputNamer разбирает шаблон вида "products_{{.Date}}_{{.Site}}" (или "products_{date}_{site}"),
+// к которому спереди добавляется prefix, а файлы помещаются в каталог dir. Префикс и каталог
+// тоже могут содержать переменные. Если шаблон не содержит .Ext или .Format, расширение добавляется автоматически
+func newOutputNamer(dir, prefix, pattern string, start time.Time) (*outputNamer, error) {
+	pattern = shortPlaceholders.Replace(prefix + pattern)
+	tmpl, err := template.New("out-name").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	site := baseURL
+	if u, err := url.Parse(baseURL); err == nil {
+		site = strings.TrimPrefix(u.Hostname(), "www.")
+	}
+
+	n := &outputNamer{
+		tmpl: tmpl,
+		vars: outputVars{
+			Date:     start.Format("2006-01-02"),
+			Time:     start.Format("150405"),
+			DateTime: start.Format("20060102-150405"),
+			Site:     site,
+			Locale:   siteLocale,
+		},
+		withExt:   strings.Contains(pattern, ".Ext") || strings.Contains(pattern, ".Format"),
+		withShard: strings.Contains(pattern, ".Shard"),
+	}
+
+	// Каталог вычисляется сразу: в его имени не бывает формата и номера части
+	if dir != "" {
+		if n.dir, err = n.Expand(dir); err != nil {
+			return nil, fmt.Errorf("каталог: %v", err)
+		}
+	}
+
+	// Проверяем шаблон сразу, чтобы ошибка не обнаружилась только при сохранении результатов
+	name, err := n.name("json", "")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(strings.TrimSuffix(filepath.Base(name), ".json")) == "" {
+		return nil, fmt.Errorf("шаблон дает пустое имя файла")
+	}
+
+	return n, nil
+}
+
+// Expand подставляет в строку переменные запуска (дату, время, сайт, языковую версию),
+// например для каталога результатов или префикса ключей в хранилище
+func (n *outputNamer) Expand(pattern string) (string, error) {
+	tmpl, err := template.New("expand").Option("missingkey=error").Parse(shortPlaceholders.Replace(pattern))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, n.vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Dir возвращает каталог результатов; пусто - текущий каталог
+func (n *outputNamer) Dir() string {
+	return n.dir
+}
+
+// SetOutput задает файл результатов вместо имени по шаблону (-o). Частичные результаты
+// прерванного запуска и связи товаров с предложениями по-прежнему сохраняются в файлы по шаблону
+func (n *outputNamer) SetOutput(output string) {
+	n.output = output
+}
+
+// Name возвращает имя файла для формата (json, csv, xlsx, ndjson, ndjson.zst, partial.json, relations.csv)
+func (n *outputNamer) Name(format string) string {
+	if n.output != "" && format != "partial.json" && format != "relations.csv" {
+		return n.output
+	}
+	name, err := n.name(format, "")
+	if err != nil {
+		// Шаблон уже проверен в newOutputNamer, сюда попадать не должны
+		return filepath.Join(n.dir, defaultOutputName+"."+format)
+	}
+	return name
+}
+
+// ShardNames возвращает имена файлов формата для каждой из shards частей.
+// Если шаблон не содержит .Shard, номер части добавляется перед расширением: products-03.csv.
+// При shards <= 1 возвращается единственное имя без номера
+func (n *outputNamer) ShardNames(format string, shards int) []string {
+	if shards <= 1 {
+		return []string{n.Name(format)}
+	}
+
+	width := max(2, len(fmt.Sprint(shards-1)))
+	names := make([]string, shards)
+	for i := range names {
+		shard := fmt.Sprintf("%0*d", width, i)
+		name, err := n.name(format, shard)
+		if err != nil {
+			name = filepath.Join(n.dir, defaultOutputName+"-"+shard+"."+format)
+		}
+		names[i] = name
+	}
+	return names
+}
+
+func (n *outputNamer) name(format, shard string) (string, error) {
+	vars := n.vars
+	vars.Format = format
+	vars.Ext = "." + format
+	vars.Shard = shard
+
+	var b strings.Builder
+	if err := n.tmpl.Execute(&b, vars); err != nil {
+		return "", err
+	}
+
+	name := b.String()
+	if shard != "" && !n.withShard {
+		if n.withExt {
+			// Номер части ставим перед расширением, если шаблон закончил им имя
+			if base, found := strings.CutSuffix(name, vars.Ext); found {
+				return base + "-" + shard + vars.Ext, nil
+			}
+		}
+		name += "-" + shard
+	}
+	if !n.withExt {
+		name += vars.Ext
+	}
+	return filepath.Join(n.dir, name), nil
+}
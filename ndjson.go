@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// productSink принимает товары по одному, по мере их готовности,
+// в отличие от saveToJSON/saveToCSV, которые записывают весь результат в конце
+type productSink interface {
+	WriteProduct(product Product) error
+	Close() error
+}
+
+// ndjsonWriter записывает товары в формате JSON Lines (одна запись на строку)
+// и сбрасывает каждую запись на диск сразу, так что файл можно читать во время работы парсера
+type ndjsonWriter struct {
+	mu      sync.Mutex
+	file    io.WriteCloser
+	buf     *bufio.Writer
+	encoder *json.Encoder
+	seen    map[string]bool // ключи дедупликации уже записанных товаров
+}
+
+// newNDJSONWriter создает файл для потоковой записи товаров.
+// BOM не пишется: его не понимают jq и большинство инструментов для JSON Lines
+func newNDJSONWriter(filename string) (*ndjsonWriter, error) {
+	file, err := createResultFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bufio.NewWriter(file)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+
+	return &ndjsonWriter{
+		file:    file,
+		buf:     buf,
+		encoder: encoder,
+		seen:    make(map[string]bool),
+	}, nil
+}
+
+// WriteProduct записывает товар отдельной строкой.
+// Дубликаты по ключу dedupeBy и неидентифицированные товары пропускаются так же, как в removeDuplicateProducts
+func (w *ndjsonWriter) WriteProduct(product Product) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := dedupeBy.Key(product)
+	if key == "" || w.seen[key] {
+		return nil
+	}
+	w.seen[key] = true
+
+	if err := w.encoder.Encode(product); err != nil {
+		return err
+	}
+
+	return w.buf.Flush()
+}
+
+// Close дописывает буфер и закрывает файл
+func (w *ndjsonWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdNDJSONWriter записывает товары в формате JSON Lines со сжатием zstd.
+// Каждая пачка записей сжимается в отдельный законченный zstd-фрейм, поэтому
+// файл прерванного запуска остается читаемым: теряется только последняя незаписанная пачка
+type zstdNDJSONWriter struct {
+	mu        sync.Mutex
+	file      io.WriteCloser
+	zstdEnc   *zstd.Encoder
+	batch     bytes.Buffer
+	encoder   *json.Encoder
+	batchSize int
+	pending   int             // Количество записей в текущей пачке
+	seen      map[string]bool // ключи дедупликации уже записанных товаров
+}
+
+// newZstdNDJSONWriter создает файл .ndjson.zst, сбрасывающий данные каждые batchSize записей.
+// При ограничении памяти пачки не превышают buffers.zstdBatch
+func newZstdNDJSONWriter(filename string, batchSize int) (*zstdNDJSONWriter, error) {
+	if batchSize > buffers.zstdBatch {
+		slog.Info("Размер пачки zstd уменьшен под ограничение памяти", "zstd_batch", buffers.zstdBatch)
+		batchSize = buffers.zstdBatch
+	}
+
+	zstdEnc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression), zstd.WithLowerEncoderMem(buffers.zstdLowerMem))
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := createResultFile(filename)
+	if err != nil {
+		zstdEnc.Close()
+		return nil, err
+	}
+
+	w := &zstdNDJSONWriter{
+		file:      file,
+		zstdEnc:   zstdEnc,
+		batchSize: max(1, batchSize),
+		seen:      make(map[string]bool),
+	}
+	w.encoder = json.NewEncoder(&w.batch)
+	w.encoder.SetEscapeHTML(false)
+
+	return w, nil
+}
+
+// WriteProduct добавляет товар в текущую пачку и сбрасывает ее, когда она заполнена.
+// Дубликаты по ключу dedupeBy и неидентифицированные товары пропускаются
+func (w *zstdNDJSONWriter) WriteProduct(product Product) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := dedupeBy.Key(product)
+	if key == "" || w.seen[key] {
+		return nil
+	}
+	w.seen[key] = true
+
+	if err := w.encoder.Encode(product); err != nil {
+		return err
+	}
+	w.pending++
+
+	if w.pending >= w.batchSize {
+		return w.flushBatch()
+	}
+
+	return nil
+}
+
+// flushBatch сжимает накопленную пачку в отдельный фрейм и дописывает его в файл
+func (w *zstdNDJSONWriter) flushBatch() error {
+	if w.pending == 0 {
+		return nil
+	}
+
+	frame := w.zstdEnc.EncodeAll(w.batch.Bytes(), nil)
+	if _, err := w.file.Write(frame); err != nil {
+		return err
+	}
+
+	w.batch.Reset()
+	w.pending = 0
+
+	return nil
+}
+
+// Close записывает последнюю пачку и закрывает файл
+func (w *zstdNDJSONWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.flushBatch()
+	w.zstdEnc.Close()
+
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// skipNoIndex включает пропуск категорий и товаров, страницы которых запрещены к индексации (-skip-noindex).
+// Без него такие товары сохраняются с полем noindex
+var skipNoIndex bool
+
+// robotsValueDirectives - директивы X-Robots-Tag, у которых есть значение через двоеточие.
+// По ним значение "max-snippet: 50" отличается от указания робота "googlebot: noindex"
+var robotsValueDirectives = map[string]bool{
+	"unavailable_after": true,
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+}
+
+// pageNoIndex проверяет, запрещает ли страница индексацию: метатег robots (или метатег
+// с именем парсера) либо заголовок X-Robots-Tag с директивой noindex или none.
+// Указания для других роботов (googlebot, yandex) не учитываются
+func pageNoIndex(doc *goquery.Document, header http.Header) bool {
+	noindex := false
+
+	doc.Find("meta[name][content]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		name := strings.ToLower(strings.TrimSpace(s.AttrOr("name", "")))
+		if name != "robots" && name != strings.ToLower(robotsAgent) {
+			return true
+		}
+		noindex = robotsDirectivesNoIndex(s.AttrOr("content", ""))
+		return !noindex
+	})
+	if noindex {
+		return true
+	}
+
+	for _, value := range header.Values("X-Robots-Tag") {
+		directives := value
+		if name, rest, found := strings.Cut(value, ":"); found {
+			agent := strings.ToLower(strings.TrimSpace(name))
+			if !strings.Contains(agent, ",") && !robotsValueDirectives[agent] {
+				if agent != strings.ToLower(robotsAgent) {
+					continue
+				}
+				directives = rest
+			}
+		}
+		if robotsDirectivesNoIndex(directives) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// robotsDirectivesNoIndex проверяет список директив вида "noindex, follow"
+func robotsDirectivesNoIndex(value string) bool {
+	for _, directive := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex", "none":
+			return true
+		}
+	}
+	return false
+}
+
+// dropNoIndexProducts убирает товары, страницы которых запрещены к индексации
+func dropNoIndexProducts(products []Product) []Product {
+	kept := products[:0]
+	for _, product := range products {
+		if !product.NoIndex {
+			kept = append(kept, product)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Политики -notify-on
+const (
+	notifyAlways = "always" // Отчет после каждого запуска
+	notifyChange = "change" // Только если есть изменения или ошибки
+	notifyError  = "error"  // Только при ошибках и прерывании
+)
+
+// notifier - настройки отчета о запуске; nil означает, что отчет не отправляется
+var notifier *runNotifier
+
+// runNotifier отправляет отчет о запуске командой -notify-cmd и/или записывает его в -notify-file,
+// если запуск подходит под политику. При запуске по cron это позволяет не присылать
+// ежедневные письма "ничего не изменилось", к которым быстро привыкают и перестают читать
+type runNotifier struct {
+	policy  string
+	command string
+	file    string
+}
+
+// newRunNotifier проверяет политику; без команды и файла отчет не нужен и возвращается nil
+func newRunNotifier(policy, command, file string) (*runNotifier, error) {
+	switch policy {
+	case notifyAlways, notifyChange, notifyError:
+	default:
+		return nil, fmt.Errorf("неизвестная политика %q (допустимо: change, error, always)", policy)
+	}
+	if command == "" && file == "" {
+		return nil, nil
+	}
+	return &runNotifier{policy: policy, command: command, file: file}, nil
+}
+
+// runOutcome - итог запуска для отчета
+type runOutcome struct {
+	Products    int
+	Changed     int   // Новые и измененные товары в режиме -incremental
+	Removed     int   // Пропавшие товары в режиме -incremental
+	PriceShifts int   // Категории со сдвигом медианы цены относительно истории
+	Interrupted error // Причина прерывания; nil, если запуск завершен
+}
+
+// changed - в каталоге есть изменения, о которых стоит сообщить
+func (o runOutcome) changed() bool {
+	return o.Changed > 0 || o.Removed > 0 || o.PriceShifts > 0
+}
+
+// Notify формирует отчет и отправляет его, если запуск подходит под политику.
+// Возвращает причину отправки или пустую строку, если отчет не отправлялся
+func (n *runNotifier) Notify(outcome runOutcome) string {
+	if n == nil {
+		return ""
+	}
+
+	// Повторенные запросы ошибкой запуска не считаются: важны только потерянные категории и товары
+	errorCount := status.ErrorCount("категории", "товары")
+	failed := outcome.Interrupted != nil || errorCount > 0
+
+	var reason string
+	switch {
+	case failed:
+		reason = "error"
+	case outcome.changed():
+		reason = "change"
+	case n.policy == notifyAlways:
+		reason = "always"
+	}
+	if reason == "" || (n.policy == notifyError && reason != "error") {
+		slog.Info("Отчет о запуске не отправляется: нет изменений и ошибок", "notify_on", n.policy)
+		return ""
+	}
+
+	report := outcome.report(errorCount)
+
+	if n.file != "" {
+		if err := os.WriteFile(n.file, []byte(report), 0o644); err != nil {
+			slog.Error("Не удалось записать отчет о запуске", "file", n.file, "err", err)
+		} else {
+			fmt.Printf("Отчет о запуске сохранен в файл %s\n", n.file)
+		}
+	}
+
+	if n.command != "" {
+		// Команда не должна задерживать завершение запуска надолго
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", n.command)
+		cmd.Stdin = strings.NewReader(report)
+		cmd.Env = append(os.Environ(), "PARSER_NOTIFY_REASON="+reason)
+		if runMeta != nil {
+			cmd.Env = append(cmd.Env, "PARSER_RUN_ID="+runMeta.RunID)
+		}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			slog.Error("Ошибка команды -notify-cmd", "err", err, "stderr", strings.TrimSpace(stderr.String()))
+		} else {
+			slog.Info("Отчет о запуске отправлен", "reason", reason)
+		}
+	}
+
+	return reason
+}
+
+// report возвращает текст отчета о запуске
+func (o runOutcome) report(errorCount int) string {
+	var b strings.Builder
+
+	if runMeta != nil {
+		fmt.Fprintf(&b, "Запуск %s, сайт %s, версия %s\n", runMeta.RunID, runMeta.Site, runMeta.Version)
+		fmt.Fprintf(&b, "Начало: %s, длительность %v\n", runMeta.StartedAt.Format("2006-01-02 15:04:05"), time.Since(runMeta.StartedAt).Round(time.Second))
+	}
+
+	if o.Interrupted != nil {
+		fmt.Fprintf(&b, "Запуск прерван: %v\n", o.Interrupted)
+	} else {
+		b.WriteString("Запуск завершен\n")
+	}
+
+	fmt.Fprintf(&b, "Товаров: %d\n", o.Products)
+	if o.Changed > 0 || o.Removed > 0 {
+		fmt.Fprintf(&b, "Изменения: новых и измененных %d, пропавших %d\n", o.Changed, o.Removed)
+	}
+	if o.PriceShifts > 0 {
+		fmt.Fprintf(&b, "Сдвиг медианы цены: %d категорий\n", o.PriceShifts)
+	}
+
+	if errorCount > 0 {
+		fmt.Fprintf(&b, "Ошибок: %d (%s)\n", errorCount, status.ErrorSummary())
+	}
+
+	return b.String()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// localFileTransport отвечает на запросы сохраненными страницами: адреса file:// читаются
+// с диска всегда, а адреса сайта - из каталога -input-dir, если он задан. Остальные запросы
+// передаются следующему транспорту
+type localFileTransport struct {
+	dir  string // Каталог сохраненных страниц; пусто - обычная загрузка с сайта
+	next http.RoundTripper
+}
+
+// newLocalFileTransport создает транспорт поверх next; dir - каталог -input-dir
+func newLocalFileTransport(next http.RoundTripper, dir string) *localFileTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &localFileTransport{dir: dir, next: next}
+}
+
+func (t *localFileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "file" {
+		return localFileResponse(req, []string{filepath.FromSlash(req.URL.Path)})
+	}
+	if t.dir == "" {
+		return t.next.RoundTrip(req)
+	}
+	return localFileResponse(req, offlineFileCandidates(t.dir, req.URL.Host, req.URL.Path, req.URL.RawQuery))
+}
+
+// offlineFileCandidates перечисляет файлы, в которых может лежать страница сайта. Раскладка
+// совпадает с wget --mirror: <каталог>/<хост>/<путь>, страница раздела - index.html, параметры
+// запроса - в имени файла после "?" (или "@" при --restrict-file-names=windows), к имени может
+// быть добавлено .html (--adjust-extension). Каталог без подкаталога хоста (wget -nH) тоже подходит
+func offlineFileCandidates(dir, host, urlPath, query string) []string {
+	name := path.Clean("/" + urlPath)
+	bases := []string{path.Join(name, "index.html")}
+	if !strings.HasSuffix(urlPath, "/") && name != "/" {
+		bases = []string{name, path.Join(name, "index.html")}
+	}
+
+	var names []string
+	for _, base := range bases {
+		if query != "" {
+			names = append(names, base+"?"+query, base+"@"+query)
+		} else {
+			names = append(names, base)
+		}
+	}
+
+	var candidates []string
+	for _, root := range []string{filepath.Join(dir, host), dir} {
+		for _, name := range names {
+			file := filepath.Join(root, filepath.FromSlash(name))
+			candidates = append(candidates, file)
+			if !strings.HasSuffix(name, ".html") {
+				candidates = append(candidates, file+".html")
+			}
+		}
+	}
+	return candidates
+}
+
+// localFileResponse возвращает первый существующий файл из candidates как ответ 200,
+// а если ни одного нет - ответ 404, как у сайта на отсутствующую страницу
+func localFileResponse(req *http.Request, candidates []string) (*http.Response, error) {
+	for _, file := range candidates {
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(file))
+		if contentType == "" || strings.Contains(file, "?") || strings.Contains(file, "@") {
+			contentType = http.DetectContentType(data)
+		}
+		// Кодировка сохраненной страницы определяется по содержимому и meta, а не по charset типа файла
+		contentType, _, _ = strings.Cut(contentType, ";")
+		slog.Debug("Страница прочитана из файла", "url", req.URL.String(), "file", file)
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {contentType}},
+			Body:          io.NopCloser(bytes.NewReader(data)),
+			ContentLength: int64(len(data)),
+			Request:       req,
+		}, nil
+	}
+
+	slog.Debug("Сохраненной страницы нет", "url", req.URL.String(), "files", candidates)
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)),
+		StatusCode: http.StatusNotFound,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
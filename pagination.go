@@ -0,0 +1,333 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Pagination - способ перехода по страницам списка товаров категории. Адаптер определяет его
+// по первой загруженной странице (SiteAdapter.Pagination), и дальше категория обходится им
+type Pagination interface {
+	// PageURL возвращает адрес страницы page списка товаров категории (страницы нумеруются с 1)
+	PageURL(categoryURL string, page int) string
+	// PageNumber возвращает номер страницы из ссылки; false - ссылка не ведет на страницу списка
+	PageNumber(href string) (int, bool)
+	// PageHeader возвращает дополнительные заголовки запроса страницы page; nil - обычный запрос
+	PageHeader(categoryURL string, page int) http.Header
+	// String описывает способ для журнала
+	String() string
+}
+
+// bitrixPagination - пагинация Bitrix параметром PAGEN_<номер компонента на странице>.
+// Номер зависит от того, сколько компонентов с постраничной навигацией выведено на странице
+// раньше списка товаров, поэтому у разных категорий одного сайта он может отличаться
+type bitrixPagination struct {
+	param string // Например PAGEN_2
+}
+
+// bitrixPageParamRe находит параметр страницы Bitrix в адресе: PAGEN_<компонент>=<страница>
+var bitrixPageParamRe = regexp.MustCompile(`[?&](PAGEN_\d+)=\d+`)
+
+// bitrixNavNumRe находит номер компонента в параметрах подгрузки Bitrix: "NavNum":2 или NavNum = '2'
+var bitrixNavNumRe = regexp.MustCompile(`NavNum["']?\s*[:=]\s*["']?(\d+)`)
+
+// PageURL добавляет к адресу категории параметр страницы; первая страница - адрес категории
+func (p bitrixPagination) PageURL(categoryURL string, page int) string {
+	if page <= 1 {
+		return categoryURL
+	}
+	if strings.Contains(categoryURL, "?") {
+		return categoryURL + "&" + p.param + "=" + strconv.Itoa(page)
+	}
+	return categoryURL + "?" + p.param + "=" + strconv.Itoa(page)
+}
+
+// PageNumber читает номер страницы из параметра пагинации ссылки. Параметры других
+// компонентов (PAGEN_1 блока отзывов при пагинации списка по PAGEN_2) не учитываются
+func (p bitrixPagination) PageNumber(href string) (int, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(u.Query().Get(p.param))
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// PageHeader - страницы загружаются обычными запросами
+func (p bitrixPagination) PageHeader(string, int) http.Header { return nil }
+
+func (p bitrixPagination) String() string { return p.param }
+
+// bitrixAjaxPagination - загрузка страниц через AJAX-адрес компонента Bitrix: по адресу с PAGEN_N
+// и bxajaxid сервер отдает только фрагмент компонента - карточки товаров и навигацию, без шапки,
+// меню и подвала страницы. Так листаются категории с кнопкой «Показать ещё», у которых ссылок
+// на страницы нет, а у категорий со ссылками фрагменты в разы меньше полных страниц
+type bitrixAjaxPagination struct {
+	bitrixPagination
+	ajaxID    string // Идентификатор компонента bxajaxid
+	pageLinks bool   // Есть обычные ссылки на страницы: без подгрузки категорию можно дочитать ими
+}
+
+// bitrixAjaxIDRe находит идентификатор компонента в адресе или параметрах подгрузки Bitrix:
+// bxajaxid=abc123, "bxajaxid":"abc123" или bxajaxid: 'abc123'
+var bitrixAjaxIDRe = regexp.MustCompile(`bxajaxid["']?\s*[:=]\s*["']?(\w+)`)
+
+// PageURL добавляет к адресу страницы bxajaxid, по которому Bitrix отдает только фрагмент компонента
+func (p bitrixAjaxPagination) PageURL(categoryURL string, page int) string {
+	if page <= 1 {
+		return categoryURL
+	}
+	return p.bitrixPagination.PageURL(categoryURL, page) + "&bxajaxid=" + url.QueryEscape(p.ajaxID)
+}
+
+// PageHeader возвращает заголовки, с которыми запрос отправляет скрипт подгрузки: без них
+// Bitrix отдает полную страницу, обычно первую. Страница категории служит Referer
+func (p bitrixAjaxPagination) PageHeader(categoryURL string, page int) http.Header {
+	if page <= 1 {
+		return nil
+	}
+	return http.Header{
+		"X-Requested-With": {"XMLHttpRequest"},
+		"Bx-Ajax":          {"true"},
+		"Referer":          {categoryURL},
+	}
+}
+
+func (p bitrixAjaxPagination) String() string {
+	return p.param + ", подгрузка bxajaxid=" + p.ajaxID
+}
+
+// detectBitrixPagination определяет параметр пагинации по странице списка. Ссылки внутри блока
+// пагинации важнее остальных ссылок страницы и адресов кнопки «Показать ещё»; из нескольких
+// параметров выбирается тот, у которого больше ссылок. Без ссылок номер компонента берется из
+// NavNum скриптов Bitrix, а если его нет - используется параметр fallback
+func detectBitrixPagination(doc *goquery.Document, fallback string) bitrixPagination {
+	var paginationLinks, otherLinks []string
+	doc.Find(markup.Pagination).Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		paginationLinks = append(paginationLinks, href)
+	})
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		otherLinks = append(otherLinks, href)
+	})
+	doc.Find(markup.NextPage).Each(func(_ int, s *goquery.Selection) {
+		for _, attr := range s.Nodes[0].Attr {
+			otherLinks = append(otherLinks, attr.Val)
+		}
+	})
+
+	for _, links := range [][]string{paginationLinks, otherLinks} {
+		counts := make(map[string]int)
+		for _, href := range links {
+			for _, match := range bitrixPageParamRe.FindAllStringSubmatch(href, -1) {
+				counts[match[1]]++
+			}
+		}
+		if len(counts) == 0 {
+			continue
+		}
+
+		params := make([]string, 0, len(counts))
+		for param := range counts {
+			params = append(params, param)
+		}
+		// При равном числе ссылок выбор не должен зависеть от порядка обхода карты
+		slices.SortFunc(params, func(a, b string) int {
+			return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+		})
+		return bitrixPagination{param: params[0]}
+	}
+
+	param := ""
+	doc.Find("script").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if match := bitrixNavNumRe.FindStringSubmatch(s.Text()); match != nil {
+			param = fmt.Sprintf("PAGEN_%s", match[1])
+			return false
+		}
+		return true
+	})
+	if param == "" {
+		param = fallback
+	}
+	return bitrixPagination{param: param}
+}
+
+// detectBitrixAjaxPagination ищет идентификатор компонента bxajaxid списка товаров: в адресах
+// подгрузки ссылок пагинации и кнопки «Показать ещё» (markup.NextPage), затем в id контейнера
+// компонента comp_<bxajaxid> с карточками товаров. Скрипты подгрузки проверяются, только если
+// ссылок на страницы нет: в них может быть идентификатор другого компонента страницы
+func detectBitrixAjaxPagination(doc *goquery.Document, pager bitrixPagination) (bitrixAjaxPagination, bool) {
+	ajax := bitrixAjaxPagination{bitrixPagination: pager}
+	doc.Find("a[href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		href, _ := s.Attr("href")
+		ajax.pageLinks = isPageLink(pager, href)
+		return !ajax.pageLinks
+	})
+
+	// В режиме AJAX Bitrix выводит адрес подгрузки в onclick ссылок или в data-атрибутах кнопки
+	doc.Find(markup.Pagination).Find("a").
+		AddSelection(doc.Find(markup.NextPage + ", a[href*='bxajaxid']")).
+		EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			for _, attr := range s.Nodes[0].Attr {
+				if match := bitrixAjaxIDRe.FindStringSubmatch(attr.Val); match != nil {
+					ajax.ajaxID = match[1]
+					return false
+				}
+			}
+			return true
+		})
+
+	// Контейнеры компонентов бывают вложенными: нужен самый внутренний, с карточками товаров
+	if ajax.ajaxID == "" {
+		doc.Find("[id^='comp_']").Each(func(_ int, s *goquery.Selection) {
+			id := strings.TrimPrefix(s.AttrOr("id", ""), "comp_")
+			if id != "" && s.Find(markup.ProductCard).Length() > 0 {
+				ajax.ajaxID = id
+			}
+		})
+	}
+
+	if ajax.ajaxID == "" && !ajax.pageLinks {
+		doc.Find("script").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			if match := bitrixAjaxIDRe.FindStringSubmatch(s.Text()); match != nil {
+				ajax.ajaxID = match[1]
+				return false
+			}
+			return true
+		})
+	}
+	return ajax, ajax.ajaxID != ""
+}
+
+// Fallback возвращает обычную пагинацию, если у категории есть ссылки на страницы
+func (p bitrixAjaxPagination) Fallback() (Pagination, bool) {
+	return p.bitrixPagination, p.pageLinks
+}
+
+// fallbackPagination - способ пагинации с запасным способом, которым категория дочитывается,
+// если сервер не отдал страницу первым способом
+type fallbackPagination interface {
+	Fallback() (Pagination, bool)
+}
+
+// isPageLink проверяет, что ссылка ведет на страницу списка при способе пагинации p
+func isPageLink(p Pagination, href string) bool {
+	_, ok := p.PageNumber(href)
+	return ok
+}
+
+// listing - вид списков товаров: крупные страницы (-full-listings) и постоянные параметры адреса
+var listing listingSettings
+
+// listingSettings - параметры вида списка товаров категории
+type listingSettings struct {
+	Full     bool   // Запрашивать «Все» или наибольшее число товаров на странице, если сайт это позволяет
+	MaxItems int    // Больше товаров на одной странице не запрашивается
+	Params   string // Параметры, добавляемые к каждому адресу списка, например сортировка
+}
+
+// newListingSettings проверяет флаги -full-listings, -listing-max-items и -listing-params
+func newListingSettings(full bool, maxItems int, params string) (listingSettings, error) {
+	if maxItems < 1 {
+		return listingSettings{}, fmt.Errorf("-listing-max-items должен быть положительным")
+	}
+	params = strings.TrimLeft(params, "?&")
+	if _, err := url.ParseQuery(params); err != nil {
+		return listingSettings{}, fmt.Errorf("-listing-params: %v", err)
+	}
+	return listingSettings{Full: full, MaxItems: maxItems, Params: params}, nil
+}
+
+// listingPagination добавляет к адресам всех страниц списка параметры вида: число товаров
+// на странице, «Все», сортировку. Номер страницы и подгрузку задает вложенный способ пагинации
+type listingPagination struct {
+	Pagination
+	query string // Например SIZEN_2=100 или sort=id&order=asc
+}
+
+// withListingParams возвращает способ пагинации p с параметрами вида query; пустой query - p без изменений
+func withListingParams(p Pagination, query string) Pagination {
+	if query == "" {
+		return p
+	}
+	return listingPagination{Pagination: p, query: query}
+}
+
+func (p listingPagination) PageURL(categoryURL string, page int) string {
+	separator := "?"
+	if strings.Contains(categoryURL, "?") {
+		separator = "&"
+	}
+	return p.Pagination.PageURL(categoryURL+separator+p.query, page)
+}
+
+func (p listingPagination) String() string {
+	return p.Pagination.String() + ", " + p.query
+}
+
+// Fallback сохраняет параметры вида и для запасного способа пагинации
+func (p listingPagination) Fallback() (Pagination, bool) {
+	if fallback, ok := p.Pagination.(fallbackPagination); ok {
+		if plain, ok := fallback.Fallback(); ok {
+			return listingPagination{Pagination: plain, query: p.query}, true
+		}
+	}
+	return nil, false
+}
+
+// bitrixPageSizeParams - параметры числа товаров на странице: SIZEN_K - штатный параметр
+// постраничной навигации Bitrix, остальные встречаются в шаблонах каталогов
+var bitrixPageSizeParams = []string{"count", "PAGE_ELEMENT_COUNT", "page_size", "pagesize", "per_page", "perpage", "onpage", "limit"}
+
+// detectBitrixListingSize ищет в ссылках страницы вид списка крупнее текущего (shown товаров):
+// ссылку «Все» (SHOWALL_K=1), если в категории не больше maxItems товаров (total - оценка их числа),
+// иначе - наибольшее число товаров на странице не больше maxItems. Возвращает параметры выбранной
+// ссылки без номера страницы и bxajaxid, поэтому сортировка из той же ссылки сохраняется.
+// Пустая строка - крупнее текущего вида ничего нет
+func detectBitrixListingSize(doc *goquery.Document, pager bitrixPagination, shown, total, maxItems int) string {
+	component := strings.TrimPrefix(pager.param, "PAGEN_")
+	showAll := "SHOWALL_" + component
+	sizeParams := append([]string{"SIZEN_" + component}, bitrixPageSizeParams...)
+
+	var best url.Values
+	bestSize := shown
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		u, err := url.Parse(s.AttrOr("href", ""))
+		if err != nil {
+			return
+		}
+		query := u.Query()
+		if query.Get(showAll) == "1" && total > shown && total <= maxItems && total > bestSize {
+			best, bestSize = url.Values{showAll: {"1"}}, total
+			return
+		}
+		for _, param := range sizeParams {
+			size, err := strconv.Atoi(query.Get(param))
+			if err == nil && size > bestSize && size <= maxItems {
+				best, bestSize = query, size
+			}
+		}
+	})
+	if best == nil {
+		return ""
+	}
+
+	for param := range best {
+		if strings.HasPrefix(param, "PAGEN_") || param == "bxajaxid" {
+			best.Del(param)
+		}
+	}
+	return best.Encode()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// filePart - один из нумерованных файлов, на которые делится файл результатов при -max-rows-per-file
+type filePart struct {
+	Name     string
+	Products []Product // Товары файла; у потокового вывода не хранятся
+	Rows     int
+}
+
+// partName добавляет к имени файла формата format номер части перед расширением:
+// products.csv -> products_001.csv. Номер дополняется нулями до трех цифр
+func partName(filename, format string, part int) string {
+	number := fmt.Sprintf("_%03d", part)
+	if base, found := strings.CutSuffix(filename, "."+format); found {
+		return base + number + "." + format
+	}
+	return filename + number
+}
+
+// splitFileParts делит товары файла filename на последовательные части не больше maxRows записей.
+// При maxRows = 0 возвращается сам файл без номера. Пустой результат дает один пустой файл _001,
+// чтобы имена файлов запуска не зависели от числа товаров
+func splitFileParts(filename, format string, products []Product, maxRows int) []filePart {
+	if maxRows <= 0 {
+		return []filePart{{Name: filename, Products: products, Rows: len(products)}}
+	}
+
+	var parts []filePart
+	for start := 0; start == 0 || start < len(products); start += maxRows {
+		chunk := products[start:min(start+maxRows, len(products))]
+		parts = append(parts, filePart{
+			Name:     partName(filename, format, len(parts)+1),
+			Products: chunk,
+			Rows:     len(chunk),
+		})
+	}
+	return parts
+}
+
+// rotatingSink пишет товары потокового формата в нумерованные файлы, открывая следующий,
+// когда в текущем набралось maxRows записей. При maxRows = 0 файл один, без номера, и вывод
+// только считает записи для сведений о запуске. Дубликаты пропускаются до подсчета записей,
+// чтобы в соседних файлах не оказалось одного и того же товара
+type rotatingSink struct {
+	mu       sync.Mutex
+	filename string
+	format   string
+	maxRows  int
+	open     func(filename string) (productSink, error)
+	current  productSink
+	parts    []filePart
+	seen     map[string]bool
+}
+
+// newRotatingSink открывает первый файл частей filename; open создает вывод для одного файла
+func newRotatingSink(filename, format string, maxRows int, open func(filename string) (productSink, error)) (*rotatingSink, error) {
+	s := &rotatingSink{
+		filename: filename,
+		format:   format,
+		maxRows:  maxRows,
+		open:     open,
+		seen:     make(map[string]bool),
+	}
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// rotate закрывает текущий файл и открывает следующий по номеру
+func (s *rotatingSink) rotate() error {
+	if s.current != nil {
+		if err := s.current.Close(); err != nil {
+			return err
+		}
+		s.current = nil
+	}
+	name := s.filename
+	if s.maxRows > 0 {
+		name = partName(s.filename, s.format, len(s.parts)+1)
+	}
+	sink, err := s.open(name)
+	if err != nil {
+		return err
+	}
+	s.current = sink
+	s.parts = append(s.parts, filePart{Name: name})
+	return nil
+}
+
+// WriteProduct записывает товар в текущий файл, при необходимости начиная следующий
+func (s *rotatingSink) WriteProduct(product Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := dedupeBy.Key(product)
+	if key == "" || s.seen[key] {
+		return nil
+	}
+	if s.current == nil {
+		return fmt.Errorf("файл %s не открыт", s.filename)
+	}
+
+	if s.maxRows > 0 && s.parts[len(s.parts)-1].Rows >= s.maxRows {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if err := s.current.WriteProduct(product); err != nil {
+		return err
+	}
+	s.seen[key] = true
+	s.parts[len(s.parts)-1].Rows++
+	return nil
+}
+
+// Close закрывает текущий файл
+func (s *rotatingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil {
+		return nil
+	}
+	err := s.current.Close()
+	s.current = nil
+	return err
+}
+
+// Parts возвращает записанные файлы с числом записей в каждом
+func (s *rotatingSink) Parts() []filePart {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]filePart(nil), s.parts...)
+}
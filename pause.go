@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// manualPause приостанавливает обход по команде оператора (SIGUSR2), например чтобы
+// освободить канал на время. Собранные товары, очереди и состояние остаются в памяти
+var manualPause = &pauseControl{}
+
+// pauseControl - пауза, включаемая и выключаемая извне. Пока она включена,
+// новые запросы не начинаются; выполняющиеся запросы завершаются как обычно
+type pauseControl struct {
+	mu      sync.Mutex
+	resumed chan struct{} // Закрывается при снятии паузы; nil, если пауза не включена
+	since   time.Time
+}
+
+// Toggle включает паузу или снимает ее, если она уже включена
+func (p *pauseControl) Toggle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+		slog.Info("Пауза снята, обход продолжается", "paused_for", time.Since(p.since).Round(time.Second))
+		sdNotify("STATUS=Обход продолжается")
+		return
+	}
+
+	p.resumed = make(chan struct{})
+	p.since = time.Now()
+	slog.Info("Обход приостановлен: новые запросы не выполняются. Повторный SIGUSR2 продолжит работу")
+	sdNotify("STATUS=Пауза по команде оператора")
+}
+
+// Paused сообщает, включена ли пауза, и время ее включения
+func (p *pauseControl) Paused() (bool, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil, p.since
+}
+
+// Wait блокирует выполнение, пока включена пауза
+func (p *pauseControl) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+
+	if resumed == nil {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
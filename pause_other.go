@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// watchPauseSignal ничего не делает: SIGUSR2 есть только в unix-системах
+func watchPauseSignal() {}
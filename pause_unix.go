@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchPauseSignal приостанавливает обход при получении SIGUSR2 (kill -USR2 <pid>)
+// и продолжает его при следующем SIGUSR2
+func watchPauseSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+
+	go func() {
+		for range signals {
+			manualPause.Toggle()
+		}
+	}()
+}
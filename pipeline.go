@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Потоковый режим (-streaming): товары идут со страниц списков через дедупликацию и обогащение
+// сразу в выводы, не собираясь в общий список. В памяти остаются только ключи дедупликации,
+// цены для статистики и товары категорий, которые обходятся в данный момент
+
+// streamingSettings - параметры потокового режима из флагов запуска
+type streamingSettings struct {
+	SkipDetails    bool
+	EnrichThreads  int
+	DelayMs        int
+	ProductTimeout time.Duration
+	MaxProducts    int
+}
+
+// streamingResult - итоги потокового обхода
+type streamingResult struct {
+	Found  int       // Товаров на страницах списков, с дубликатами
+	Unique int       // Товаров после дедупликации
+	Prices []Product // Категория и цена каждого уникального товара - для статистики цен
+}
+
+// streamingConflict - возможность, которой нужен полный список товаров; с -streaming она недоступна
+type streamingConflict struct {
+	flag    string
+	enabled bool
+}
+
+// checkStreamingConflicts возвращает ошибку для первой включенной возможности, несовместимой с -streaming
+func checkStreamingConflicts(conflicts []streamingConflict) error {
+	for _, conflict := range conflicts {
+		if conflict.enabled {
+			return fmt.Errorf("%s требует полного списка товаров и несовместим с -streaming", conflict.flag)
+		}
+	}
+	return nil
+}
+
+// runStreamingPipeline читает товары списков из products до закрытия канала, отбрасывает дубликаты
+// по ключу -dedupe-by, обогащает товары в settings.EnrichThreads потоков и передает каждый готовый
+// товар в emit. Вызовы emit идут из одной горутины. При -max-products обход списков останавливается
+// через stopListing
+func runStreamingPipeline(ctx context.Context, products <-chan Product, settings streamingSettings, stopListing context.CancelCauseFunc, emit func(Product)) streamingResult {
+	var result streamingResult
+
+	// Дедупликация: ключи всех пропущенных дальше товаров, сами товары не хранятся
+	unique := make(chan Product)
+	go func() {
+		defer close(unique)
+		keys := make(map[string]bool)
+		for product := range products {
+			result.Found++
+			// Товары сверх предела отбрасываются, пока завершаются уже начатые категории
+			if settings.MaxProducts > 0 && result.Unique >= settings.MaxProducts {
+				continue
+			}
+			key := dedupeBy.Key(product)
+			if key == "" || keys[key] {
+				continue
+			}
+			keys[key] = true
+			result.Unique++
+			if settings.MaxProducts > 0 && result.Unique == settings.MaxProducts {
+				slog.Info("Достигнут предел -max-products, обход категорий остановлен", "products", result.Unique)
+				stopListing(errProductLimit)
+			}
+			unique <- brands.Apply(product)
+		}
+	}()
+
+	done := func(product Product) {
+		stall.MarkProduct()
+		result.Prices = append(result.Prices, Product{Category: product.Category, Price: product.Price})
+		emit(product)
+	}
+
+	if settings.SkipDetails {
+		for product := range unique {
+			done(product)
+		}
+		return result
+	}
+
+	enrichSemaphore := make(chan struct{}, settings.EnrichThreads)
+	status.TrackQueue("обогащения", enrichSemaphore)
+	slog.Info("Используются одновременные потоки для обогащения", "threads", settings.EnrichThreads)
+	enrichProductStream(ctx, unique, settings.EnrichThreads, enrichSemaphore, settings.DelayMs, settings.ProductTimeout, done)
+	return result
+}
+
+// enrichProductStream обогащает товары из канала in в workers потоков по мере их поступления.
+// onDone вызывается для каждого обработанного товара из вызывающей горутины
+func enrichProductStream(ctx context.Context, in <-chan Product, workers int, semaphore chan struct{}, delayMs int, productTimeout time.Duration, onDone func(Product)) {
+	// Общее число товаров заранее неизвестно: прогресс выводится каждые 100 товаров
+	progress := newEnrichProgress(0, 100)
+
+	// Общее число растет по мере поступления товаров в очередь обработчиков
+	queue := make(chan Product)
+	go func() {
+		defer close(queue)
+		for product := range in {
+			progress.Grow()
+			queue <- product
+		}
+	}()
+
+	for product := range startEnrichWorkers(ctx, queue, workers, semaphore, delayMs, productTimeout, progress) {
+		onDone(product)
+	}
+	progress.Finish()
+}
+
+// jsonArraySink записывает файл JSON по одному товару в том же виде, что и saveToJSON:
+// массив с отступами и BOM. Файл становится корректным JSON после Close
+type jsonArraySink struct {
+	mu      sync.Mutex
+	file    io.WriteCloser
+	buf     *bufio.Writer
+	item    bytes.Buffer
+	encoder *json.Encoder
+	count   int
+}
+
+// newJSONArraySink создает файл JSON для потоковой записи товаров
+func newJSONArraySink(filename string) (*jsonArraySink, error) {
+	file, err := createResultFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBOM(file, filename); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s := &jsonArraySink{file: file, buf: bufio.NewWriter(file)}
+	// Отступы как у элементов массива в saveToJSON
+	s.encoder = json.NewEncoder(&s.item)
+	s.encoder.SetIndent("  ", "  ")
+	s.encoder.SetEscapeHTML(false)
+	s.buf.WriteString("[")
+	return s, nil
+}
+
+// WriteProduct дописывает товар очередным элементом массива
+func (s *jsonArraySink) WriteProduct(product Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.item.Reset()
+	if err := s.encoder.Encode(product); err != nil {
+		return err
+	}
+	if s.count > 0 {
+		s.buf.WriteString(",")
+	}
+	s.buf.WriteString("\n  ")
+	s.buf.Write(bytes.TrimSuffix(s.item.Bytes(), []byte("\n")))
+	s.count++
+	return nil
+}
+
+// Close закрывает массив и файл
+func (s *jsonArraySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.count > 0 {
+		s.buf.WriteString("\n")
+	}
+	s.buf.WriteString("]\n")
+	if err := s.buf.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// csvSink записывает CSV по одному товару. Колонки нужно знать до первой строки, поэтому
+// без -csv-columns выводятся все колонки, которые могут быть заполнены в потоковом режиме
+type csvSink struct {
+	mu      sync.Mutex
+	file    io.WriteCloser
+	writer  csvRowWriter
+	columns tableColumns
+	pending int // Строк после последнего сброса на диск
+}
+
+// newCSVSink создает файл CSV с заголовками колонок columns
+func newCSVSink(filename string, columns tableColumns) (*csvSink, error) {
+	file, err := createResultFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBOM(file, filename); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s := &csvSink{file: file, writer: csvFormat.NewWriter(file), columns: columns}
+	if err := s.writer.Write(columns.Headers()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// WriteProduct записывает строку товара; на диск строки сбрасываются пачками buffers.csvBatch
+func (s *csvSink) WriteProduct(product Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writer.Write(s.columns.Row(product)); err != nil {
+		return err
+	}
+	if s.pending++; s.pending >= buffers.csvBatch {
+		s.pending = 0
+		s.writer.Flush()
+		return s.writer.Error()
+	}
+	return nil
+}
+
+// Close дописывает строки и закрывает файл
+func (s *csvSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// politeness задает отдельные задержки и число потоков для групп адресов; nil означает, что правил нет
+var politeness *politenessRules
+
+// politenessRule - задержка и ограничение одновременных запросов для адресов, подходящих под шаблон
+type politenessRule struct {
+	pattern string
+	delay   time.Duration // Минимальный интервал между началом запросов этой группы
+	slots   chan struct{} // Ограничение одновременных запросов; nil - без ограничения
+
+	mu   sync.Mutex
+	next time.Time // Раньше этого времени следующий запрос группы не начинается
+}
+
+// politenessRules - правила в порядке задания; применяется первое подходящее
+type politenessRules struct {
+	rules []*politenessRule
+}
+
+// parsePolitenessRules разбирает значение вида "/catalog/*PAGEN=1s/2;/product/=200ms/8".
+// Каждое правило - шаблон пути в синтаксисе robots.txt ("*" и "$"), задержка
+// и, через "/", необязательное число одновременных запросов
+func parsePolitenessRules(value string) (*politenessRules, error) {
+	p := &politenessRules{}
+
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		pattern, limits, found := strings.Cut(part, "=")
+		if !found || pattern == "" {
+			return nil, fmt.Errorf("правило %q должно иметь вид шаблон=задержка[/потоки]", part)
+		}
+
+		delayValue, concurrencyValue, hasConcurrency := strings.Cut(limits, "/")
+		delay, err := time.ParseDuration(strings.TrimSpace(delayValue))
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("правило %q: неверная задержка %q", part, delayValue)
+		}
+
+		rule := &politenessRule{pattern: strings.TrimSpace(pattern), delay: delay}
+		if hasConcurrency {
+			n, err := strconv.Atoi(strings.TrimSpace(concurrencyValue))
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("правило %q: число потоков должно быть положительным", part)
+			}
+			rule.slots = make(chan struct{}, n)
+		}
+
+		p.rules = append(p.rules, rule)
+	}
+
+	if len(p.rules) == 0 {
+		return nil, fmt.Errorf("не задано ни одного правила")
+	}
+	return p, nil
+}
+
+// raiseDelays поднимает задержки правил до минимальной (Crawl-delay из robots.txt)
+func (p *politenessRules) raiseDelays(minDelay time.Duration) {
+	for _, rule := range p.rules {
+		if rule.delay < minDelay {
+			slog.Info("Задержка правила -politeness увеличена до Crawl-delay", "pattern", rule.pattern, "delay", minDelay)
+			rule.delay = minDelay
+		}
+	}
+}
+
+// match возвращает первое правило, под которое подходит адрес, или nil
+func (p *politenessRules) match(rawURL string) *politenessRule {
+	if p == nil {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	for _, rule := range p.rules {
+		if robotsPatternMatch(rule.pattern, path) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// waitTurn выдерживает задержку перед запросом к адресу: для адресов с правилом -politeness
+// действует интервал этого правила (вместо общей задержки), для остальных - общий limiter.
+// Пауза Retry-After, запрошенная сервером, соблюдается в любом случае; общий для потоков
+// предел -rps для хоста выдерживает уже транспорт (hostLimitTransport) перед каждой попыткой.
+// Случайная добавка -delay-jitter действует в обоих случаях. Пауза оператора выдерживается
+// до задержки, чтобы время на паузе не входило в -product-timeout
+func waitTurn(ctx context.Context, rawURL string) error {
+	if err := manualPause.Wait(ctx); err != nil {
+		return err
+	}
+
+	rule := politeness.match(rawURL)
+	if rule == nil {
+		return limiter.Wait(ctx)
+	}
+
+	now := time.Now()
+	rule.mu.Lock()
+	start := rule.next
+	if start.Before(now) {
+		start = now
+	}
+	rule.next = start.Add(rule.delay)
+	rule.mu.Unlock()
+
+	wait := time.Until(start) + limiter.Jitter()
+	if pause := limiter.Pause(); pause > wait {
+		wait = pause
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquireSlot занимает слот группы адреса, если для нее ограничено число одновременных запросов.
+// Возвращает функцию освобождения слота
+func acquireSlot(ctx context.Context, rawURL string) (func(), error) {
+	rule := politeness.match(rawURL)
+	if rule == nil || rule.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case rule.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { <-rule.slots }) }, nil
+}
+
+// releasingBody освобождает слот группы, когда тело ответа дочитано и закрыто
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// holdSlotUntilClose передает освобождение слота закрытию тела ответа,
+// чтобы ограничение учитывало и загрузку тела, а не только ожидание заголовков
+func holdSlotUntilClose(resp *http.Response, release func()) {
+	resp.Body = releasingBody{ReadCloser: resp.Body, release: release}
+}
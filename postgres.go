@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	_ "github.com/lib/pq"
+)
+
+// pgIdentifierRe ограничивает имя таблицы безопасным идентификатором,
+// так как оно подставляется в текст запроса
+var pgIdentifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// openPostgres подключается к базе и создает таблицу товаров, если ее еще нет.
+// Вызывается до начала парсинга, чтобы ошибка в DSN не обнаружилась только в конце долгого запуска
+func openPostgres(dsn, table string) (*sql.DB, error) {
+	if !pgIdentifierRe.MatchString(table) {
+		return nil, fmt.Errorf("недопустимое имя таблицы %q", table)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("не удалось подключиться к PostgreSQL: %v", err)
+	}
+
+	// Основные поля вынесены в колонки для удобства запросов,
+	// полная запись товара хранится в data, чтобы новые поля не требовали миграций
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id          text PRIMARY KEY,
+		name        text NOT NULL,
+		url         text NOT NULL,
+		price       text NOT NULL,
+		price_value numeric,
+		category    text NOT NULL,
+		data        jsonb NOT NULL,
+		run_id      text,
+		updated_at  timestamptz NOT NULL DEFAULT now()
+	)`, table))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка при создании таблицы %s: %v", table, err)
+	}
+
+	// Таблицы, созданные до появления run_id, получают колонку без пересоздания
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS run_id text`, table)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка при обновлении таблицы %s: %v", table, err)
+	}
+
+	return db, nil
+}
+
+// saveToPostgres записывает товары в таблицу с помощью INSERT ... ON CONFLICT (id) DO UPDATE,
+// так что повторные запуски обновляют существующие строки, а не создают дубликаты.
+// Все товары пишутся в одной транзакции; run_id указывает запуск, последним обновивший строку
+func saveToPostgres(db *sql.DB, table string, products []Product) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(fmt.Sprintf(`INSERT INTO %s (id, name, url, price, price_value, category, data, run_id, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now())
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			url = EXCLUDED.url,
+			price = EXCLUDED.price,
+			price_value = EXCLUDED.price_value,
+			category = EXCLUDED.category,
+			data = EXCLUDED.data,
+			run_id = EXCLUDED.run_id,
+			updated_at = EXCLUDED.updated_at`, table))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var runID sql.NullString
+	if runMeta != nil {
+		runID = sql.NullString{String: runMeta.RunID, Valid: true}
+	}
+
+	written := 0
+	for _, product := range products {
+		if product.ID == "" {
+			continue // Без ID запись нельзя сопоставить с существующей строкой
+		}
+
+		data, err := json.Marshal(product)
+		if err != nil {
+			return 0, err
+		}
+
+		var priceValue sql.NullFloat64
+		if price, ok := parsePrice(product.Price); ok {
+			priceValue = sql.NullFloat64{Float64: price, Valid: true}
+		}
+
+		if _, err := stmt.Exec(product.ID, product.Name, product.URL, product.Price, priceValue, product.Category, data, runID); err != nil {
+			return 0, fmt.Errorf("ошибка при записи товара ID=%s: %v", product.ID, err)
+		}
+		written++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return written, nil
+}
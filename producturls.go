@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// loadProductURLs читает адреса товаров для -product-urls: по одному на строке, пустые строки
+// и строки с "#" пропускаются. Адрес можно указать полностью или путем от корня сайта
+func loadProductURLs(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var productURLs, problems []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		rawURL := strings.TrimSpace(scanner.Text())
+		if rawURL == "" || strings.HasPrefix(rawURL, "#") {
+			continue
+		}
+
+		productURL, err := normalizeProductURL(rawURL)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("  строка %d: %s: %v", line, rawURL, err))
+			continue
+		}
+		if !scope.Allowed(productURL) {
+			problems = append(problems, fmt.Sprintf("  строка %d: %s: адрес за пределами области обхода %s", line, rawURL, scope))
+			continue
+		}
+		if seen[productURL] {
+			continue
+		}
+		seen[productURL] = true
+
+		// Запрещенную страницу обогащение пропустило бы, и в результатах остался бы товар без данных
+		if !robots.Allowed(productURL) {
+			slog.Warn("Адрес товара пропущен: запрещен robots.txt", "url", productURL)
+			continue
+		}
+		productURLs = append(productURLs, productURL)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("некорректные адреса товаров:\n%s", strings.Join(problems, "\n"))
+	}
+	if len(productURLs) == 0 {
+		return nil, errors.New("список адресов товаров пуст")
+	}
+	return productURLs, nil
+}
+
+// normalizeProductURL проверяет, что адрес относится к каталогу сайта, и приводит его
+// к основному хосту и выбранной языковой версии, как адреса категорий
+func normalizeProductURL(rawURL string) (string, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("не удалось разобрать URL: %v", err)
+	}
+	if u.Host == "" && strings.HasPrefix(u.Path, "/") {
+		u.Scheme = base.Scheme
+		u.Host = base.Host
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("ожидается адрес страницы товара вида %s...", catalogURL)
+	}
+	if strings.TrimPrefix(u.Host, "www.") != strings.TrimPrefix(base.Host, "www.") {
+		return "", fmt.Errorf("адрес должен относиться к сайту %s, а не %s", base.Host, u.Host)
+	}
+
+	u.Path = delocalizePath(u.Path)
+	if !strings.HasPrefix(u.Path, site.CatalogPath()) || u.Path == site.CatalogPath() {
+		return "", fmt.Errorf("адрес должен находиться в разделе %s", site.CatalogPath())
+	}
+
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	u.Fragment = ""
+	return localizeURL(u.String()), nil
+}
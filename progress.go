@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressBarWidth     = 30
+	progressNameWidth    = 40 // Длина названия категории в строке прогресса
+	progressRedrawPeriod = 200 * time.Millisecond
+)
+
+// bars выводит индикаторы прогресса в терминал; nil означает, что индикаторы выключены
+var bars *progressBars
+
+// categoryProgress - состояние обхода одной категории
+type categoryProgress struct {
+	name     string
+	page     int
+	products int
+}
+
+// progressBars рисует внизу терминала индикаторы обхода категорий и обогащения.
+// Записи журнала, идущие в тот же терминал, выводятся над индикаторами через LogWriter,
+// а обычный вывод в stdout перехватывается и тоже выводится над ними
+type progressBars struct {
+	mu  sync.Mutex
+	out io.Writer
+
+	drawn      int  // Сколько строк занимают индикаторы на экране
+	dirty      bool // Состояние изменилось с последней отрисовки
+	sharesLogs bool // Журнал выводится в тот же терминал
+
+	categoriesTotal int
+	categoriesDone  int
+	active          []*categoryProgress
+
+	enrichTotal  int
+	enrichDone   int
+	enrichErrors int
+	enrichStart  time.Time
+
+	stdout     *os.File      // Исходный stdout, если он перехвачен
+	stdoutPipe *os.File      // Конец канала, подставленный вместо os.Stdout
+	stdoutDone chan struct{} // Закрывается, когда перехваченный вывод полностью выведен
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// newProgressBars включает индикаторы, если stderr - терминал и не задан -quiet.
+// В остальных случаях (CI, перенаправление в файл, journald) возвращает nil
+func newProgressBars(quiet bool) *progressBars {
+	if quiet || !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	b := &progressBars{out: os.Stderr, stop: make(chan struct{})}
+
+	// Если stdout - тот же терминал, его вывод (fmt.Println) иначе разорвал бы индикаторы
+	if isTerminal(os.Stdout) {
+		if r, w, err := os.Pipe(); err == nil {
+			b.stdout, b.stdoutPipe = os.Stdout, w
+			b.stdoutDone = make(chan struct{})
+			os.Stdout = w
+			go b.copyStdout(r)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(progressRedrawPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				b.mu.Lock()
+				if b.dirty {
+					b.redraw()
+				}
+				b.mu.Unlock()
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+
+	return b
+}
+
+// isTerminal проверяет, что файл - символьное устройство (терминал), а не канал или файл
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// LogWriter возвращает writer для журнала, который выводит записи над индикаторами
+func (b *progressBars) LogWriter() io.Writer {
+	b.sharesLogs = true
+	return progressLogWriter{b}
+}
+
+// ReplacesLogs сообщает, что прогресс виден на индикаторах в том же терминале,
+// что и журнал, и периодические записи о прогрессе только засоряют вывод
+func (b *progressBars) ReplacesLogs() bool {
+	return b != nil && b.sharesLogs
+}
+
+// SetCategories задает общее число категорий для обхода
+func (b *progressBars) SetCategories(total int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.categoriesTotal = total
+	b.dirty = true
+}
+
+// CategoryPage отмечает обработанную страницу категории и число собранных в ней товаров
+func (b *progressBars) CategoryPage(name string, page, products int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range b.active {
+		if c.name == name {
+			c.page, c.products = page, products
+			b.dirty = true
+			return
+		}
+	}
+	b.active = append(b.active, &categoryProgress{name: name, page: page, products: products})
+	b.dirty = true
+}
+
+// CategoryDone отмечает завершение обхода категории
+func (b *progressBars) CategoryDone(name string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.categoriesDone++
+	for i, c := range b.active {
+		if c.name == name {
+			b.active = append(b.active[:i], b.active[i+1:]...)
+			break
+		}
+	}
+	b.dirty = true
+}
+
+// Enrich обновляет прогресс обогащения: done из total товаров обработано, из них errors с ошибкой
+func (b *progressBars) Enrich(done, total, errors int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.enrichStart.IsZero() {
+		b.enrichStart = time.Now()
+	}
+	b.enrichDone, b.enrichTotal, b.enrichErrors = done, total, errors
+	b.dirty = true
+}
+
+// Stop останавливает перерисовку, оставляя на экране последнее состояние индикаторов,
+// и возвращает исходный stdout
+func (b *progressBars) Stop() {
+	if b == nil {
+		return
+	}
+	b.once.Do(func() {
+		close(b.stop)
+
+		if b.stdoutPipe != nil {
+			os.Stdout = b.stdout
+			b.stdoutPipe.Close()
+			<-b.stdoutDone
+		}
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.redraw()
+		b.drawn = 0
+	})
+}
+
+// copyStdout выводит перехваченный stdout над индикаторами
+func (b *progressBars) copyStdout(r *os.File) {
+	defer close(b.stdoutDone)
+	defer r.Close()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			b.mu.Lock()
+			b.clear()
+			b.stdout.Write(buf[:n])
+			b.dirty = true
+			b.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// clear стирает нарисованные индикаторы; вызывается под мьютексом
+func (b *progressBars) clear() {
+	if b.drawn > 0 {
+		// Курсор в начало строки на drawn строк выше и очистка до конца экрана
+		fmt.Fprintf(b.out, "\x1b[%dF\x1b[J", b.drawn)
+		b.drawn = 0
+	}
+}
+
+// redraw перерисовывает индикаторы; вызывается под мьютексом
+func (b *progressBars) redraw() {
+	b.clear()
+
+	var lines []string
+	if b.categoriesTotal > 0 {
+		lines = append(lines, fmt.Sprintf("Категории  %s %d/%d",
+			progressBar(b.categoriesDone, b.categoriesTotal), b.categoriesDone, b.categoriesTotal))
+		for _, c := range b.active {
+			lines = append(lines, fmt.Sprintf("  %s: стр. %d, товаров %d",
+				truncateRunes(c.name, progressNameWidth), c.page, c.products))
+		}
+	}
+	if b.enrichTotal > 0 {
+		line := fmt.Sprintf("Обогащение %s %5.1f%% %d/%d, ошибок %d",
+			progressBar(b.enrichDone, b.enrichTotal), float64(b.enrichDone)/float64(b.enrichTotal)*100,
+			b.enrichDone, b.enrichTotal, b.enrichErrors)
+		if elapsed := time.Since(b.enrichStart); b.enrichDone > 0 && b.enrichDone < b.enrichTotal {
+			eta := time.Duration(float64(elapsed) / float64(b.enrichDone) * float64(b.enrichTotal-b.enrichDone))
+			line += fmt.Sprintf(", осталось %v", eta.Round(time.Second))
+		}
+		lines = append(lines, line)
+	}
+
+	for _, line := range lines {
+		fmt.Fprintln(b.out, line)
+	}
+	b.drawn = len(lines)
+	b.dirty = false
+}
+
+// progressBar возвращает полосу вида [#####-----] для done из total
+func progressBar(done, total int) string {
+	filled := 0
+	if total > 0 {
+		filled = min(done*progressBarWidth/total, progressBarWidth)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled) + "]"
+}
+
+// progressLogWriter выводит записи журнала над индикаторами
+type progressLogWriter struct {
+	b *progressBars
+}
+
+func (w progressLogWriter) Write(p []byte) (int, error) {
+	w.b.mu.Lock()
+	defer w.b.mu.Unlock()
+
+	w.b.clear()
+	n, err := w.b.out.Write(p)
+	// Индикаторы перерисуются на следующем такте, чтобы частые записи не вызывали мерцание
+	w.b.dirty = true
+	return n, err
+}
+
+// progressLogLevel возвращает уровень для периодических записей о прогрессе:
+// когда их заменяют индикаторы в том же терминале, они пишутся только на уровне debug
+func progressLogLevel() slog.Level {
+	if bars.ReplacesLogs() {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
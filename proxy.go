@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// proxyEntry описывает один прокси-сервер пула
+type proxyEntry struct {
+	url      *url.URL
+	failures int  // Количество неудачных запросов подряд
+	evicted  bool // Прокси исключен из ротации
+}
+
+// proxyPool раздает прокси по кругу и исключает те, что раз за разом не работают
+type proxyPool struct {
+	mu          sync.Mutex
+	proxies     []*proxyEntry
+	next        int
+	maxFailures int
+}
+
+// proxyContextKey - ключ контекста запроса, в котором хранится выбранный прокси
+type proxyContextKey struct{}
+
+// errNoProxies возвращается, когда все прокси пула исключены
+var errNoProxies = errors.New("нет доступных прокси: все прокси исключены из ротации")
+
+// loadProxies собирает список прокси из флага -proxy (через запятую) и файла -proxy-file (по одному в строке)
+func loadProxies(list, file string) ([]*url.URL, error) {
+	var raw []string
+	raw = append(raw, strings.Split(list, ",")...)
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			raw = append(raw, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var proxies []*url.URL
+	for _, value := range raw {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		// Без схемы считаем прокси HTTP-прокси
+		if !strings.Contains(value, "://") {
+			value = "http://" + value
+		}
+
+		u, err := url.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный адрес прокси %q: %v", value, err)
+		}
+
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("неподдерживаемая схема прокси %q (допустимо: http, https, socks5)", u.Scheme)
+		}
+
+		proxies = append(proxies, u)
+	}
+
+	return proxies, nil
+}
+
+// newProxyPool создает пул. Начальная позиция ротации выбирается случайно,
+// чтобы параллельные запуски не начинали с одного и того же прокси
+func newProxyPool(proxies []*url.URL, maxFailures int) *proxyPool {
+	pool := &proxyPool{maxFailures: maxFailures}
+	for _, u := range proxies {
+		pool.proxies = append(pool.proxies, &proxyEntry{url: u})
+	}
+	if len(pool.proxies) > 0 {
+		pool.next = randIntn(len(pool.proxies))
+	}
+	return pool
+}
+
+// pick возвращает следующий доступный прокси
+func (p *proxyPool) pick() (*proxyEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := 0; i < len(p.proxies); i++ {
+		entry := p.proxies[p.next]
+		p.next = (p.next + 1) % len(p.proxies)
+		if !entry.evicted {
+			return entry, nil
+		}
+	}
+
+	return nil, errNoProxies
+}
+
+// report учитывает результат запроса через прокси
+func (p *proxyPool) report(entry *proxyEntry, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ok {
+		entry.failures = 0
+		return
+	}
+
+	entry.failures++
+	if !entry.evicted && p.maxFailures > 0 && entry.failures >= p.maxFailures {
+		entry.evicted = true
+		slog.Warn("Прокси исключен из ротации после ошибок подряд", "proxy", entry.url.Redacted(), "failures", entry.failures)
+	}
+}
+
+// proxyTransport направляет каждый запрос через очередной прокси пула
+type proxyTransport struct {
+	pool *proxyPool
+	base *http.Transport
+}
+
+// newProxyTransport создает транспорт на основе base, выбирающий прокси для каждого запроса
+func newProxyTransport(pool *proxyPool, base *http.Transport) *proxyTransport {
+	base = base.Clone()
+	base.Proxy = func(req *http.Request) (*url.URL, error) {
+		if entry, ok := req.Context().Value(proxyContextKey{}).(*proxyEntry); ok {
+			return entry.url, nil
+		}
+		return nil, nil
+	}
+
+	return &proxyTransport{pool: pool, base: base}
+}
+
+// RoundTrip выполняет запрос через выбранный прокси и сообщает пулу о результате.
+// Ошибка соединения и ответ 407 (прокси требует авторизацию) считаются отказом прокси.
+// Запрос, отмененный самим парсером (-product-timeout, -max-products, Ctrl+C), о прокси
+// ничего не говорит и не учитывается: иначе исправные прокси исключались бы навсегда
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry, err := t.pool.pick()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, entry))
+
+	resp, err := t.base.RoundTrip(req)
+	cancelled := req.Context().Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+	if !cancelled {
+		t.pool.report(entry, err == nil && resp.StatusCode != http.StatusProxyAuthRequired)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("прокси %s: %w", entry.url.Redacted(), err)
+	}
+
+	return resp, nil
+}
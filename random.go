@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Общий генератор случайных чисел для случайных задержек, повторов, выбора прокси и User-Agent.
+// Выборка товаров использует отдельные генераторы категорий (sampleRand).
+// Зерно задается флагом -seed, что позволяет точно воспроизвести проблемный запуск
+var (
+	rng     = rand.New(rand.NewSource(time.Now().UnixNano()))
+	rngSeed int64
+	rngMu   sync.Mutex
+)
+
+// seedRandom инициализирует генератор заданным зерном.
+// При нулевом значении зерно выбирается по текущему времени
+func seedRandom(seed int64) int64 {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	rngMu.Lock()
+	defer rngMu.Unlock()
+
+	rng = rand.New(rand.NewSource(seed))
+	rngSeed = seed
+
+	return seed
+}
+
+// randIntn возвращает случайное число в диапазоне [0, n)
+func randIntn(n int) int {
+	rngMu.Lock()
+	defer rngMu.Unlock()
+	return rng.Intn(n)
+}
+
+// randInt63n возвращает случайное число в диапазоне [0, n)
+func randInt63n(n int64) int64 {
+	rngMu.Lock()
+	defer rngMu.Unlock()
+	return rng.Int63n(n)
+}
+
+// sampleRand возвращает отдельный генератор для выборки товаров категории. Он выводится из зерна
+// -seed и адреса категории и не связан с общим генератором, который параллельно расходуют
+// задержки, повторы и прокси, поэтому выборка при том же зерне не зависит от порядка обхода
+func sampleRand(categoryURL string) *rand.Rand {
+	rngMu.Lock()
+	seed := rngSeed
+	rngMu.Unlock()
+
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, seed)
+	h.Write([]byte(categoryURL))
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
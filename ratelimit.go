@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// limiter задает паузу перед каждым запросом к сайту
+var limiter = newAdaptiveLimiter(delay*time.Millisecond, delay*time.Millisecond, delay*time.Millisecond)
+
+// adaptiveLimiter подстраивает задержку между запросами под состояние сервера:
+// при ответах 429/503 задержка увеличивается вдвое (с учетом Retry-After),
+// а пока ответы успешные - постепенно уменьшается до минимальной
+type adaptiveLimiter struct {
+	mu        sync.Mutex
+	delay     time.Duration
+	minDelay  time.Duration
+	maxDelay  time.Duration
+	notBefore time.Time     // Раньше этого времени запросы не выполняются (Retry-After)
+	jitter    time.Duration // Верхняя граница случайной добавки к задержке (-delay-jitter)
+}
+
+// newAdaptiveLimiter создает ограничитель с начальной задержкой initial,
+// которая может меняться в пределах [minDelay, maxDelay]
+func newAdaptiveLimiter(initial, minDelay, maxDelay time.Duration) *adaptiveLimiter {
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+	if initial < minDelay {
+		initial = minDelay
+	}
+	if initial > maxDelay {
+		initial = maxDelay
+	}
+
+	return &adaptiveLimiter{delay: initial, minDelay: minDelay, maxDelay: maxDelay}
+}
+
+// SetJitter задает разброс задержки: к каждой паузе добавляется случайное время от 0 до jitter.
+// Задержка только растет, поэтому -delay и Crawl-delay остаются нижней границей
+func (l *adaptiveLimiter) SetJitter(jitter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.jitter = jitter
+}
+
+// Jitter возвращает случайную добавку к задержке в пределах -delay-jitter
+func (l *adaptiveLimiter) Jitter() time.Duration {
+	l.mu.Lock()
+	jitter := l.jitter
+	l.mu.Unlock()
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(randInt63n(int64(jitter) + 1))
+}
+
+// Wait выдерживает текущую задержку со случайной добавкой перед запросом
+func (l *adaptiveLimiter) Wait(ctx context.Context) error {
+	jitter := l.Jitter()
+
+	l.mu.Lock()
+	wait := l.delay + jitter
+	if pause := time.Until(l.notBefore); pause > wait {
+		wait = pause
+	}
+	l.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause возвращает оставшуюся паузу, запрошенную сервером через Retry-After
+func (l *adaptiveLimiter) Pause() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Until(l.notBefore)
+}
+
+// Observe учитывает ответ сервера при расчете следующей задержки
+func (l *adaptiveLimiter) Observe(resp *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		previous := l.delay
+		l.delay = min(max(l.delay*2, l.minDelay), l.maxDelay)
+
+		if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > 0 {
+			if until := time.Now().Add(retryAfter); until.After(l.notBefore) {
+				l.notBefore = until
+			}
+		}
+
+		if l.delay != previous {
+			slog.Warn("Сервер ограничивает частоту запросов, задержка увеличена", "url", resp.Request.URL.String(), "status", resp.StatusCode, "delay", l.delay)
+		}
+
+	case resp.StatusCode < 400:
+		// Ускоряемся плавно, чтобы не вернуться сразу к перегрузке сервера
+		l.delay = max(l.delay-l.delay/10, l.minDelay)
+	}
+}
+
+// parseRetryAfter разбирает заголовок Retry-After, заданный в секундах или датой
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errRedirectedHome - страница перенаправляет на главную или в корень каталога.
+// Так Bitrix обычно отвечает на адрес удаленного товара или категории
+var errRedirectedHome = errors.New("перенаправление на главную страницу")
+
+// isRedirectedHome проверяет, что ошибка вызвана перенаправлением на главную
+func isRedirectedHome(err error) bool {
+	return errors.Is(err, errRedirectedHome)
+}
+
+// redirects запоминает перенаправления запуска для сводки и отчета -redirect-report
+var redirects = newRedirectTracker()
+
+// Виды перенаправлений
+const (
+	redirectHome     = "home"     // На главную или в корень каталога
+	redirectCategory = "category" // В другую категорию каталога
+	redirectMoved    = "moved"    // Любое другое: смена адреса, протокола, www
+)
+
+// redirectRecord - перенаправление одного адреса
+type redirectRecord struct {
+	URL      string
+	FinalURL string
+	Kind     string
+	Chain    []string // Шаги вида "301 https://..." - код ответа и адрес, который его вернул
+}
+
+// redirectTracker собирает перенаправления по исходным адресам
+type redirectTracker struct {
+	mu      sync.Mutex
+	records map[string]redirectRecord
+
+	// homeRemoved - товары, перенаправляющие на главную, считаются удаленными (-redirect-home-removed)
+	homeRemoved bool
+}
+
+func newRedirectTracker() *redirectTracker {
+	return &redirectTracker{records: make(map[string]redirectRecord)}
+}
+
+// Observe запоминает цепочку перенаправлений ответа на запрос requestURL, если она была.
+// Цепочка восстанавливается по resp.Request.Response: net/http сохраняет в каждом
+// следующем запросе ответ, который к нему привел
+func (t *redirectTracker) Observe(requestURL string, resp *http.Response) {
+	if resp.Request == nil || resp.Request.Response == nil {
+		return
+	}
+
+	var chain []string
+	for r := resp.Request; r.Response != nil && r.Response.Request != nil; r = r.Response.Request {
+		chain = append(chain, fmt.Sprintf("%d %s", r.Response.StatusCode, r.Response.Request.URL))
+	}
+	// Шаги собраны от последнего к первому
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	finalURL := resp.Request.URL.String()
+	record := redirectRecord{
+		URL:      requestURL,
+		FinalURL: finalURL,
+		Kind:     classifyRedirect(requestURL, finalURL),
+		Chain:    chain,
+	}
+
+	t.mu.Lock()
+	t.records[requestURL] = record
+	t.mu.Unlock()
+
+	slog.Info("Перенаправление", "url", requestURL, "final_url", finalURL, "kind", record.Kind, "hops", len(chain))
+}
+
+// Kind возвращает вид перенаправления адреса или пустую строку, если его не было
+func (t *redirectTracker) Kind(rawURL string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.records[rawURL].Kind
+}
+
+// Gone проверяет, считается ли товар с этим адресом удаленным: его страница
+// перенаправляет на главную, и включен -redirect-home-removed
+func (t *redirectTracker) Gone(rawURL string) bool {
+	return t.homeRemoved && t.Kind(rawURL) == redirectHome
+}
+
+// DropGone убирает товары, считающиеся удаленными
+func (t *redirectTracker) DropGone(products []Product) []Product {
+	if !t.homeRemoved {
+		return products
+	}
+	kept := products[:0]
+	for _, product := range products {
+		if !t.Gone(product.URL) {
+			kept = append(kept, product)
+		}
+	}
+	return kept
+}
+
+// WriteReport сохраняет перенаправления в CSV с разделителем ";": исходный адрес,
+// итоговый адрес, вид и цепочка шагов через " -> "
+func (t *redirectTracker) WriteReport(filename string) error {
+	t.mu.Lock()
+	records := make([]redirectRecord, 0, len(t.records))
+	for _, record := range t.records {
+		records = append(records, record)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].URL < records[j].URL })
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Comma = ';'
+	writer.Write([]string{"URL", "Итоговый URL", "Вид", "Цепочка"})
+	for _, record := range records {
+		writer.Write([]string{record.URL, record.FinalURL, record.Kind, strings.Join(record.Chain, " -> ")})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Summary возвращает количество перенаправлений по видам
+func (t *redirectTracker) Summary() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, record := range t.records {
+		counts[record.Kind]++
+	}
+	return counts
+}
+
+// classifyRedirect определяет вид перенаправления с requestURL на finalURL
+func classifyRedirect(requestURL, finalURL string) string {
+	from, err1 := url.Parse(requestURL)
+	to, err2 := url.Parse(finalURL)
+	if err1 != nil || err2 != nil {
+		return redirectMoved
+	}
+
+	// Смена протокола или www у того же пути - не переход на главную, даже для самого каталога
+	if from.Path == to.Path {
+		return redirectMoved
+	}
+
+	root := "/"
+	if siteLocale != "" {
+		root = "/" + siteLocale + "/"
+	}
+	if to.Path == "" || to.Path == "/" || to.Path == root || to.Path == catalogPath() {
+		return redirectHome
+	}
+
+	// Первый элемент пути после каталога - категория: /catalog/stanki_tokarnye/12345/
+	fromCategory, fromOK := catalogSection(from.Path)
+	toCategory, toOK := catalogSection(to.Path)
+	if fromOK && toOK && fromCategory != toCategory {
+		return redirectCategory
+	}
+
+	return redirectMoved
+}
+
+// catalogSection возвращает первый элемент пути внутри каталога
+func catalogSection(path string) (string, bool) {
+	rest, found := strings.CutPrefix(path, catalogPath())
+	if !found || rest == "" {
+		return "", false
+	}
+	section, _, _ := strings.Cut(rest, "/")
+	return section, true
+}
+
+// printRedirectSummary выводит количество перенаправлений по видам
+func printRedirectSummary(reportFile string) {
+	counts := redirects.Summary()
+	total := counts[redirectHome] + counts[redirectCategory] + counts[redirectMoved]
+	if total == 0 {
+		return
+	}
+
+	fmt.Printf("Перенаправлений: %d (на главную %d, в другую категорию %d, прочих %d)\n",
+		total, counts[redirectHome], counts[redirectCategory], counts[redirectMoved])
+
+	if reportFile == "" {
+		return
+	}
+	if err := redirects.WriteReport(reportFile); err != nil {
+		slog.Error("Не удалось сохранить отчет о перенаправлениях", "file", reportFile, "err", err)
+		return
+	}
+	fmt.Printf("Перенаправления сохранены в файл %s\n", reportFile)
+}
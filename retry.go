@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxRetryBackoff ограничивает паузу между повторными попытками
+const maxRetryBackoff = time.Minute
+
+// httpStatusError - запрос выполнен, но сервер вернул код ответа, после которого страница
+// не разбирается: 404/410 (страницы нет, повторять бессмысленно) или 429/5xx после всех попыток
+type httpStatusError struct {
+	URL        string
+	StatusCode int
+	Attempts   int
+}
+
+func (e *httpStatusError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("%s: код ответа %d после %d попыток", e.URL, e.StatusCode, e.Attempts)
+	}
+	return fmt.Sprintf("%s: код ответа %d", e.URL, e.StatusCode)
+}
+
+// errPageNotFound - страницы нет (404, 410); errors.Is с ним верно для httpStatusError с этими кодами
+var errPageNotFound = errors.New("страница не найдена")
+
+func (e *httpStatusError) Is(target error) bool {
+	return target == errPageNotFound && permanentStatus(e.StatusCode)
+}
+
+// isPageNotFound проверяет, что запрос не удался, потому что страницы нет
+func isPageNotFound(err error) bool {
+	return errors.Is(err, errPageNotFound)
+}
+
+// statusCodeOf возвращает код ответа из ошибки httpStatusError или 0
+func statusCodeOf(err error) int {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// retryableStatus - временные ошибки сервера, после которых запрос стоит повторить
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// permanentStatus - страницы нет, повтор ничего не изменит
+func permanentStatus(code int) bool {
+	return code == http.StatusNotFound || code == http.StatusGone
+}
+
+// retryBackoff возвращает паузу перед попыткой attempt+1: delayMs, умноженная на 2^attempt,
+// со случайным разбросом ±50%, чтобы потоки, получившие ошибку одновременно, не повторяли
+// запросы тоже одновременно. Retry-After сервера, если он больше, имеет приоритет
+func retryBackoff(attempt, delayMs int, retryAfter time.Duration) time.Duration {
+	backoff := time.Duration(max(delayMs, 100)) * time.Millisecond << min(attempt, 10)
+	backoff = min(backoff, maxRetryBackoff)
+	backoff = backoff/2 + time.Duration(randInt63n(int64(backoff)))
+	return max(backoff, retryAfter)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsAgent - имя парсера, по которому выбирается группа правил в robots.txt.
+// Если отдельной группы для него нет, используются правила для "*"
+const robotsAgent = "parserEol"
+
+// errDisallowedByRobots возвращается при попытке загрузить адрес, запрещенный robots.txt
+var errDisallowedByRobots = errors.New("адрес запрещен правилами robots.txt")
+
+// robots содержит правила robots.txt сайта; nil означает, что ограничений нет
+var robots *robotsRules
+
+// robotsRule - одно правило Allow или Disallow
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsRules - правила robots.txt, относящиеся к парсеру
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	sitemaps   []string
+}
+
+// fetchRobots загружает и разбирает robots.txt сайта.
+// Отсутствие файла означает, что ограничений нет
+func fetchRobots(ctx context.Context, siteURL string) (*robotsRules, error) {
+	resp, err := doRequestWithRetry(ctx, strings.TrimSuffix(siteURL, "/")+"/robots.txt", 2, delay)
+	if isPageNotFound(err) {
+		return &robotsRules{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return parseRobots(resp.Body, robotsAgent), nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &robotsRules{}, nil
+	default:
+		return nil, fmt.Errorf("ошибка при получении robots.txt: %d", resp.StatusCode)
+	}
+}
+
+// parseRobots разбирает robots.txt и оставляет правила группы для agent,
+// а если такой группы нет - правила группы "*"
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	type group struct {
+		agents     []string
+		rules      []robotsRule
+		crawlDelay time.Duration
+	}
+
+	var groups []*group
+	var current *group
+	var sitemaps []string
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Несколько строк User-agent подряд относятся к одной группе
+			if current == nil || !lastWasAgent {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			// Пустой Disallow разрешает все и правилом не является
+			if current != nil && value != "" {
+				current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if current != nil {
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					current.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			sitemaps = append(sitemaps, value)
+		}
+		lastWasAgent = false
+	}
+
+	// Ищем группу, названную по имени парсера, иначе берем общую группу
+	var selected *group
+	agent = strings.ToLower(agent)
+	for _, g := range groups {
+		for _, name := range g.agents {
+			if name == agent {
+				selected = g
+			}
+			if name == "*" && selected == nil {
+				selected = g
+			}
+		}
+	}
+
+	rules := &robotsRules{sitemaps: sitemaps}
+	if selected != nil {
+		rules.rules = selected.rules
+		rules.crawlDelay = selected.crawlDelay
+	}
+
+	return rules
+}
+
+// Allowed проверяет, разрешена ли загрузка адреса.
+// Побеждает правило с самым длинным шаблоном, при равной длине - Allow
+func (r *robotsRules) Allowed(rawURL string) bool {
+	if r == nil {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "file" {
+		return true
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allowed := true
+	matchedLength := -1
+	for _, rule := range r.rules {
+		if !robotsPatternMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > matchedLength || (len(rule.pattern) == matchedLength && rule.allow) {
+			matchedLength = len(rule.pattern)
+			allowed = rule.allow
+		}
+	}
+
+	return allowed
+}
+
+// Sitemaps возвращает адреса карт сайта, перечисленные в robots.txt
+func (r *robotsRules) Sitemaps() []string {
+	if r == nil {
+		return nil
+	}
+	return r.sitemaps
+}
+
+// robotsPatternMatch сопоставляет путь с шаблоном robots.txt,
+// поддерживая "*" (любая последовательность) и "$" (конец адреса)
+func robotsPatternMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+
+	// Первая часть шаблона должна совпадать с началом пути
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+
+	for i := 1; i < len(parts); i++ {
+		if i == len(parts)-1 && anchored {
+			return strings.HasSuffix(path[pos:], parts[i])
+		}
+		idx := strings.Index(path[pos:], parts[i])
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(parts[i])
+	}
+
+	return !anchored || pos == len(path)
+}
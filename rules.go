@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Виды страниц, на которых выполняется проверка
+const (
+	rulePageList    = "list"    // Страница списка товаров категории
+	rulePageProduct = "product" // Страница товара
+)
+
+// ruleAssertion - проверка разбора из файла -selectors: поле товаров образца страницы должно
+// соответствовать шаблону у заданной доли товаров. Например, {"page": "testdata/list.html",
+// "field": "price", "pattern": "^\\d", "min_ratio": 0.95} - цена начинается с цифры у 95% товаров
+type ruleAssertion struct {
+	// Page - адрес страницы или путь к сохраненному образцу относительно файла -selectors
+	Page string `json:"page"`
+	// Kind - вид страницы: list (по умолчанию) или product
+	Kind string `json:"kind"`
+	// Field - поле товара (см. productFields) или specs.<название> для отдельной характеристики
+	Field string `json:"field"`
+	// Pattern - регулярное выражение для значения; пустой шаблон требует непустого значения
+	Pattern string `json:"pattern"`
+	// MinRatio - доля товаров, у которых значение должно подойти (по умолчанию 1)
+	MinRatio float64 `json:"min_ratio"`
+	// MinCount - сколько товаров как минимум должно найтись на странице списка (по умолчанию 1)
+	MinCount int `json:"min_count"`
+
+	re *regexp.Regexp
+}
+
+// compile проверяет проверку, подставляет значения по умолчанию и компилирует шаблон
+func (a *ruleAssertion) compile() error {
+	if strings.TrimSpace(a.Page) == "" {
+		return fmt.Errorf("не указана страница page")
+	}
+
+	switch a.Kind {
+	case "":
+		a.Kind = rulePageList
+	case rulePageList, rulePageProduct:
+	default:
+		return fmt.Errorf("неизвестный вид страницы %q (допустимо: list, product)", a.Kind)
+	}
+
+	if err := checkProductField(a.Field); err != nil {
+		return err
+	}
+
+	if a.MinRatio == 0 {
+		a.MinRatio = 1
+	}
+	if a.MinRatio < 0 || a.MinRatio > 1 {
+		return fmt.Errorf("min_ratio должен быть от 0 до 1: %v", a.MinRatio)
+	}
+	if a.MinCount == 0 {
+		a.MinCount = 1
+	}
+
+	pattern := a.Pattern
+	if pattern == "" {
+		pattern = `\S`
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("шаблон %q: %v", a.Pattern, err)
+	}
+	a.re = re
+	return nil
+}
+
+// value возвращает значение проверяемого поля товара
+func (a *ruleAssertion) value(product Product) string {
+	return productFieldValue(product, a.Field)
+}
+
+// check выполняет проверку на товарах страницы и возвращает описание результата
+func (a *ruleAssertion) check(products []Product) (string, bool) {
+	if len(products) < a.MinCount {
+		return fmt.Sprintf("найдено товаров: %d, нужно не меньше %d", len(products), a.MinCount), false
+	}
+
+	matched := 0
+	var example string
+	for _, product := range products {
+		value := a.value(product)
+		if a.re.MatchString(value) {
+			matched++
+		} else if example == "" {
+			example = fmt.Sprintf("%s: %q", product.ID, value)
+		}
+	}
+
+	ratio := float64(matched) / float64(len(products))
+	result := fmt.Sprintf("подходят %d из %d (%.0f%%, нужно %.0f%%)", matched, len(products), ratio*100, a.MinRatio*100)
+	if example != "" {
+		result += ", например " + example
+	}
+	return result, ratio >= a.MinRatio
+}
+
+// isLivePage сообщает, что страница проверки загружается с сайта, а не из файла образца
+func isLivePage(page string) bool {
+	return strings.HasPrefix(page, "http://") || strings.HasPrefix(page, "https://")
+}
+
+// loadRulePage загружает страницу проверки с сайта или из файла образца
+func loadRulePage(ctx context.Context, page string, delayMs int) (*goquery.Document, error) {
+	if !isLivePage(page) {
+		f, err := os.Open(page)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		utf8Reader, err := getUTF8Reader(f)
+		if err != nil {
+			return nil, err
+		}
+		return goquery.NewDocumentFromReader(utf8Reader)
+	}
+
+	resp, err := doRequestWithRetry(ctx, page, 2, delayMs)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ошибка при получении страницы: %d", resp.StatusCode)
+	}
+
+	utf8Reader, err := responseUTF8Reader(resp)
+	if err != nil {
+		return nil, err
+	}
+	return goquery.NewDocumentFromReader(utf8Reader)
+}
+
+// parseRulePage разбирает страницу так же, как при обходе: список товаров или страницу товара
+func parseRulePage(doc *goquery.Document, page, kind string) []Product {
+	if kind == rulePageProduct {
+		product := parseProductPage(doc, nil, page)
+		if product.URL == "" {
+			product.URL = page
+		}
+		return []Product{product}
+	}
+
+	return parseListPage(doc, nil, Category{Name: "test-rules", URL: page}, false).Products
+}
+
+// runTestRules выполняет команду test-rules: загружает страницы проверок из файла -selectors,
+// разбирает их текущими селекторами и сообщает, какие проверки не прошли
+func runTestRules(ctx context.Context, args []string, assertions []ruleAssertion, delayMs int) error {
+	fs := flag.NewFlagSet("test-rules", flag.ContinueOnError)
+	offline := fs.Bool("offline", false, "Проверять только сохраненные образцы, пропуская адреса сайта")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: parserEol -selectors файл [флаги] test-rules [-offline]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(assertions) == 0 {
+		return fmt.Errorf("в файле -selectors нет проверок (assertions) для сайта %s", site.Name())
+	}
+
+	// Каждая страница загружается и разбирается один раз, сколько бы проверок к ней ни относилось
+	type pageKey struct{ page, kind string }
+	parsed := make(map[pageKey][]Product)
+	pageErrors := make(map[pageKey]error)
+
+	failed, skipped := 0, 0
+	for i := range assertions {
+		a := &assertions[i]
+		key := pageKey{a.Page, a.Kind}
+
+		if *offline && isLivePage(a.Page) {
+			skipped++
+			continue
+		}
+
+		if _, done := parsed[key]; !done && pageErrors[key] == nil {
+			doc, err := loadRulePage(ctx, a.Page, delayMs)
+			if err != nil {
+				pageErrors[key] = err
+			} else {
+				parsed[key] = parseRulePage(doc, a.Page, a.Kind)
+			}
+		}
+
+		title := fmt.Sprintf("%s %s: %s ~ %s", a.Kind, a.Page, a.Field, a.re)
+		if err := pageErrors[key]; err != nil {
+			failed++
+			fmt.Printf("FAIL %s: страница не загружена: %v\n", title, err)
+			continue
+		}
+
+		result, ok := a.check(parsed[key])
+		if !ok {
+			failed++
+			fmt.Printf("FAIL %s: %s\n", title, result)
+			continue
+		}
+		fmt.Printf("OK   %s: %s\n", title, result)
+	}
+
+	fmt.Printf("\nПроверок: %d, не прошло: %d, пропущено: %d\n", len(assertions), failed, skipped)
+	if failed > 0 {
+		return errors.New("селекторы не прошли проверку")
+	}
+	return nil
+}
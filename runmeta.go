@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// version - версия парсера; задается при сборке: go build -ldflags "-X main.version=1.4.0"
+var version = ""
+
+// runMeta - сведения о запуске, которые записываются рядом с каждым файлом результатов;
+// nil означает, что сведения не записываются (отладочные команды)
+var runMeta *runMetadata
+
+// runMetadata описывает, каким запуском и с какими параметрами получен файл результатов
+type runMetadata struct {
+	RunID      string            `json:"run_id"`
+	Tool       string            `json:"tool"`
+	Version    string            `json:"version"`
+	Site       string            `json:"site"`
+	Locale     string            `json:"locale,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	Seed       int64             `json:"seed"`
+	Parameters map[string]string `json:"parameters"` // Значения всех флагов, включая значения по умолчанию
+}
+
+// fileMetadata - сведения о запуске для конкретного файла результатов
+type fileMetadata struct {
+	runMetadata
+	File       string    `json:"file"`
+	Format     string    `json:"format"`
+	Records    int       `json:"records"` // Товаров или, в режиме categories, категорий в файле
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// newRunMetadata собирает сведения о запуске. Пароли в строке подключения к PostgreSQL,
+// в адресах прокси, сервера получателя, уведомления, Elasticsearch, MongoDB и брокера сообщений скрываются
+func newRunMetadata(start time.Time) *runMetadata {
+	meta := &runMetadata{
+		RunID:      newRunID(start),
+		Tool:       "parserEol",
+		Version:    toolVersion(),
+		Site:       baseURL,
+		Locale:     siteLocale,
+		StartedAt:  start,
+		Seed:       rngSeed,
+		Parameters: make(map[string]string),
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch f.Name {
+		case "pg-dsn", "proxy", "upload-url", "webhook-url", "es-url", "mongo-uri", "stream-url":
+			value = maskCredentials(value)
+		}
+		meta.Parameters[f.Name] = value
+	})
+
+	return meta
+}
+
+// newRunID возвращает идентификатор запуска вида 20060102-150405-1a2b3c:
+// время позволяет сортировать запуски, случайная часть - различать одновременные
+func newRunID(start time.Time) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return start.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// toolVersion возвращает версию, заданную при сборке, а без нее - ревизию git из сведений о сборке
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return "dev-" + revision
+}
+
+// dsnPasswordRe находит пароль в строке подключения вида "host=db user=parser password=secret"
+var dsnPasswordRe = regexp.MustCompile(`(password=)\S+`)
+
+// maskCredentials заменяет пароли в адресах (через запятую) и в строке подключения
+func maskCredentials(value string) string {
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		if u, err := url.Parse(strings.TrimSpace(part)); err == nil && u.User != nil {
+			parts[i] = u.Redacted()
+		}
+	}
+	return dsnPasswordRe.ReplaceAllString(strings.Join(parts, ","), "${1}xxxxx")
+}
+
+// saveRunMetadata записывает рядом с файлом результатов файл <имя>.meta.json со сведениями о запуске.
+// Сами JSON, CSV и NDJSON не меняются, чтобы не ломать программы, которые их читают
+func saveRunMetadata(filename, format string, records int) {
+	// У stdout сведений о запуске рядом не положить
+	if runMeta == nil || filename == stdoutOutput {
+		return
+	}
+
+	data, err := json.MarshalIndent(fileMetadata{
+		runMetadata: *runMeta,
+		File:        filename,
+		Format:      format,
+		Records:     records,
+		FinishedAt:  time.Now(),
+	}, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filename+".meta.json", append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		slog.Error("Не удалось записать сведения о запуске", "file", filename+".meta.json", "err", err)
+	}
+}
+
+// xlsxRunSheet - лист книги XLSX со сведениями о запуске
+const xlsxRunSheet = "Запуск"
+
+// writeRunSheet добавляет в книгу лист со сведениями о запуске и параметрами
+func writeRunSheet(f *excelize.File, products int) error {
+	if runMeta == nil {
+		return nil
+	}
+
+	if _, err := f.NewSheet(xlsxRunSheet); err != nil {
+		return err
+	}
+
+	rows := [][]interface{}{
+		{"Идентификатор запуска", runMeta.RunID},
+		{"Программа", runMeta.Tool + " " + runMeta.Version},
+		{"Сайт", runMeta.Site},
+		{"Языковая версия", runMeta.Locale},
+		{"Начало", runMeta.StartedAt.Format("2006-01-02 15:04:05 -0700")},
+		{"Завершение", time.Now().Format("2006-01-02 15:04:05 -0700")},
+		{"Зерно", runMeta.Seed},
+		{"Товаров", products},
+		{},
+		{"Параметр", "Значение"},
+	}
+	for _, name := range slices.Sorted(maps.Keys(runMeta.Parameters)) {
+		rows = append(rows, []interface{}{"-" + name, runMeta.Parameters[name]})
+	}
+
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow(xlsxRunSheet, cell, &row); err != nil {
+			return err
+		}
+	}
+
+	if err := f.SetColWidth(xlsxRunSheet, "A", "A", 24); err != nil {
+		return err
+	}
+	return f.SetColWidth(xlsxRunSheet, "B", "B", 60)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// s3ContentTypes - типы содержимого файлов результатов по расширению; хранилище отдает их
+// при загрузке, и потребители озера данных определяют формат без разбора имени
+var s3ContentTypes = []struct {
+	suffix      string
+	contentType string
+}{
+	{".meta.json", "application/json"},
+	{".gz", "application/gzip"},
+	{".ndjson.zst", "application/zstd"},
+	{".ndjson", "application/x-ndjson"},
+	{".json", "application/json"},
+	{".csv", "text/csv; charset=utf-8"},
+	{".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+}
+
+// s3ContentType возвращает тип содержимого файла по расширению
+func s3ContentType(filename string) string {
+	for _, t := range s3ContentTypes {
+		if strings.HasSuffix(filename, t.suffix) {
+			return t.contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// s3Uploader загружает файлы результатов в бакет S3-совместимого хранилища (AWS S3, MinIO,
+// Yandex Object Storage и т.п.). Запросы подписываются AWS Signature V4 без SDK:
+// для загрузки одного объекта хватает PUT с подписью
+type s3Uploader struct {
+	client       *http.Client
+	endpoint     *url.URL // Адрес хранилища; пусто - AWS S3 в регионе region
+	bucket       string
+	region       string
+	prefix       string // Префикс ключей запуска без "/" на концах
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// newS3Uploader берет ключи доступа из переменных окружения AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// (и AWS_SESSION_TOKEN для временных ключей), как принято у инструментов AWS. Регион по умолчанию -
+// из AWS_REGION или AWS_DEFAULT_REGION, адрес хранилища - из AWS_ENDPOINT_URL_S3 или AWS_ENDPOINT_URL
+func newS3Uploader(bucket, endpoint, region, prefix string) (*s3Uploader, error) {
+	u := &s3Uploader{
+		// Общий клиент парсера не подходит: у него прокси, ограничение частоты и таймаут для страниц
+		client:       &http.Client{},
+		bucket:       bucket,
+		region:       firstNonEmpty(region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		prefix:       strings.Trim(prefix, "/"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if u.accessKey == "" || u.secretKey == "" {
+		return nil, fmt.Errorf("не заданы переменные окружения AWS_ACCESS_KEY_ID и AWS_SECRET_ACCESS_KEY")
+	}
+
+	endpoint = firstNonEmpty(endpoint, os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"))
+	if endpoint != "" {
+		parsed, err := url.Parse(endpoint)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("некорректный адрес хранилища %q", endpoint)
+		}
+		u.endpoint = parsed
+	}
+	return u, nil
+}
+
+// firstNonEmpty возвращает первое непустое значение
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Key возвращает ключ объекта для файла: префикс запуска и имя файла без каталога
+func (u *s3Uploader) Key(filename string) string {
+	if u.prefix == "" {
+		return filepath.Base(filename)
+	}
+	return u.prefix + "/" + filepath.Base(filename)
+}
+
+// objectURL возвращает адрес объекта. У AWS бакет указывается в имени хоста, у остальных
+// хранилищ - в пути (path-style): его поддерживают все S3-совместимые хранилища
+func (u *s3Uploader) objectURL(key string) *url.URL {
+	objectURL := url.URL{
+		Scheme: "https",
+		Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", u.bucket, u.region),
+		Path:   "/" + key,
+	}
+	if u.endpoint != nil {
+		objectURL = *u.endpoint
+		objectURL.Path = path.Join("/", u.endpoint.Path, u.bucket, key)
+	}
+	// Путь в подписи кодируется по правилам S3 строже, чем в net/url: иначе имена с "+", "=" или ","
+	// дали бы разные пути в подписи и в запросе
+	objectURL.RawPath = s3EscapePath(objectURL.Path)
+	return &objectURL
+}
+
+// s3EscapePath кодирует путь по правилам подписи S3: без изменений остаются только
+// латинские буквы, цифры, "-", "_", ".", "~" и разделитель "/"
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			(c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// UploadFiles загружает файлы по очереди и возвращает загруженные. Ошибка загрузки
+// одного файла не мешает остальным: все ошибки попадают в журнал
+func (u *s3Uploader) UploadFiles(ctx context.Context, filenames []string) []string {
+	var uploaded []string
+	for _, filename := range filenames {
+		key := u.Key(filename)
+		var err error
+		for attempt := 0; attempt < 3; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryBackoff(attempt, 1000, 0)):
+				}
+			}
+			if err = u.put(ctx, key, filename); err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if err != nil {
+			slog.Error("Не удалось загрузить файл в S3", "file", filename, "bucket", u.bucket, "key", key, "err", err)
+			status.CountError("выгрузка")
+			continue
+		}
+		uploaded = append(uploaded, filename)
+		slog.Info("Файл загружен в S3", "file", filename, "bucket", u.bucket, "key", key)
+	}
+	return uploaded
+}
+
+// put загружает файл одним запросом PUT. Хеш содержимого входит в подпись,
+// поэтому файл читается дважды: для хеша и для отправки
+func (u *s3Uploader) put(ctx context.Context, key, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.objectURL(key).String(), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", s3ContentType(filename))
+	u.sign(req, hex.EncodeToString(hash.Sum(nil)), time.Now().UTC())
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ответ хранилища %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// PresignGet возвращает подписанную ссылку на скачивание объекта, действующую expires
+// (не больше 7 дней): по ней файл скачивается без ключей доступа к бакету
+func (u *s3Uploader) PresignGet(key string, expires time.Duration, now time.Time) string {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + u.region + "/s3/aws4_request"
+
+	objectURL := u.objectURL(key)
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {u.accessKey + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {fmt.Sprint(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if u.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", u.sessionToken)
+	}
+	// В подписи пробел кодируется как %20, а не "+", как у url.Values.Encode
+	objectURL.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		objectURL.EscapedPath(),
+		objectURL.RawQuery,
+		"host:" + objectURL.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	signature := u.signature(scope, amzDate, canonicalRequest)
+
+	objectURL.RawQuery += "&X-Amz-Signature=" + signature
+	return objectURL.String()
+}
+
+// signature вычисляет подпись запроса по его канонической форме
+func (u *s3Uploader) signature(scope, amzDate, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+u.secretKey), scope[:8])
+	key = hmacSHA256(key, u.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// sign добавляет к запросу заголовки подписи AWS Signature V4
+func (u *s3Uploader) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if u.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.sessionToken)
+	}
+
+	// Подписываются все заголовки, которые задали сами, и Host; имена - в нижнем регистре по алфавиту
+	headers := map[string]string{"host": req.URL.Host}
+	names := []string{"host"}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		names = append(names, lower)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + u.region + "/s3/aws4_request"
+	signature := u.signature(scope, amzDate, canonicalRequest)
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
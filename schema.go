@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// jsonSchemaDialect - версия JSON Schema, в которой описана выгрузка
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaViolationsShown - сколько нарушений схемы выводится в журнал; остальные только считаются
+const schemaViolationsShown = 20
+
+// jsonSchema - подмножество JSON Schema, которым описывается товар: типы, обязательные поля,
+// вложенные объекты и списки, ограничения строк. validateSchema проверяет ровно это подмножество
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 schemaTypes            `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"` // false или схема значений
+	Items                *jsonSchema            `json:"items,omitempty"`
+	MinLength            int                    `json:"minLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes - типы JSON значения; один тип записывается строкой, несколько - списком
+type schemaTypes []string
+
+func (t schemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// schemaRule - описание и ограничения поля сверх того, что следует из его типа в Go
+type schemaRule struct {
+	Description string
+	MinLength   int
+	Pattern     string
+	Enum        []string
+}
+
+// productSchemaRules - описания и ограничения полей товара по пути: "price", "variants.price"
+var productSchemaRules = map[string]schemaRule{
+	"id":                 {Description: "ID товара на сайте"},
+	"name":               {Description: "Название товара"},
+	"url":                {Description: "Адрес страницы товара", MinLength: 1, Pattern: `^https?://`},
+	"description":        {Description: "Описание со страницы товара; пусто при -skip-details"},
+	"price":              {Description: "Цена как на сайте: число или текст, пусто - без цены"},
+	"image_url":          {Description: "Основное изображение"},
+	"image_alt":          {Description: "Текст alt изображения в карточке списка"},
+	"category":           {Description: "Категория, в которой найден товар"},
+	"category_path":      {Description: "Навигационная цепочка страницы товара"},
+	"features":           {Description: "Характеристики строками \"название: значение\""},
+	"specs":              {Description: "Характеристики по названиям"},
+	"sku":                {Description: "Артикул"},
+	"brand":              {Description: "Бренд"},
+	"manufacturer":       {Description: "Производитель"},
+	"availability":       {Description: "Наличие по schema.org: InStock, OutOfStock, PreOrder..."},
+	"availability_text":  {Description: "Текст о наличии на сайте"},
+	"delivery_time":      {Description: "Срок поставки из текста о наличии"},
+	"in_stock":           {Description: "Товар на складе; false и при неизвестном наличии"},
+	"images":             {Description: "Все изображения товара"},
+	"gallery":            {Description: "Галерея страницы товара с alt и подписями"},
+	"variants":           {Description: "Торговые предложения с отдельными ценами и свойствами"},
+	"locale":             {Description: "Языковая версия сайта; нет для основной"},
+	"local_image_path":   {Description: "Загруженное изображение при -download-images"},
+	"noindex":            {Description: "Страница запрещена к индексации"},
+	"change_type":        {Description: "Изменение относительно прошлого запуска при -incremental", Enum: []string{changeNew, changeChanged, changeRemoved}},
+	"seen_before":        {Description: "Товар найден в одном из прошлых запусков"},
+	"first_seen":         {Description: "Дата первого запуска, в котором найден товар", Pattern: `^\d{4}-\d{2}-\d{2}$`},
+	"gallery.url":        {MinLength: 1},
+	"variants.id":        {Description: "ID торгового предложения"},
+	"variants.parent_id": {Description: "ID товара, к которому относится предложение"},
+}
+
+// productSchema строит схему товара по структуре Product: поля без omitempty обязательны,
+// списки и словари без omitempty могут быть null, лишние поля запрещены
+func productSchema() *jsonSchema {
+	schema := schemaFor(reflect.TypeOf(Product{}), "")
+	schema.Schema = jsonSchemaDialect
+	schema.Title = "Товар"
+	schema.Description = fmt.Sprintf("Запись выгрузки товаров %s", baseURL)
+	return schema
+}
+
+// productListSchema - схема файла JSON: список товаров
+func productListSchema() *jsonSchema {
+	item := productSchema()
+	list := &jsonSchema{
+		Schema:      item.Schema,
+		Title:       "Выгрузка товаров",
+		Description: "Файл JSON парсера; в ndjson каждая строка - отдельный товар",
+		Type:        schemaTypes{"array"},
+		Items:       item,
+	}
+	item.Schema = ""
+	return list
+}
+
+// schemaFor описывает тип Go; path - путь поля для productSchemaRules
+func schemaFor(t reflect.Type, path string) *jsonSchema {
+	switch t.Kind() {
+	case reflect.String:
+		return &jsonSchema{Type: schemaTypes{"string"}}
+	case reflect.Bool:
+		return &jsonSchema{Type: schemaTypes{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: schemaTypes{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: schemaTypes{"number"}}
+	case reflect.Slice:
+		return &jsonSchema{Type: schemaTypes{"array"}, Items: schemaFor(t.Elem(), path)}
+	case reflect.Map:
+		return &jsonSchema{Type: schemaTypes{"object"}, AdditionalProperties: schemaFor(t.Elem(), path)}
+	case reflect.Struct:
+		schema := &jsonSchema{Type: schemaTypes{"object"}, Properties: map[string]*jsonSchema{}, AdditionalProperties: false}
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+
+			property := schemaFor(field.Type, fieldPath)
+			omitEmpty := slices.Contains(strings.Split(options, ","), "omitempty")
+			if !omitEmpty {
+				schema.Required = append(schema.Required, name)
+				// nil-список или nil-словарь без omitempty кодируется как null
+				if kind := field.Type.Kind(); kind == reflect.Slice || kind == reflect.Map {
+					property.Type = append(property.Type, "null")
+				}
+			}
+			if rule, ok := productSchemaRules[fieldPath]; ok {
+				property.Description = rule.Description
+				property.MinLength = rule.MinLength
+				property.Pattern = rule.Pattern
+				property.Enum = rule.Enum
+			}
+			schema.Properties[name] = property
+		}
+		return schema
+	}
+	return &jsonSchema{}
+}
+
+// validateSchema проверяет значение, разобранное encoding/json, и возвращает нарушения с путями полей
+func validateSchema(schema *jsonSchema, value any, path string) []string {
+	at := func(format string, args ...any) string {
+		if path == "" {
+			return fmt.Sprintf(format, args...)
+		}
+		return path + ": " + fmt.Sprintf(format, args...)
+	}
+
+	valueType := jsonTypeOf(value)
+	if valueType == "integer" && slices.Contains(schema.Type, "number") {
+		valueType = "number"
+	}
+	if len(schema.Type) > 0 && !slices.Contains(schema.Type, valueType) {
+		return []string{at("тип %s, ожидается %s", jsonTypeOf(value), strings.Join(schema.Type, " или "))}
+	}
+
+	var violations []string
+	switch v := value.(type) {
+	case string:
+		if len([]rune(v)) < schema.MinLength {
+			violations = append(violations, at("строка короче %d символов", schema.MinLength))
+		}
+		if schema.Pattern != "" {
+			if schema.pattern == nil {
+				schema.pattern = regexp.MustCompile(schema.Pattern)
+			}
+			if !schema.pattern.MatchString(v) {
+				violations = append(violations, at("%q не соответствует шаблону %s", v, schema.Pattern))
+			}
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, v) {
+			violations = append(violations, at("%q не из допустимых значений %s", v, strings.Join(schema.Enum, ", ")))
+		}
+	case []any:
+		if schema.Items != nil {
+			for i, item := range v {
+				violations = append(violations, validateSchema(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				violations = append(violations, at("нет обязательного поля %s", name))
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			if property, ok := schema.Properties[name]; ok {
+				violations = append(violations, validateSchema(property, v[name], fieldPath)...)
+				continue
+			}
+			switch extra := schema.AdditionalProperties.(type) {
+			case bool:
+				if !extra {
+					violations = append(violations, at("лишнее поле %s", name))
+				}
+			case *jsonSchema:
+				violations = append(violations, validateSchema(extra, v[name], fieldPath)...)
+			}
+		}
+	}
+	return violations
+}
+
+// jsonTypeOf возвращает тип JSON Schema для значения, разобранного encoding/json
+func jsonTypeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// productValidator проверяет товары в том виде, в каком они записываются в JSON, по схеме товара.
+// Нарушения выводятся в журнал (не больше schemaViolationsShown за запуск, сколько бы раз
+// ни вызывалась проверка); безопасен для использования из нескольких горутин
+type productValidator struct {
+	mu     sync.Mutex
+	schema *jsonSchema
+	shown  int
+}
+
+// newProductValidator создает проверку по схеме товара
+func newProductValidator() *productValidator {
+	return &productValidator{schema: productSchema()}
+}
+
+// Check возвращает нарушения схемы товаром; пустой результат - товар соответствует схеме
+func (v *productValidator) Check(product Product) ([]string, error) {
+	data, err := json.Marshal(product)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	violations := validateSchema(v.schema, value, "")
+	for _, violation := range violations {
+		if v.shown < schemaViolationsShown {
+			slog.Error("Товар не соответствует схеме", "id", product.ID, "url", product.URL, "violation", violation)
+		}
+		v.shown++
+	}
+	return violations, nil
+}
+
+// Validate проверяет список товаров и возвращает ошибку с числом нарушений
+func (v *productValidator) Validate(products []Product) error {
+	var invalid, total int
+	for _, product := range products {
+		violations, err := v.Check(product)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			invalid++
+			total += len(violations)
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("схеме не соответствуют %d из %d товаров, нарушений: %d", invalid, len(products), total)
+	}
+	return nil
+}
+
+// saveSchema записывает схему файла JSON в filename; "-" - в stdout
+func saveSchema(filename string) error {
+	var file io.WriteCloser = stdoutWriter{os.Stdout}
+	if filename != stdoutOutput {
+		var err error
+		if file, err = os.Create(filename); err != nil {
+			return err
+		}
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(productListSchema()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
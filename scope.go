@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// scope ограничивает адреса, по которым переходит парсер; nil означает, что ограничений нет
+var scope *crawlScope
+
+// crawlScope - область обхода: хост сайта, разрешенные префиксы пути и фильтры адресов.
+// Ссылки за ее пределами (новости, блог, другие сайты) отбрасываются и подсчитываются
+type crawlScope struct {
+	host     string         // Хост сайта без www.
+	prefixes []string       // Разрешенные префиксы пути, например /catalog/
+	include  *regexp.Regexp // -include-url-regex: обходятся только подходящие адреса; nil - все
+	exclude  *regexp.Regexp // -exclude-url-regex: подходящие адреса пропускаются; nil - ни один
+
+	rejected atomic.Int64
+	filtered atomic.Int64 // Адреса в области обхода, отброшенные фильтрами
+}
+
+// newCrawlScope создает область обхода для сайта siteURL. value - префиксы пути через запятую;
+// пустое значение означает раздел каталога с учетом языковой версии
+func newCrawlScope(siteURL, value string) (*crawlScope, error) {
+	base, err := url.Parse(siteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &crawlScope{host: strings.TrimPrefix(base.Host, "www.")}
+	for _, prefix := range strings.Split(value, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("префикс %q должен начинаться с /", prefix)
+		}
+		s.prefixes = append(s.prefixes, prefix)
+	}
+	if len(s.prefixes) == 0 {
+		s.prefixes = []string{catalogPath()}
+	}
+
+	return s, nil
+}
+
+// SetURLFilters задает регулярные выражения -include-url-regex и -exclude-url-regex, которые
+// проверяются по полному адресу категории или товара; пустое выражение не задает фильтра
+func (s *crawlScope) SetURLFilters(include, exclude string) error {
+	for _, filter := range []struct {
+		flag  string
+		value string
+		re    **regexp.Regexp
+	}{
+		{"-include-url-regex", include, &s.include},
+		{"-exclude-url-regex", exclude, &s.exclude},
+	} {
+		if filter.value == "" {
+			continue
+		}
+		re, err := regexp.Compile(filter.value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filter.flag, err)
+		}
+		*filter.re = re
+	}
+	return nil
+}
+
+// Allowed проверяет, что адрес относится к сайту, находится в одном из разрешенных разделов
+// и проходит фильтры адресов. Отклоненные адреса подсчитываются для итоговой сводки
+func (s *crawlScope) Allowed(rawURL string) bool {
+	if s == nil {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	if err == nil && (u.Host == "" || strings.TrimPrefix(u.Host, "www.") == s.host) {
+		for _, prefix := range s.prefixes {
+			if strings.HasPrefix(u.Path, prefix) {
+				return s.matchFilters(rawURL)
+			}
+		}
+	}
+
+	s.rejected.Add(1)
+	slog.Debug("Ссылка за пределами области обхода отклонена", "url", rawURL)
+	return false
+}
+
+// matchFilters проверяет адрес фильтрами: исключающий фильтр важнее включающего
+func (s *crawlScope) matchFilters(rawURL string) bool {
+	if (s.include == nil || s.include.MatchString(rawURL)) && (s.exclude == nil || !s.exclude.MatchString(rawURL)) {
+		return true
+	}
+	s.filtered.Add(1)
+	slog.Debug("Адрес отброшен фильтром адресов", "url", rawURL)
+	return false
+}
+
+// FilterProducts убирает товары, адреса которых находятся за пределами области обхода
+func (s *crawlScope) FilterProducts(products []Product) []Product {
+	if s == nil {
+		return products
+	}
+	kept := products[:0]
+	for _, product := range products {
+		if s.Allowed(product.URL) {
+			kept = append(kept, product)
+		}
+	}
+	return kept
+}
+
+// Rejected возвращает количество отклоненных адресов
+func (s *crawlScope) Rejected() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.rejected.Load()
+}
+
+// Filtered возвращает количество адресов, отброшенных фильтрами -include-url-regex и -exclude-url-regex
+func (s *crawlScope) Filtered() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.filtered.Load()
+}
+
+// String возвращает разрешенные префиксы и фильтры адресов для сообщений
+func (s *crawlScope) String() string {
+	if s == nil {
+		return ""
+	}
+	parts := []string{strings.Join(s.prefixes, ", ")}
+	if s.include != nil {
+		parts = append(parts, "только "+s.include.String())
+	}
+	if s.exclude != nil {
+		parts = append(parts, "кроме "+s.exclude.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// printScopeSummary выводит количество ссылок, отклоненных как находящиеся за пределами области обхода
+func printScopeSummary() {
+	if scope == nil {
+		return
+	}
+	fmt.Printf("Отклонено ссылок за пределами области обхода (%s): %d\n", strings.Join(scope.prefixes, ", "), scope.Rejected())
+	if scope.include != nil || scope.exclude != nil {
+		fmt.Printf("Отброшено адресов фильтрами -include-url-regex и -exclude-url-regex: %d\n", scope.Filtered())
+	}
+}
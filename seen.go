@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Режимы -dedupe-across-runs
+const (
+	seenOff  = "off"  // Известные товары не отличаются от новых
+	seenSkip = "skip" // Товары, найденные в прошлых запусках, пропускаются
+	seenMark = "mark" // Товары получают поля seen_before и first_seen
+)
+
+// Бакеты хранилища известных товаров: по ключу дедупликации и по хешу адреса
+var (
+	seenKeysBucket = []byte("keys")
+	seenURLsBucket = []byte("urls")
+)
+
+// seenRecord - когда товар был найден впервые и в последний раз
+type seenRecord struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// seenStore - множество товаров, найденных во всех прошлых запусках. В отличие от снимка
+// -incremental, товары из него не удаляются: товар, однажды найденный, остается известным,
+// даже если временно пропадал из каталога. Товар считается известным по ключу дедупликации
+// или по адресу страницы, так что смена ID при переиндексации Bitrix его не делает новым
+type seenStore struct {
+	db   *bolt.DB
+	mode string
+}
+
+// openSeenStore открывает (или создает) файл известных товаров
+func openSeenStore(filename, mode string) (*seenStore, error) {
+	db, err := bolt.Open(filename, 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть хранилище известных товаров %s: %v", filename, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{seenKeysBucket, seenURLsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &seenStore{db: db, mode: mode}, nil
+}
+
+// Close закрывает файл хранилища
+func (s *seenStore) Close() error {
+	return s.db.Close()
+}
+
+// seenURLKey - хеш адреса товара без протокола, www и завершающего слэша
+func seenURLKey(rawURL string) []byte {
+	normalized := strings.TrimPrefix(strings.TrimPrefix(rawURL, "https://"), "http://")
+	normalized = strings.TrimSuffix(strings.TrimPrefix(normalized, "www."), "/")
+	sum := sha256.Sum256([]byte(normalized))
+	return sum[:16]
+}
+
+// lookup возвращает запись о товаре, если он встречался в прошлых запусках
+func (s *seenStore) lookup(product Product) (seenRecord, bool) {
+	var record seenRecord
+	found := false
+
+	s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(seenKeysBucket).Get([]byte(dedupeBy.Key(product)))
+		if data == nil && product.URL != "" {
+			data = tx.Bucket(seenURLsBucket).Get(seenURLKey(product.URL))
+		}
+		if data != nil && json.Unmarshal(data, &record) == nil {
+			found = true
+		}
+		return nil
+	})
+
+	return record, found
+}
+
+// Apply применяет режим к товару: в режиме skip для известного товара возвращает false,
+// в режиме mark заполняет SeenBefore и FirstSeen
+func (s *seenStore) Apply(product Product, now time.Time) (Product, bool) {
+	if s == nil {
+		return product, true
+	}
+
+	record, found := s.lookup(product)
+	switch s.mode {
+	case seenSkip:
+		return product, !found
+	case seenMark:
+		product.SeenBefore = found
+		product.FirstSeen = now.Format("2006-01-02")
+		if found {
+			product.FirstSeen = record.FirstSeen.Format("2006-01-02")
+		}
+	}
+	return product, true
+}
+
+// Filter применяет режим ко всем товарам и возвращает оставшиеся
+func (s *seenStore) Filter(products []Product, now time.Time) []Product {
+	if s == nil {
+		return products
+	}
+	kept := make([]Product, 0, len(products))
+	for _, product := range products {
+		if product, keep := s.Apply(product, now); keep {
+			kept = append(kept, product)
+		}
+	}
+	return kept
+}
+
+// Commit добавляет товары запуска в хранилище и обновляет время, когда они встречались последними
+func (s *seenStore) Commit(products []Product, now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(seenKeysBucket)
+		urls := tx.Bucket(seenURLsBucket)
+
+		for _, product := range products {
+			key := dedupeBy.Key(product)
+			if key == "" {
+				continue
+			}
+
+			// Товар с новым ID после переиндексации найден по адресу и сохраняет дату первой встречи
+			record := seenRecord{FirstSeen: now, LastSeen: now}
+			var prev seenRecord
+			if data := keys.Get([]byte(key)); data != nil && json.Unmarshal(data, &prev) == nil {
+				record.FirstSeen = prev.FirstSeen
+			} else if product.URL != "" {
+				if data := urls.Get(seenURLKey(product.URL)); data != nil && json.Unmarshal(data, &prev) == nil {
+					record.FirstSeen = prev.FirstSeen
+				}
+			}
+
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := keys.Put([]byte(key), data); err != nil {
+				return err
+			}
+			if product.URL != "" {
+				if err := urls.Put(seenURLKey(product.URL), data); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// markup - CSS-селекторы выбранного сайта: значения адаптера по умолчанию,
+// переопределенные файлом -selectors
+var markup siteSelectors
+
+// siteSelectors - CSS-селекторы разметки сайта. Вынесены из кода адаптера, чтобы после
+// изменения верстки сайта селекторы можно было поправить в файле без пересборки парсера
+type siteSelectors struct {
+	// CategoryLinks - ссылки на категории на странице каталога; {catalog} заменяется путем каталога
+	CategoryLinks string `json:"category_links"`
+
+	// ProductCard - карточка товара в списке, ProductIDAttr - атрибут карточки с ID товара
+	ProductCard   string `json:"product_card"`
+	ProductIDAttr string `json:"product_id_attr"`
+	// Селекторы внутри карточки: ссылка с названием, цена, изображение, параметры
+	ProductName   string `json:"product_name"`
+	ProductPrice  string `json:"product_price"`
+	ProductImage  string `json:"product_image"`
+	ProductParams string `json:"product_params"`
+	// ProductAvailability - текст о наличии в карточке
+	ProductAvailability string `json:"product_availability"`
+
+	// Description - блоки описания на странице товара в порядке предпочтения
+	Description []string `json:"description"`
+	// DetailPrice - цена в верстке страницы товара, если ее нет в разметке schema.org
+	DetailPrice string `json:"detail_price"`
+	// DetailAvailability - текст о наличии и сроке поставки на странице товара
+	DetailAvailability string `json:"detail_availability"`
+	// Specs и Gallery - блоки характеристик и галереи изображений на странице товара
+	Specs   string `json:"specs"`
+	Gallery string `json:"gallery"`
+	// BrandLink - ссылка на страницу бренда на странице товара
+	BrandLink string `json:"brand_link"`
+	// BrandIndexLinks - ссылки на страницы брендов на странице списка брендов (-brand-pages)
+	BrandIndexLinks string `json:"brand_index_links"`
+	// Breadcrumbs - ссылки навигационной цепочки, если на странице нет разметки BreadcrumbList
+	Breadcrumbs string `json:"breadcrumbs"`
+
+	// Pagination - блоки пагинации, NextPage - кнопки перехода на следующую страницу
+	Pagination string `json:"pagination"`
+	NextPage   string `json:"next_page"`
+}
+
+// categoryLinks возвращает селектор ссылок на категории с подставленным путем каталога
+func (s siteSelectors) categoryLinks() string {
+	return strings.ReplaceAll(s.CategoryLinks, "{catalog}", catalogPath())
+}
+
+// validate проверяет, что все селекторы заданы и разбираются. Пустой селектор или селектор
+// с ошибкой не находит ничего, и парсер молча выдал бы пустой каталог
+func (s siteSelectors) validate() error {
+	v := reflect.ValueOf(s)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("json")
+
+		var values []string
+		switch field := v.Field(i).Interface().(type) {
+		case string:
+			values = []string{field}
+		case []string:
+			values = field
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("селектор %s не задан", name)
+		}
+
+		for _, value := range values {
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("селектор %s не задан", name)
+			}
+			// Имя атрибута - не селектор
+			if name == "product_id_attr" {
+				continue
+			}
+			if _, err := cascadia.ParseGroup(strings.ReplaceAll(value, "{catalog}", "/")); err != nil {
+				return fmt.Errorf("селектор %s %q: %v", name, value, err)
+			}
+		}
+	}
+	return nil
+}
+
+// siteRules - раздел сайта в файле -selectors: селекторы и проверки для команды test-rules
+type siteRules struct {
+	siteSelectors
+	Assertions []ruleAssertion `json:"assertions"`
+}
+
+// loadSelectors переопределяет селекторы сайта siteName значениями из JSON-файла вида
+// {"stanki.ru": {"product_price": ".price", "assertions": [...]}}. Не указанные в файле селекторы
+// остаются значениями адаптера; неизвестные ключи считаются ошибкой, чтобы опечатка не прошла
+// незамеченной. Вместе с селекторами возвращаются проверки разбора (см. rules.go)
+func loadSelectors(filename, siteName string, defaults siteSelectors) (siteSelectors, []ruleAssertion, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return defaults, nil, err
+	}
+
+	var sites map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sites); err != nil {
+		return defaults, nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	var raw json.RawMessage
+	found := false
+	for name, value := range sites {
+		if strings.EqualFold(name, siteName) {
+			raw, found = value, true
+			break
+		}
+	}
+	if !found {
+		return defaults, nil, fmt.Errorf("%s: нет селекторов для сайта %s", filename, siteName)
+	}
+
+	rules := siteRules{siteSelectors: defaults}
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return defaults, nil, fmt.Errorf("%s: сайт %s: %v", filename, siteName, err)
+	}
+
+	if err := rules.validate(); err != nil {
+		return defaults, nil, fmt.Errorf("%s: сайт %s: %v", filename, siteName, err)
+	}
+	for i := range rules.Assertions {
+		// Образцы страниц ищутся рядом с файлом селекторов, а не в текущем каталоге
+		if page := rules.Assertions[i].Page; page != "" && !isLivePage(page) && !filepath.IsAbs(page) {
+			rules.Assertions[i].Page = filepath.Join(filepath.Dir(filename), page)
+		}
+		if err := rules.Assertions[i].compile(); err != nil {
+			return defaults, nil, fmt.Errorf("%s: сайт %s: проверка %d: %v", filename, siteName, i+1, err)
+		}
+	}
+	return rules.siteSelectors, rules.Assertions, nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Пакеты протокола SFTP версии 3, которых достаточно для загрузки файла
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpWrite   = 6
+	sftpRemove  = 13
+	sftpRename  = 18
+	sftpStatus  = 101
+	sftpHandle  = 102
+
+	sftpFlagWrite  = 0x02
+	sftpFlagCreate = 0x08
+	sftpFlagTrunc  = 0x10
+
+	// sftpChunk - размер блока записи; серверы OpenSSH принимают блоки до 256 КБ, 32 КБ - все
+	sftpChunk = 32 * 1024
+)
+
+// sshConfig собирает настройки SSH: ключ -upload-key и/или пароль, проверка ключа сервера
+// по -upload-known-hosts. Неизвестный сервер - ошибка: файлы с ценами не отправляются кому попало
+func (d *fileDelivery) sshConfig() (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if d.keyFile != "" {
+		key, err := os.ReadFile(d.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ключ SSH: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("ключ SSH %s: %v", d.keyFile, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if d.password != "" {
+		auth = append(auth, ssh.Password(d.password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("для SFTP нужен ключ -upload-key или пароль в адресе или в %s", uploadPasswordEnv)
+	}
+
+	hostKeys, err := knownhosts.New(d.knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("файл известных серверов: %v", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            d.user(),
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// sftpConn - соединение SFTP поверх SSH. Запросы выполняются по одному: для нескольких
+// файлов результатов за запуск конвейер запросов не нужен
+type sftpConn struct {
+	client *ssh.Client
+	in     io.WriteCloser
+	out    io.Reader
+	nextID uint32
+}
+
+func dialSFTP(ctx context.Context, d *fileDelivery) (uploadConn, error) {
+	config, err := d.sshConfig()
+	if err != nil {
+		return nil, err
+	}
+	host := d.target.Host
+	if d.target.Port() == "" {
+		host = net.JoinHostPort(d.target.Hostname(), "22")
+	}
+
+	dialer := net.Dialer{Timeout: config.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, host, config)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	in, err := session.StdinPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("сервер не поддерживает SFTP: %v", err)
+	}
+
+	c := &sftpConn{client: client, in: in, out: out}
+	if err := c.send(sftpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	kind, _, err := c.recv()
+	if err == nil && kind != sftpVersion {
+		err = fmt.Errorf("неожиданный пакет %d", kind)
+	}
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("ошибка инициализации SFTP: %v", err)
+	}
+	return c, nil
+}
+
+func (c *sftpConn) Close() error {
+	c.in.Close()
+	return c.client.Close()
+}
+
+// send отправляет пакет: длина, тип и данные
+func (c *sftpConn) send(kind byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	packet = append(packet, kind)
+	_, err := c.in.Write(append(packet, payload...))
+	return err
+}
+
+// recv читает пакет и возвращает его тип и данные без ID запроса
+func (c *sftpConn) recv() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.out, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > 1<<20 {
+		return 0, nil, fmt.Errorf("некорректная длина пакета SFTP: %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(c.out, payload); err != nil {
+		return 0, nil, err
+	}
+	if header[4] != sftpVersion {
+		if len(payload) < 4 {
+			return 0, nil, fmt.Errorf("короткий пакет SFTP")
+		}
+		payload = payload[4:]
+	}
+	return header[4], payload, nil
+}
+
+// request отправляет запрос с очередным ID и ждет ответ
+func (c *sftpConn) request(kind byte, fields ...[]byte) (byte, []byte, error) {
+	c.nextID++
+	payload := binary.BigEndian.AppendUint32(nil, c.nextID)
+	for _, field := range fields {
+		payload = append(payload, field...)
+	}
+	if err := c.send(kind, payload); err != nil {
+		return 0, nil, err
+	}
+	return c.recv()
+}
+
+// sftpString кодирует строку протокола: длина и байты
+func sftpString(s string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(s))), s...)
+}
+
+// expectStatus проверяет, что ответ - SSH_FX_OK
+func expectStatus(kind byte, payload []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	if kind != sftpStatus || len(payload) < 4 {
+		return fmt.Errorf("неожиданный ответ SFTP: пакет %d", kind)
+	}
+	if code := binary.BigEndian.Uint32(payload); code != 0 {
+		return fmt.Errorf("ошибка SFTP %d: %s", code, sftpReadString(payload[4:]))
+	}
+	return nil
+}
+
+// sftpReadString извлекает строку протокола: текст ошибки из SSH_FXP_STATUS или дескриптор из SSH_FXP_HANDLE
+func sftpReadString(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	n := binary.BigEndian.Uint32(data)
+	if int(n) > len(data)-4 {
+		return ""
+	}
+	return string(data[4 : 4+n])
+}
+
+// Put загружает файл во временный remote.part и переименовывает его. Прежний файл с тем же
+// именем удаляется перед переименованием: в SFTP v3 RENAME не заменяет существующий файл
+func (c *sftpConn) Put(ctx context.Context, local, remote string) error {
+	stop := context.AfterFunc(ctx, func() { c.client.Close() })
+	defer stop()
+
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	part := remote + uploadPartSuffix
+	flags := binary.BigEndian.AppendUint32(nil, sftpFlagWrite|sftpFlagCreate|sftpFlagTrunc)
+	attrs := binary.BigEndian.AppendUint32(nil, 0)
+	kind, payload, err := c.request(sftpOpen, sftpString(part), flags, attrs)
+	if err != nil {
+		return err
+	}
+	if kind != sftpHandle {
+		return fmt.Errorf("не удалось создать %s: %w", part, expectStatus(kind, payload, nil))
+	}
+	handle := sftpReadString(payload)
+
+	buf := make([]byte, sftpChunk)
+	var offset uint64
+	for {
+		n, readErr := f.Read(buf)
+		if n > 0 {
+			err = expectStatus(c.request(sftpWrite, sftpString(handle), binary.BigEndian.AppendUint64(nil, offset), sftpString(string(buf[:n]))))
+			if err != nil {
+				c.request(sftpClose, sftpString(handle))
+				return fmt.Errorf("запись %s: %w", part, err)
+			}
+			offset += uint64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			c.request(sftpClose, sftpString(handle))
+			return readErr
+		}
+	}
+	if err := expectStatus(c.request(sftpClose, sftpString(handle))); err != nil {
+		return fmt.Errorf("закрытие %s: %w", part, err)
+	}
+
+	c.request(sftpRemove, sftpString(remote))
+	if err := expectStatus(c.request(sftpRename, sftpString(part), sftpString(remote))); err != nil {
+		return fmt.Errorf("переименование %s в %s: %w", part, filepath.Base(remote), err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// shardIndex возвращает номер части (с 0), в которую попадает товар с этим ID.
+// Хеш FNV-1a не зависит от запуска, поэтому товар всегда попадает в одну и ту же часть
+func shardIndex(id string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// splitShards распределяет товары по shards частям, сохраняя их порядок внутри части
+func splitShards(products []Product, shards int) [][]Product {
+	parts := make([][]Product, max(shards, 1))
+	for _, product := range products {
+		i := shardIndex(product.ID, len(parts))
+		parts[i] = append(parts[i], product)
+	}
+	return parts
+}
+
+// shardedSink направляет товары в потоковые выводы частей по хешу ID
+type shardedSink struct {
+	sinks []productSink
+}
+
+// WriteProduct записывает товар в вывод его части
+func (s *shardedSink) WriteProduct(product Product) error {
+	return s.sinks[shardIndex(product.ID, len(s.sinks))].WriteProduct(product)
+}
+
+// Close закрывает выводы всех частей
+func (s *shardedSink) Close() error {
+	var errs []error
+	for _, sink := range s.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// openShardedSink открывает потоковый вывод для каждого из файлов filenames.
+// Для одного файла возвращается сам вывод, для нескольких - shardedSink
+func openShardedSink(filenames []string, open func(filename string) (productSink, error)) (productSink, error) {
+	if len(filenames) == 1 {
+		return open(filenames[0])
+	}
+
+	s := &shardedSink{}
+	for _, filename := range filenames {
+		sink, err := open(filename)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.sinks = append(s.sinks, sink)
+	}
+	return s, nil
+}
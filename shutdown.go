@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// partialResultsFile - файл, в который сохраняются товары прерванного запуска.
+// Имя строится по шаблону -out-name
+var partialResultsFile = defaultOutputName + ".partial.json"
+
+// newRunContext создает контекст запуска, который отменяется при получении SIGINT или SIGTERM,
+// по истечении maxDuration (если оно больше нуля) или вызовом возвращаемой функции с причиной отмены.
+// После отмены новые запросы не начинаются, а выполняющиеся прерываются.
+// Повторный сигнал завершает процесс немедленно
+func newRunContext(maxDuration time.Duration) (context.Context, context.CancelCauseFunc) {
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancelCause := context.WithCancelCause(signalCtx)
+	// stop отменяет и signalCtx, поэтому отмену вызовом cancel нужно отличать от сигнала
+	var cancelled atomic.Bool
+	cancel := func(cause error) {
+		cancelled.Store(true)
+		cancelCause(cause)
+		stop()
+	}
+
+	if maxDuration > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, maxDuration)
+		cancel = func(cause error) {
+			cancelled.Store(true)
+			// Причина передается контексту тайм-аута от родителя; отмененный первым,
+			// он получил бы вместо нее context.Canceled
+			cancelCause(cause)
+			cancelTimeout()
+			stop()
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		// Возвращаем стандартную обработку сигналов, чтобы повторный Ctrl+C сработал сразу
+		stop()
+
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, context.DeadlineExceeded):
+			slog.Warn("Истекло максимальное время работы: новые запросы не выполняются, собранные товары будут сохранены", "max_duration", maxDuration, "file", partialResultsFile)
+		case !cancelled.Load() && signalCtx.Err() != nil:
+			slog.Warn("Получен сигнал завершения: новые запросы не выполняются, собранные товары будут сохранены. Повторный сигнал завершит работу немедленно", "file", partialResultsFile)
+		case cause != context.Canceled:
+			slog.Warn("Работа прервана: новые запросы не выполняются, собранные товары будут сохранены", "reason", cause, "file", partialResultsFile)
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// savePartialResults сохраняет товары прерванного запуска и закрывает потоковые выводы.
+// Cookie тоже сохраняются, чтобы следующий запуск продолжил ту же сессию
+func savePartialResults(products []Product, sinks []productSink) {
+	cookies.Save()
+
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			slog.Error("Ошибка при закрытии потокового вывода", "err", err)
+		}
+	}
+
+	products = removeDuplicateProducts(products)
+	if err := saveToJSON(products, partialResultsFile); err != nil {
+		slog.Error("Ошибка при сохранении частичных результатов", "file", partialResultsFile, "err", err)
+		return
+	}
+
+	saveRunMetadata(partialResultsFile, "json", len(products))
+
+	fmt.Printf("Работа прервана. Сохранено %d товаров в файл %s\n", len(products), partialResultsFile)
+}
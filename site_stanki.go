@@ -0,0 +1,396 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func init() {
+	registerSiteAdapter(stankiAdapter{})
+}
+
+// stankiPageParam - параметр пагинации большинства категорий stanki.ru: список товаров - второй
+// компонент с постраничной навигацией на странице
+const stankiPageParam = "PAGEN_2"
+
+// stankiNavPageCountRe находит число страниц в параметрах пагинации Bitrix в скриптах:
+// "NavPageCount":12 или NavPageCount = '12'
+var stankiNavPageCountRe = regexp.MustCompile(`NavPageCount["']?\s*[:=]\s*["']?(\d+)`)
+
+// stankiAdapter - адаптер сайта stanki.ru на Bitrix: карточки товаров с data-product-id,
+// пагинация параметром PAGEN_<компонент>, обычно PAGEN_2
+type stankiAdapter struct{}
+
+// Адреса сайта и раздела каталога
+func (stankiAdapter) Name() string        { return "stanki.ru" }
+func (stankiAdapter) BaseURL() string     { return "https://www.stanki.ru" }
+func (stankiAdapter) CatalogPath() string { return "/catalog/" }
+func (stankiAdapter) BrandsPath() string  { return "/brands/" }
+
+// Selectors возвращает селекторы верстки stanki.ru
+func (stankiAdapter) Selectors() siteSelectors {
+	return siteSelectors{
+		CategoryLinks:       "a[href^='{catalog}']",
+		ProductCard:         "[data-product-id]",
+		ProductIDAttr:       "data-product-id",
+		ProductName:         ".productCard__name",
+		ProductPrice:        ".productCard__price",
+		ProductImage:        ".productCard__preview img",
+		ProductParams:       ".productCard__params p",
+		ProductAvailability: ".productCard__availability, .productCard__stock, .productCard__status",
+		Description:         []string{".product__description", ".product-description", ".description"},
+		DetailPrice:         ".product__price, .product-price",
+		DetailAvailability:  ".product__availability, .product-availability, .product__stock, .product__status",
+		Specs:               ".product__specs, .product-features, .specifications",
+		Gallery:             ".product__gallery, .product-gallery, .product__images, .product-images, .product__slider, .gallery",
+		BrandLink:           ".product__brand a, .product-brand a, .product__info a[href*='/brands/']",
+		BrandIndexLinks:     "a[href^='/brands/'][href$='/']:not([href='/brands/'])",
+		Breadcrumbs:         ".breadcrumbs a, .breadcrumb a, .bx-breadcrumb a",
+		Pagination:          ".pagination, .paginations, .nav-links, .pager, .pages, .pagenation, .modern-page-navigation",
+		NextPage:            "[data-pagination-button], [data-pagination-more]",
+	}
+}
+
+// ParseCategories выбирает ссылки на разделы каталога: в адресах категорий есть "_", а страницы товаров оканчиваются на .html
+func (stankiAdapter) ParseCategories(doc *goquery.Document) []Category {
+	var categories []Category
+
+	// Выбираем ссылки внутри блока каталога
+	doc.Find(markup.categoryLinks()).Each(func(i int, s *goquery.Selection) {
+		href, exists := s.Attr("href")
+		if !exists {
+			return
+		}
+
+		// Фильтруем технические URL и страницы конкретных товаров
+		if strings.Contains(href, "_") && !strings.Contains(href, ".html") {
+			name := strings.TrimSpace(s.Text())
+			if name != "" && len(name) < 100 { // Проверка на валидность имени
+				categories = append(categories, Category{
+					Name: name,
+					URL:  baseURL + href,
+				})
+			}
+		}
+	})
+
+	return categories
+}
+
+// Pagination определяет параметр PAGEN_N по ссылкам пагинации страницы; до первой страницы
+// и без ссылок используется PAGEN_2. Если найден AJAX-адрес компонента списка, страницы после
+// первой загружаются фрагментами через него, в том числе у категорий с одной кнопкой «Показать ещё»
+// При -full-listings вместо обычных страниц запрашивается «Все» или наибольшее число товаров на странице
+func (a stankiAdapter) Pagination(doc *goquery.Document) Pagination {
+	if doc == nil {
+		return withListingParams(bitrixPagination{param: stankiPageParam}, listing.Params)
+	}
+	base := detectBitrixPagination(doc, stankiPageParam)
+	var pager Pagination = base
+	if ajax, ok := detectBitrixAjaxPagination(doc, base); ok {
+		pager = ajax
+	}
+
+	var params []string
+	if listing.Full {
+		shown := doc.Find(markup.ProductCard).Length()
+		if size := detectBitrixListingSize(doc, base, shown, a.LastPage(doc)*shown, listing.MaxItems); size != "" {
+			params = append(params, size)
+		}
+	}
+	if listing.Params != "" {
+		params = append(params, listing.Params)
+	}
+	return withListingParams(pager, strings.Join(params, "&"))
+}
+
+// ParseProductList извлекает товары с текущей страницы и проверяет наличие следующей страницы.
+// Если priceOnly установлен, изображения и параметры товаров не извлекаются
+func (stankiAdapter) ParseProductList(doc *goquery.Document, category Category, priceOnly bool) ([]Product, bool) {
+	var products []Product
+
+	// Цены из данных аналитики разбираются, только если у какого-то товара нет видимой цены
+	var analyticsPrices map[string]string
+
+	doc.Find(markup.ProductCard).Each(func(i int, s *goquery.Selection) {
+		// Извлекаем ID товара
+		productID, exists := s.Attr(markup.ProductIDAttr)
+		if !exists {
+			return
+		}
+
+		// Извлекаем название товара
+		nameElement := s.Find(markup.ProductName)
+		name := strings.TrimSpace(nameElement.Text())
+
+		// Извлекаем URL товара
+		url, exists := nameElement.Attr("href")
+		if !exists {
+			return
+		}
+
+		// Извлекаем цену товара
+		price := strings.TrimSpace(s.Find(markup.ProductPrice).Text())
+		if price == "" {
+			if analyticsPrices == nil {
+				analyticsPrices = embeddedPrices(doc)
+			}
+			if fallback, ok := analyticsPrices[productID]; ok {
+				slog.Debug("Цена взята из данных аналитики страницы", "id", productID, "price", fallback)
+				price = fallback
+			}
+		}
+
+		// Наличие нужно и при мониторинге цен: цена без наличия мало что говорит
+		availability := s.Find(markup.ProductAvailability).First().Text()
+
+		if priceOnly {
+			product := Product{
+				ID:       productID,
+				Name:     name,
+				URL:      baseURL + url,
+				Price:    price,
+				Category: category.Name,
+				Locale:   siteLocale,
+			}
+			applyAvailabilityText(&product, availability)
+			products = append(products, product)
+			return
+		}
+
+		// Извлекаем URL изображения товара и его alt: в нем часто указана модель
+		imgURL, imgAlt := "", ""
+		s.Find(markup.ProductImage).Each(func(j int, img *goquery.Selection) {
+			if j == 0 { // Берем только первое изображение
+				src, exists := img.Attr("src")
+				if exists {
+					imgURL = src
+				}
+				imgAlt = cleanImageText(img.AttrOr("alt", ""))
+			}
+		})
+
+		// Извлекаем параметры товара
+		var features []string
+		var params []specPair
+		s.Find(markup.ProductParams).Each(func(j int, p *goquery.Selection) {
+			feature := strings.TrimSpace(p.Text())
+			if feature != "" {
+				features = append(features, feature)
+				params = append(params, splitSpecText(feature))
+			}
+		})
+
+		product := Product{
+			ID:       productID,
+			Name:     name,
+			URL:      baseURL + url,
+			Price:    price,
+			ImageURL: baseURL + imgURL,
+			ImageAlt: imgAlt,
+			Category: category.Name,
+			Features: features,
+			Specs:    specMap(params),
+			Locale:   siteLocale,
+		}
+		applyAvailabilityText(&product, availability)
+		fillBrandFromSpecs(&product)
+
+		// Не загружаем детальную информацию здесь, чтобы ускорить парсинг
+		// Детальная информация будет загружаться отдельно при необходимости
+
+		products = append(products, product)
+	})
+
+	// Проверяем наличие следующей страницы по параметру пагинации этой страницы
+	hasNextPage := false
+	pager := detectBitrixPagination(doc, stankiPageParam)
+
+	// 1. Проверяем наличие кнопок пагинации с data-pagination-button или data-pagination-more
+	doc.Find(markup.NextPage).Each(func(i int, s *goquery.Selection) {
+		// Проверяем атрибуты
+		for _, attr := range []string{"data-pagination-button", "data-pagination-more"} {
+			href, exists := s.Attr(attr)
+			if exists && isPageLink(pager, href) {
+				hasNextPage = true
+				return
+			}
+		}
+
+		// Проверяем класс кнопки "Следующая"
+		class, _ := s.Attr("class")
+		disabled, _ := s.Attr("disabled")
+		if strings.Contains(class, "button_next") && disabled == "" {
+			hasNextPage = true
+			return
+		}
+	})
+
+	// 2. Ищем элементы пагинации
+	if !hasNextPage {
+		// Ищем внутри пагинации ссылки на следующую страницу
+		doc.Find(markup.Pagination).Find("a, span, div, button").Each(func(i int, s *goquery.Selection) {
+			text := strings.ToLower(strings.TrimSpace(s.Text()))
+			class, _ := s.Attr("class")
+			href, hrefExists := s.Attr("href")
+
+			// Проверяем, не отключена ли кнопка
+			disabled, _ := s.Attr("disabled")
+			if disabled != "" {
+				return
+			}
+
+			// Проверяем текст, класс или href ссылки
+			if strings.Contains(text, "след") ||
+				strings.Contains(text, "next") ||
+				strings.Contains(text, "показать еще") ||
+				strings.Contains(class, "next") ||
+				strings.Contains(class, "button_next") ||
+				strings.Contains(class, "modern-page-next") ||
+				(hrefExists && isPageLink(pager, href)) {
+				hasNextPage = true
+				return
+			}
+		})
+	}
+
+	// 3. Ищем любые элементы, которые могут быть номерами страниц
+	if !hasNextPage {
+		// Ищем все ссылки, которые могут быть пагинацией
+		doc.Find("a").Each(func(i int, s *goquery.Selection) {
+			href, _ := s.Attr("href")
+			page, isPage := pager.PageNumber(href)
+			if !isPage {
+				return
+			}
+			// Если в текущем URL нет номера страницы, значит это первая страница;
+			// иначе нужна ссылка на страницу с большим номером
+			if currentPage, hasCurrent := pager.PageNumber(category.URL); !hasCurrent || page > currentPage {
+				hasNextPage = true
+				return
+			}
+		})
+	}
+
+	// 4. Анализируем HTML-код страницы на наличие скриптов с пагинацией
+	if !hasNextPage {
+		// Получаем весь HTML страницы
+		html, err := doc.Html()
+		if err == nil {
+			// Ищем специфичные для Bitrix скрипты пагинации
+			if strings.Contains(html, "NavPageNomer") && strings.Contains(html, "NavPageCount") {
+				// Проверяем, совпадает ли текущая страница с последней
+				if !strings.Contains(html, "NavPageNomer=NavPageCount") {
+					hasNextPage = true
+				}
+			}
+		}
+	}
+
+	// 5. Проверяем, есть ли на странице параметры для ajax-пагинации
+	if !hasNextPage {
+		doc.Find("script").Each(func(i int, s *goquery.Selection) {
+			script := s.Text()
+			if strings.Contains(script, "bxajaxid") && strings.Contains(script, "pagen") {
+				hasNextPage = true
+				return
+			}
+		})
+	}
+
+	return products, hasNextPage
+}
+
+// LastPage находит наибольший номер страницы в ссылках пагинации. Ссылки показывают только
+// ближайшие страницы, поэтому учитывается и NavPageCount из скриптов подгрузки Bitrix
+func (stankiAdapter) LastPage(doc *goquery.Document) int {
+	lastPage := 1
+	pager := detectBitrixPagination(doc, stankiPageParam)
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		if n, ok := pager.PageNumber(href); ok && n > lastPage {
+			lastPage = n
+		}
+	})
+	doc.Find("script").Each(func(_ int, s *goquery.Selection) {
+		for _, match := range stankiNavPageCountRe.FindAllStringSubmatch(s.Text(), -1) {
+			if n, err := strconv.Atoi(match[1]); err == nil && n > lastPage {
+				lastPage = n
+			}
+		}
+	})
+	return lastPage
+}
+
+// ParseProductDetails извлекает описание, характеристики, галерею и разметку schema.org со страницы товара
+func (stankiAdapter) ParseProductDetails(doc *goquery.Document, pageURL string) Product {
+	var product Product
+
+	// Разметка schema.org (JSON-LD, микроданные) стабильнее классов верстки, поэтому проверяется первой
+	if structured, ok := extractStructuredProduct(doc, pageURL); ok {
+		product.Name = structured.Name
+		product.Price = structured.Price
+		product.SKU = structured.SKU
+		product.Brand = structured.Brand
+		product.Manufacturer = structured.Manufacturer
+		product.Availability = structured.Availability
+		product.Images = structured.Images
+	}
+
+	// Извлекаем ID товара из URL
+	product.ID = productIDFromURL(pageURL)
+
+	// Без разметки schema.org название берем из заголовка страницы
+	if product.Name == "" {
+		product.Name = strings.Join(strings.Fields(doc.Find("h1").First().Text()), " ")
+	}
+
+	// Извлекаем описание товара из первого найденного блока
+	for _, selector := range markup.Description {
+		if product.Description = strings.TrimSpace(doc.Find(selector).Text()); product.Description != "" {
+			break
+		}
+	}
+
+	// Извлекаем характеристики товара
+	specs := extractSpecs(doc, markup.Specs)
+	for _, spec := range specs {
+		product.Features = append(product.Features, spec.String())
+	}
+	product.Specs = specMap(specs)
+
+	product.Gallery = extractGallery(doc, pageURL, markup.Gallery)
+	product.CategoryPath = extractBreadcrumbs(doc, markup.Breadcrumbs, product.Name)
+
+	// Бренд без разметки берем из характеристик, а без них - из ссылки на страницу бренда
+	fillBrandFromSpecs(&product)
+	if product.Brand == "" {
+		product.Brand = brandFromLink(doc, markup.BrandLink)
+	}
+	applyAvailabilityText(&product, doc.Find(markup.DetailAvailability).First().Text())
+
+	// Без цены в разметке schema.org ищем ее в данных аналитики:
+	// она нужна товарам, у которых в списке не было видимой цены
+	if product.Price == "" {
+		if price, ok := embeddedPriceFor(embeddedPrices(doc), product.ID); ok {
+			product.Price = price
+		}
+	}
+
+	// Торговые предложения: у товара с предложениями своей цены часто нет, тогда берем минимальную
+	product.Variants = extractVariants(doc)
+	if product.Price == "" {
+		product.Price = lowestVariantPrice(product.Variants)
+	}
+
+	// Последний вариант - цена в верстке страницы товара
+	if product.Price == "" {
+		product.Price = strings.Join(strings.Fields(doc.Find(markup.DetailPrice).First().Text()), " ")
+	}
+
+	return product
+}
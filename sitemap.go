@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Способы поиска товаров (-discovery)
+const (
+	discoveryPages   = "pages"   // Обход страниц категорий с пагинацией
+	discoverySitemap = "sitemap" // Адреса товаров и категорий из sitemap.xml
+)
+
+const (
+	// maxSitemapSize - предельный размер карты сайта после распаковки по протоколу sitemaps.org
+	maxSitemapSize = 50 << 20
+	// maxSitemapFiles ограничивает число загружаемых карт, если индексы ссылаются друг на друга
+	maxSitemapFiles = 1000
+)
+
+// sitemapDocument - карта сайта (urlset) или индекс карт (sitemapindex).
+// Корневой элемент не проверяется, поэтому одна структура разбирает оба вида
+type sitemapDocument struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemapCatalog - категории и товары каталога, найденные в картах сайта
+type sitemapCatalog struct {
+	Categories  []Category
+	ProductURLs []string
+}
+
+// sitemapGroup - товары из карты сайта, отнесенные к одной категории
+type sitemapGroup struct {
+	Category Category
+	Products []Product
+}
+
+// discoverSitemap загружает карты сайта из robots.txt (или /sitemap.xml, если там их нет),
+// рекурсивно обходит индексы карт и собирает адреса категорий и товаров каталога
+func discoverSitemap(ctx context.Context, delayMs int) (*sitemapCatalog, error) {
+	queue := robots.Sitemaps()
+	if len(queue) == 0 {
+		queue = []string{baseURL + "/sitemap.xml"}
+	}
+
+	catalog := &sitemapCatalog{}
+	seen := make(map[string]bool)
+	seenPages := make(map[string]bool)
+	loaded := 0
+
+	for len(queue) > 0 && len(seen) < maxSitemapFiles {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		if seen[sitemapURL] {
+			continue
+		}
+		seen[sitemapURL] = true
+
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("поиск по картам сайта прерван: %v", ctx.Err())
+		}
+
+		doc, err := fetchSitemap(ctx, sitemapURL, delayMs)
+		if err != nil {
+			status.CountError("sitemap")
+			slog.Error("Ошибка при загрузке карты сайта", "url", sitemapURL, "err", err)
+			continue
+		}
+		loaded++
+		stall.MarkPage()
+		slog.Info("Карта сайта", "url", sitemapURL, "urls", len(doc.URLs), "sitemaps", len(doc.Sitemaps))
+
+		for _, nested := range doc.Sitemaps {
+			if loc := strings.TrimSpace(nested.Loc); loc != "" && !seen[loc] {
+				queue = append(queue, loc)
+			}
+		}
+
+		for _, entry := range doc.URLs {
+			loc := strings.TrimSpace(entry.Loc)
+			if !scope.Allowed(loc) {
+				continue
+			}
+			pageURL, isProduct, ok := classifySitemapURL(loc)
+			if !ok || seenPages[pageURL] {
+				continue
+			}
+			seenPages[pageURL] = true
+
+			if isProduct {
+				catalog.ProductURLs = append(catalog.ProductURLs, pageURL)
+			} else {
+				catalog.Categories = append(catalog.Categories, Category{Name: categoryNameFromURL(pageURL), URL: pageURL})
+			}
+		}
+	}
+
+	if loaded == 0 {
+		return nil, fmt.Errorf("не удалось загрузить ни одной карты сайта")
+	}
+	if len(catalog.ProductURLs) == 0 {
+		return nil, fmt.Errorf("в картах сайта нет адресов товаров каталога")
+	}
+
+	return catalog, nil
+}
+
+// fetchSitemap загружает и разбирает карту сайта; сжатые карты (.xml.gz) распознаются
+// по сигнатуре gzip, так как сервер не всегда указывает Content-Encoding
+func fetchSitemap(ctx context.Context, sitemapURL string, delayMs int) (*sitemapDocument, error) {
+	if err := waitTurn(ctx, sitemapURL); err != nil {
+		return nil, err
+	}
+
+	resp, err := doRequestWithRetry(ctx, sitemapURL, 2, delayMs)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("код ответа %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSitemapSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("не удалось распаковать карту сайта: %v", err)
+		}
+		data, err = io.ReadAll(io.LimitReader(gz, maxSitemapSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("не удалось распаковать карту сайта: %v", err)
+		}
+	}
+	if len(data) > maxSitemapSize {
+		return nil, fmt.Errorf("карта сайта больше %d МБ", maxSitemapSize>>20)
+	}
+
+	var doc sitemapDocument
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Кодировка из объявления XML учитывается так же, как charset в Content-Type
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return newUTF8Reader(input, "text/xml; charset="+label)
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать карту сайта: %v", err)
+	}
+
+	return &doc, nil
+}
+
+// classifySitemapURL проверяет, что адрес относится к каталогу сайта, приводит его к адресу
+// основного хоста и определяет, товар это или категория. Страница товара оканчивается на .html
+// или числовым ID ("/catalog/stanki_tokarnye/12345/"), остальные адреса каталога - категории
+func classifySitemapURL(rawURL string) (pageURL string, isProduct bool, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery != "" {
+		return "", false, false
+	}
+
+	base, err := url.Parse(baseURL)
+	if err != nil || strings.TrimPrefix(u.Host, "www.") != strings.TrimPrefix(base.Host, "www.") {
+		return "", false, false
+	}
+
+	rest, found := strings.CutPrefix(u.Path, catalogPath())
+	rest = strings.Trim(rest, "/")
+	if !found || rest == "" {
+		return "", false, false
+	}
+
+	last := path.Base(rest)
+	if strings.HasSuffix(last, ".html") {
+		return baseURL + u.Path, true, true
+	}
+
+	pageURL = baseURL + strings.TrimSuffix(u.Path, "/") + "/"
+	return pageURL, isNumericID(last), true
+}
+
+// isNumericID проверяет, что элемент адреса состоит только из цифр
+func isNumericID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// groupSitemapProducts относит товары к категориям по самому длинному совпадающему префиксу адреса.
+// Товар без подходящей категории попадает в категорию по родительскому адресу, если onlyListed
+// не установлен; при onlyListed (заданы -categories или -limit) такие товары пропускаются
+func groupSitemapProducts(productURLs []string, categories []Category, onlyListed bool) []sitemapGroup {
+	groups := make([]sitemapGroup, 0, len(categories))
+	index := make(map[string]int)
+	for _, category := range categories {
+		index[category.URL] = len(groups)
+		groups = append(groups, sitemapGroup{Category: category})
+	}
+
+	for _, productURL := range productURLs {
+		categoryURL := ""
+		for _, category := range categories {
+			if strings.HasPrefix(productURL, category.URL) && len(category.URL) > len(categoryURL) {
+				categoryURL = category.URL
+			}
+		}
+
+		if categoryURL == "" {
+			if onlyListed {
+				continue
+			}
+			categoryURL = strings.TrimSuffix(productURL, "/")
+			categoryURL = categoryURL[:strings.LastIndex(categoryURL, "/")+1]
+			if _, ok := index[categoryURL]; !ok {
+				index[categoryURL] = len(groups)
+				groups = append(groups, sitemapGroup{Category: Category{Name: categoryNameFromURL(categoryURL), URL: categoryURL}})
+			}
+		}
+
+		group := &groups[index[categoryURL]]
+		group.Products = append(group.Products, Product{
+			ID:       productIDFromURL(productURL),
+			URL:      productURL,
+			Category: group.Category.Name,
+			Locale:   siteLocale,
+		})
+	}
+
+	// Категории без товаров не нужны: их страницы в режиме sitemap не загружаются
+	kept := groups[:0]
+	for _, group := range groups {
+		if len(group.Products) > 0 {
+			kept = append(kept, group)
+		}
+	}
+	return kept
+}
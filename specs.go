@@ -0,0 +1,341 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// maxSpecSpan ограничивает rowspan/colspan: ошибочные значения вроде 10000 не должны раздувать сетку
+const maxSpecSpan = 50
+
+// specPair - одна характеристика товара; Name пуст, если у характеристики нет названия
+type specPair struct {
+	Name  string
+	Value string
+}
+
+// String возвращает характеристику в виде "Название: значение", как она хранится в Features
+func (p specPair) String() string {
+	if p.Name == "" {
+		return p.Value
+	}
+	return p.Name + ": " + p.Value
+}
+
+// extractSpecs разбирает блоки характеристик containers: таблицы (с учетом rowspan/colspan
+// и вложенных таблиц), списки определений dl и списки li
+func extractSpecs(doc *goquery.Document, containers string) []specPair {
+	var pairs []specPair
+
+	// Вложенные друг в друга блоки разбираем один раз - по внешнему
+	blocks := doc.Find(containers).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.ParentsFiltered(containers).Length() == 0
+	})
+
+	blocks.Each(func(_ int, container *goquery.Selection) {
+		// Сам блок может быть таблицей, поэтому ищем и среди него, и внутри
+		tables := container.Filter("table").AddSelection(container.Find("table"))
+		tables.Each(func(_ int, table *goquery.Selection) {
+			// Вложенные таблицы разбираются вместе с ячейкой, в которой находятся
+			if table.ParentsUntilSelection(container).Filter("table").Length() == 0 {
+				pairs = append(pairs, parseSpecTable(table, "")...)
+			}
+		})
+
+		container.Find("dl").Each(func(_ int, dl *goquery.Selection) {
+			if dl.ParentsUntilSelection(container).Filter("table").Length() == 0 {
+				pairs = append(pairs, parseDefinitionList(dl)...)
+			}
+		})
+
+		container.Find("li").Each(func(_ int, li *goquery.Selection) {
+			if li.ParentsUntilSelection(container).Filter("table").Length() > 0 {
+				return
+			}
+			if pair, ok := parseSpecListItem(li); ok {
+				pairs = append(pairs, pair)
+			}
+		})
+	})
+
+	return pairs
+}
+
+// specCell - ячейка таблицы, занимающая одну или несколько позиций сетки
+type specCell struct {
+	sel       *goquery.Selection
+	text      string
+	header    bool // Ячейка th
+	spansRows bool // Ячейка с rowspan: общая для нескольких строк, это часть названия
+}
+
+// parseSpecTable раскладывает таблицу в сетку с учетом rowspan/colspan и превращает строки
+// в пары название-значение. Названием считаются ячейки th и ячейки, объединенные по строкам
+// (например, "Габариты" над строками "Длина", "Ширина"), значением - остальные ячейки строки.
+// prefix добавляется к названиям пар вложенной таблицы
+func parseSpecTable(table *goquery.Selection, prefix string) []specPair {
+	var pairs []specPair
+
+	// Продолжения ячеек с rowspan в следующих строках, по колонкам
+	var carry []*specCell
+	var carryLeft []int
+
+	rows := table.Find("tr").FilterFunction(func(_ int, tr *goquery.Selection) bool {
+		return tr.Closest("table").IsSelection(table)
+	})
+
+	rows.Each(func(_ int, tr *goquery.Selection) {
+		var row []*specCell
+		cells := tr.ChildrenFiltered("td, th")
+		next := 0
+
+		for col := 0; next < cells.Length() || col < len(carry); col++ {
+			if col < len(carry) && carryLeft[col] > 0 {
+				row = append(row, carry[col])
+				carryLeft[col]--
+				continue
+			}
+			if next >= cells.Length() {
+				continue
+			}
+
+			sel := cells.Eq(next)
+			next++
+
+			cell := &specCell{
+				sel:    sel,
+				text:   specText(sel.Nodes[0]),
+				header: goquery.NodeName(sel) == "th",
+			}
+			rowspan := specSpan(sel, "rowspan")
+			cell.spansRows = rowspan > 1
+
+			for k := 0; k < specSpan(sel, "colspan"); k++ {
+				for len(carry) <= col+k {
+					carry = append(carry, nil)
+					carryLeft = append(carryLeft, 0)
+				}
+				if rowspan > 1 {
+					carry[col+k] = cell
+					carryLeft[col+k] = rowspan - 1
+				}
+				row = append(row, cell)
+			}
+			col += specSpan(sel, "colspan") - 1
+		}
+
+		pairs = append(pairs, specRowPairs(row, prefix)...)
+	})
+
+	return pairs
+}
+
+// specRowPairs превращает строку сетки в пары, включая пары вложенных таблиц
+func specRowPairs(row []*specCell, prefix string) []specPair {
+	// Ячейка с colspan занимает несколько позиций, но учитывается один раз
+	var cells []*specCell
+	for i, cell := range row {
+		if i == 0 || cell != row[i-1] {
+			cells = append(cells, cell)
+		}
+	}
+	if len(cells) == 0 {
+		return nil
+	}
+
+	// Строка заголовков таблицы ("Характеристика | Значение") и строки-разделы из одной ячейки
+	// без значения пар не дают
+	allHeaders := true
+	for _, cell := range cells {
+		if !cell.header {
+			allHeaders = false
+		}
+	}
+	if allHeaders && len(cells) > 1 {
+		return nil
+	}
+
+	// Названием считаются ведущие ячейки th, объединенные по строкам и следующие за ними подзаголовки
+	// ("Габариты" | "Длина" | "1200 мм"), но хотя бы первая ячейка
+	nameEnd := 1
+	for nameEnd < len(cells)-1 && (cells[nameEnd].header || cells[nameEnd].spansRows || cells[nameEnd-1].spansRows) {
+		nameEnd++
+	}
+
+	var nameParts []string
+	if prefix != "" {
+		nameParts = append(nameParts, prefix)
+	}
+	for _, cell := range cells[:nameEnd] {
+		if cell.text != "" {
+			nameParts = append(nameParts, cell.text)
+		}
+	}
+	name := strings.Join(nameParts, " / ")
+
+	var pairs []specPair
+	var valueParts []string
+	for _, cell := range cells[nameEnd:] {
+		if cell.text != "" {
+			valueParts = append(valueParts, cell.text)
+		}
+
+		// Вложенная таблица дает собственные пары с названием строки в качестве префикса
+		cell.sel.Find("table").Each(func(_ int, nested *goquery.Selection) {
+			if nested.ParentsUntilSelection(cell.sel).Filter("table").Length() == 0 {
+				pairs = append(pairs, parseSpecTable(nested, name)...)
+			}
+		})
+	}
+
+	value := strings.Join(valueParts, " ")
+	switch {
+	case len(cells) == 1 && name != "":
+		// Одна ячейка на всю строку: либо "Название: значение" текстом, либо заголовок раздела
+		if pair := splitSpecText(cells[0].text); pair.Name != "" {
+			return append([]specPair{pair}, pairs...)
+		}
+		return pairs
+	case value != "":
+		return append([]specPair{{Name: name, Value: value}}, pairs...)
+	}
+	return pairs
+}
+
+// parseDefinitionList разбирает список dl: каждому dt соответствуют следующие за ним dd
+func parseDefinitionList(dl *goquery.Selection) []specPair {
+	var pairs []specPair
+
+	dl.ChildrenFiltered("dt, dd, div").Each(func(_ int, s *goquery.Selection) {
+		switch goquery.NodeName(s) {
+		case "div":
+			// Группы dt/dd в обертках div допускаются стандартом HTML
+			pairs = append(pairs, parseDefinitionList(s)...)
+		case "dt":
+			pairs = append(pairs, specPair{Name: specText(s.Nodes[0])})
+		case "dd":
+			value := specText(s.Nodes[0])
+			if len(pairs) == 0 || value == "" {
+				return
+			}
+			last := &pairs[len(pairs)-1]
+			if last.Value != "" {
+				last.Value += ", "
+			}
+			last.Value += value
+		}
+	})
+
+	// dt без dd значения не несут
+	result := pairs[:0]
+	for _, pair := range pairs {
+		if pair.Value != "" {
+			result = append(result, pair)
+		}
+	}
+	return result
+}
+
+// parseSpecListItem разбирает элемент списка: "Название: значение" текстом
+// или разметкой из отдельных элементов для названия и значения
+func parseSpecListItem(li *goquery.Selection) (specPair, bool) {
+	// Вложенные списки разбираются как отдельные элементы
+	if li.Find("li").Length() > 0 {
+		return specPair{}, false
+	}
+
+	children := li.Children()
+	if children.Length() >= 2 {
+		var parts []string
+		children.Each(func(_ int, s *goquery.Selection) {
+			if text := specText(s.Nodes[0]); text != "" {
+				parts = append(parts, text)
+			}
+		})
+		if len(parts) >= 2 {
+			name := strings.TrimSuffix(strings.TrimSpace(parts[0]), ":")
+			return specPair{Name: name, Value: strings.Join(parts[1:], " ")}, true
+		}
+	}
+
+	text := specText(li.Nodes[0])
+	if text == "" {
+		return specPair{}, false
+	}
+	return splitSpecText(text), true
+}
+
+// splitSpecText разбирает характеристику, записанную текстом "Название: значение".
+// Текст без названия возвращается как значение с пустым Name
+func splitSpecText(text string) specPair {
+	text = strings.TrimSpace(text)
+	if name, value, found := strings.Cut(text, ":"); found && strings.TrimSpace(name) != "" && strings.TrimSpace(value) != "" {
+		return specPair{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)}
+	}
+	return specPair{Value: text}
+}
+
+// specMap собирает характеристики с названиями в словарь для поля Specs.
+// Значения характеристик с одинаковым названием объединяются через запятую
+func specMap(pairs []specPair) map[string]string {
+	var specs map[string]string
+	for _, pair := range pairs {
+		if pair.Name == "" {
+			continue
+		}
+		if specs == nil {
+			specs = make(map[string]string)
+		}
+		if prev, ok := specs[pair.Name]; ok && prev != pair.Value {
+			specs[pair.Name] = prev + ", " + pair.Value
+			continue
+		}
+		specs[pair.Name] = pair.Value
+	}
+	return specs
+}
+
+// specSpan возвращает значение rowspan/colspan в допустимых пределах
+func specSpan(sel *goquery.Selection, attr string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(sel.AttrOr(attr, "1")))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return min(n, maxSpecSpan)
+}
+
+// specText возвращает текст элемента без вложенных таблиц, скриптов и стилей.
+// Блочные элементы и <br> разделяются пробелами, чтобы "5.5<br>кВт" не слипалось в "5.5кВт"
+func specText(n *html.Node) string {
+	var b strings.Builder
+
+	var walk func(n *html.Node, root bool)
+	walk = func(n *html.Node, root bool) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style":
+				return
+			case "table":
+				if !root {
+					return
+				}
+			case "br", "p", "div", "li", "td", "th", "tr", "dt", "dd", "ul", "ol":
+				b.WriteString(" ")
+				defer b.WriteString(" ")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, false)
+		}
+	}
+	walk(n, true)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// errStalled - причина отмены запуска, в котором долго не было прогресса
+var errStalled = errors.New("нет прогресса")
+
+// stall отслеживает прогресс обхода; nil означает, что контроль зависаний выключен
+var stall *stallMonitor
+
+// stallMonitor запоминает время последнего прогресса (обработанной страницы или товара)
+// и реагирует, если прогресса нет дольше заданного времени
+type stallMonitor struct {
+	last     atomic.Int64 // Время последнего прогресса, UnixNano
+	pages    atomic.Int64
+	products atomic.Int64
+}
+
+// MarkPage отмечает обработанную страницу категории
+func (m *stallMonitor) MarkPage() {
+	if m == nil {
+		return
+	}
+	m.pages.Add(1)
+	m.last.Store(time.Now().UnixNano())
+}
+
+// MarkProduct отмечает обработанный при обогащении товар
+func (m *stallMonitor) MarkProduct() {
+	if m == nil {
+		return
+	}
+	m.products.Add(1)
+	m.last.Store(time.Now().UnixNano())
+}
+
+// startStallMonitor включает контроль зависаний. Если страниц и товаров не было дольше timeout,
+// в файл сохраняется дамп горутин, а при action "abort" запуск отменяется через cancel,
+// так что собранные товары сохраняются как при Ctrl+C. При action "dump" работа продолжается.
+// Время вне разрешенного окна обхода и на паузе оператора прогрессом не считается, но и зависанием тоже.
+// Возвращает функцию, выключающую контроль
+func startStallMonitor(timeout time.Duration, action string, cancel context.CancelCauseFunc) func() {
+	m := &stallMonitor{}
+	m.last.Store(time.Now().UnixNano())
+	stall = m
+
+	done := make(chan struct{})
+	go func() {
+		interval := min(timeout/4, time.Minute)
+		if interval < time.Second {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				// Пауза по -crawl-window - ожидаемое отсутствие прогресса
+				if schedule != nil && !schedule.contains(now) {
+					m.last.Store(now.UnixNano())
+					continue
+				}
+				if paused, _ := manualPause.Paused(); paused {
+					m.last.Store(now.UnixNano())
+					continue
+				}
+
+				idle := now.Sub(time.Unix(0, m.last.Load()))
+				if idle < timeout {
+					continue
+				}
+
+				dumpFile, err := writeGoroutineDump(now)
+				if err != nil {
+					slog.Error("Не удалось сохранить дамп горутин", "err", err)
+				}
+				slog.Error("Нет прогресса обхода",
+					"idle", idle.Round(time.Second), "pages", m.pages.Load(), "products", m.products.Load(),
+					"goroutines", runtime.NumGoroutine(), "dump", dumpFile, "action", action)
+
+				if action == "abort" {
+					cancel(fmt.Errorf("%w в течение %v", errStalled, idle.Round(time.Second)))
+					return
+				}
+
+				// Следующий дамп - не раньше, чем через timeout
+				m.last.Store(now.UnixNano())
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// writeGoroutineDump сохраняет стеки всех горутин в файл stall-ГГГГММДД-ЧЧММСС.txt
+func writeGoroutineDump(now time.Time) (string, error) {
+	filename := "stall-" + now.Format("20060102-150405") + ".txt"
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if err := pprof.Lookup("goroutine").WriteTo(file, 2); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
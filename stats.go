@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// maxStatsHistoryRuns - сколько последних запусков хранится в файле истории
+const maxStatsHistoryRuns = 30
+
+// categoryPriceStats - статистика цен одной категории
+type categoryPriceStats struct {
+	Category     string  `json:"category"`
+	Products     int     `json:"products"`
+	Priced       int     `json:"priced"`
+	Min          float64 `json:"min"`
+	Max          float64 `json:"max"`
+	Median       float64 `json:"median"`
+	MissingRatio float64 `json:"missing_ratio"` // Доля товаров без распознанной цены
+}
+
+// statsRun - статистика одного запуска в файле истории
+type statsRun struct {
+	Time       time.Time            `json:"time"`
+	Categories []categoryPriceStats `json:"categories"`
+}
+
+// medianShift - категория, медиана цен которой заметно отличается от истории
+type medianShift struct {
+	Category string
+	Median   float64
+	Previous float64 // Медиана по прошлым запускам
+	Percent  float64
+}
+
+// computePriceStats считает минимальную, максимальную и медианную цену и долю товаров без цены
+// по каждой категории. Категории упорядочены по названию
+func computePriceStats(products []Product) []categoryPriceStats {
+	prices := make(map[string][]float64)
+	counts := make(map[string]int)
+
+	for _, product := range products {
+		counts[product.Category]++
+		if value, ok := parsePrice(product.Price); ok && value > 0 {
+			prices[product.Category] = append(prices[product.Category], value)
+		}
+	}
+
+	stats := make([]categoryPriceStats, 0, len(counts))
+	for category, count := range counts {
+		values := prices[category]
+		s := categoryPriceStats{
+			Category:     category,
+			Products:     count,
+			Priced:       len(values),
+			MissingRatio: float64(count-len(values)) / float64(count),
+		}
+		if len(values) > 0 {
+			sort.Float64s(values)
+			s.Min = values[0]
+			s.Max = values[len(values)-1]
+			s.Median = median(values)
+		}
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Category < stats[j].Category })
+	return stats
+}
+
+// median возвращает медиану отсортированного непустого списка
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// printPriceStats выводит статистику цен по категориям в консоль,
+// отмечая категории, медиана которых сдвинулась относительно истории
+func printPriceStats(stats []categoryPriceStats, shifts []medianShift) {
+	shifted := make(map[string]medianShift, len(shifts))
+	for _, shift := range shifts {
+		shifted[shift.Category] = shift
+	}
+
+	fmt.Println("Статистика цен по категориям:")
+	for _, s := range stats {
+		if s.Priced == 0 {
+			fmt.Printf("  %s: товаров %d, цены не найдены\n", s.Category, s.Products)
+			continue
+		}
+		fmt.Printf("  %s: товаров %d, мин %.0f, макс %.0f, медиана %.0f, без цены %.1f%%",
+			s.Category, s.Products, s.Min, s.Max, s.Median, s.MissingRatio*100)
+		if shift, ok := shifted[s.Category]; ok {
+			fmt.Printf(" [!] медиана изменилась на %+.1f%% (ранее %.0f)", shift.Percent, shift.Previous)
+		}
+		fmt.Println()
+	}
+}
+
+// loadStatsHistory читает файл истории; отсутствующий файл означает пустую историю
+func loadStatsHistory(filename string) ([]statsRun, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var history []statsRun
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("файл истории %s поврежден: %v", filename, err)
+	}
+	return history, nil
+}
+
+// saveStatsHistory добавляет статистику запуска в историю, оставляя последние maxStatsHistoryRuns запусков
+func saveStatsHistory(filename string, history []statsRun, run statsRun) error {
+	history = append(history, run)
+	if len(history) > maxStatsHistoryRuns {
+		history = history[len(history)-maxStatsHistoryRuns:]
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// findMedianShifts сравнивает медианы категорий с медианой их значений в прошлых запусках
+// и возвращает категории, где отклонение превышает thresholdPercent
+func findMedianShifts(stats []categoryPriceStats, history []statsRun, thresholdPercent float64) []medianShift {
+	previous := make(map[string][]float64)
+	for _, run := range history {
+		for _, s := range run.Categories {
+			if s.Priced > 0 {
+				previous[s.Category] = append(previous[s.Category], s.Median)
+			}
+		}
+	}
+
+	var shifts []medianShift
+	for _, s := range stats {
+		values := previous[s.Category]
+		if s.Priced == 0 || len(values) == 0 {
+			continue
+		}
+
+		sort.Float64s(values)
+		base := median(values)
+		if base == 0 {
+			continue
+		}
+
+		percent := (s.Median - base) / base * 100
+		if math.Abs(percent) > thresholdPercent {
+			shifts = append(shifts, medianShift{
+				Category: s.Category,
+				Median:   s.Median,
+				Previous: base,
+				Percent:  percent,
+			})
+		}
+	}
+
+	return shifts
+}
+
+// checkPriceStatsHistory сравнивает статистику запуска с историей, предупреждает о сдвигах медиан,
+// добавляет запуск в историю и возвращает найденные сдвиги
+func checkPriceStatsHistory(filename string, stats []categoryPriceStats, thresholdPercent float64) []medianShift {
+	history, err := loadStatsHistory(filename)
+	if err != nil {
+		slog.Error("Ошибка при чтении истории статистики цен", "file", filename, "err", err)
+		return nil
+	}
+
+	shifts := findMedianShifts(stats, history, thresholdPercent)
+	for _, shift := range shifts {
+		slog.Warn("Медиана цен категории заметно изменилась, проверьте извлечение цен",
+			"category", shift.Category, "median", shift.Median, "previous_median", shift.Previous,
+			"shift_percent", math.Round(shift.Percent*10)/10)
+	}
+
+	if err := saveStatsHistory(filename, history, statsRun{Time: time.Now(), Categories: stats}); err != nil {
+		slog.Error("Ошибка при сохранении истории статистики цен", "file", filename, "err", err)
+	}
+
+	return shifts
+}
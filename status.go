@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// status собирает сведения о ходе запуска для снимка состояния по SIGUSR1
+var status = newRunStatus()
+
+// categoryStatus - состояние обхода одной категории
+type categoryStatus struct {
+	page     int
+	products int
+	done     bool
+	err      string
+}
+
+// runStatus - текущее состояние запуска: категории, выполняющиеся запросы, очереди и ошибки
+type runStatus struct {
+	mu    sync.Mutex
+	start time.Time
+
+	categoriesTotal int
+	categories      map[string]*categoryStatus
+
+	inFlight map[string]time.Time // URL выполняющихся запросов и время их начала
+	errors   map[string]int       // Количество ошибок по виду
+
+	queues map[string]chan struct{} // Семафоры потоков: занято слотов из емкости
+
+	enrichTotal int
+	enrichDone  int
+}
+
+func newRunStatus() *runStatus {
+	return &runStatus{
+		start:      time.Now(),
+		categories: make(map[string]*categoryStatus),
+		inFlight:   make(map[string]time.Time),
+		errors:     make(map[string]int),
+		queues:     make(map[string]chan struct{}),
+	}
+}
+
+// SetCategories задает общее число категорий
+func (s *runStatus) SetCategories(total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.categoriesTotal = total
+}
+
+// CategoryPage отмечает обработанную страницу категории
+func (s *runStatus) CategoryPage(name string, page, products int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.category(name)
+	c.page, c.products = page, products
+}
+
+// CategoryDone отмечает завершение обхода категории; err - ошибка, если обход не удался
+func (s *runStatus) CategoryDone(name string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.category(name)
+	c.done = true
+	if err != nil {
+		c.err = err.Error()
+		s.errors["категории"]++
+	}
+}
+
+// category возвращает состояние категории, создавая его; вызывается под мьютексом
+func (s *runStatus) category(name string) *categoryStatus {
+	c, ok := s.categories[name]
+	if !ok {
+		c = &categoryStatus{}
+		s.categories[name] = c
+	}
+	return c
+}
+
+// RequestStarted отмечает начало запроса и возвращает функцию, отмечающую его завершение
+func (s *runStatus) RequestStarted(url string) func() {
+	s.mu.Lock()
+	s.inFlight[url] = time.Now()
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		delete(s.inFlight, url)
+		s.mu.Unlock()
+	}
+}
+
+// CountError увеличивает счетчик ошибок вида kind
+func (s *runStatus) CountError(kind string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[kind]++
+}
+
+// TrackQueue регистрирует семафор потоков, заполненность которого попадает в снимок
+func (s *runStatus) TrackQueue(name string, semaphore chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queues[name] = semaphore
+}
+
+// Enrich обновляет прогресс обогащения
+func (s *runStatus) Enrich(done, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enrichDone, s.enrichTotal = done, total
+}
+
+// ErrorCount возвращает количество ошибок указанных видов
+func (s *runStatus) ErrorCount(kinds ...string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for _, kind := range kinds {
+		total += s.errors[kind]
+	}
+	return total
+}
+
+// ErrorSummary возвращает количество ошибок по видам: "категории 1, товары 5"
+func (s *runStatus) ErrorSummary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kinds := make([]string, 0, len(s.errors))
+	for kind := range s.errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		parts = append(parts, fmt.Sprintf("%s %d", kind, s.errors[kind]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteSnapshot выводит текстовый снимок текущего состояния
+func (s *runStatus) WriteSnapshot(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "=== Состояние на %s (работает %v) ===\n", now.Format("2006-01-02 15:04:05"), now.Sub(s.start).Round(time.Second))
+	if paused, since := manualPause.Paused(); paused {
+		fmt.Fprintf(&b, "Пауза по команде оператора: %v\n", now.Sub(since).Round(time.Second))
+	}
+
+	done := 0
+	names := make([]string, 0, len(s.categories))
+	for name, c := range s.categories {
+		names = append(names, name)
+		if c.done {
+			done++
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(&b, "Категории: завершено %d из %d, в работе %d\n", done, s.categoriesTotal, len(s.categories)-done)
+	for _, name := range names {
+		c := s.categories[name]
+		state := "в работе"
+		switch {
+		case c.err != "":
+			state = "ошибка: " + c.err
+		case c.done:
+			state = "завершена"
+		}
+		fmt.Fprintf(&b, "  %s: стр. %d, товаров %d, %s\n", name, c.page, c.products, state)
+	}
+
+	if s.enrichTotal > 0 {
+		fmt.Fprintf(&b, "Обогащение: %d из %d, осталось %d\n", s.enrichDone, s.enrichTotal, s.enrichTotal-s.enrichDone)
+	}
+
+	queueNames := make([]string, 0, len(s.queues))
+	for name := range s.queues {
+		queueNames = append(queueNames, name)
+	}
+	sort.Strings(queueNames)
+	for _, name := range queueNames {
+		q := s.queues[name]
+		fmt.Fprintf(&b, "Потоки %s: занято %d из %d\n", name, len(q), cap(q))
+	}
+
+	if limiter != nil {
+		limiter.mu.Lock()
+		fmt.Fprintf(&b, "Задержка между запросами: %v\n", limiter.delay)
+		if limiter.jitter > 0 {
+			fmt.Fprintf(&b, "Случайная добавка к задержке: до %v\n", limiter.jitter)
+		}
+		limiter.mu.Unlock()
+	}
+
+	if len(s.errors) > 0 {
+		kinds := make([]string, 0, len(s.errors))
+		for kind := range s.errors {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		b.WriteString("Ошибки:")
+		for _, kind := range kinds {
+			fmt.Fprintf(&b, " %s %d;", kind, s.errors[kind])
+		}
+		b.WriteString("\n")
+	}
+
+	urls := make([]string, 0, len(s.inFlight))
+	for url := range s.inFlight {
+		urls = append(urls, url)
+	}
+	// Сначала самые долгие запросы - именно они интересны при зависании
+	sort.Slice(urls, func(i, j int) bool { return s.inFlight[urls[i]].Before(s.inFlight[urls[j]]) })
+	fmt.Fprintf(&b, "Выполняющиеся запросы: %d\n", len(urls))
+	for _, url := range urls {
+		fmt.Fprintf(&b, "  %s (%v)\n", url, now.Sub(s.inFlight[url]).Round(time.Millisecond))
+	}
+
+	io.WriteString(w, b.String())
+}
+
+// dumpStatus выводит снимок состояния в stdout или, если задан файл, записывает его туда
+func dumpStatus(filename string) {
+	if filename == "" {
+		status.WriteSnapshot(os.Stdout)
+		return
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		slog.Error("Не удалось записать снимок состояния", "file", filename, "err", err)
+		return
+	}
+	defer file.Close()
+
+	status.WriteSnapshot(file)
+	fmt.Printf("Состояние записано в файл %s\n", filename)
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// watchStatusSignal ничего не делает: SIGUSR1 есть только в unix-системах
+func watchStatusSignal(filename string) {}
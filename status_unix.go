@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchStatusSignal выводит снимок состояния при каждом получении SIGUSR1
+// (kill -USR1 <pid>), не прерывая работу
+func watchStatusSignal(filename string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		for range signals {
+			dumpStatus(filename)
+		}
+	}()
+}
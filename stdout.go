@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// stdoutOutput - значение -o, при котором результаты пишутся в stdout
+const stdoutOutput = "-"
+
+// resultsStdout - исходный stdout, в который пишутся результаты при -o -. Сообщения для человека
+// (fmt.Printf по всему парсеру) при этом уходят в stderr, чтобы не смешиваться с данными в конвейере
+var resultsStdout *os.File
+
+// useStdoutForResults забирает stdout под результаты и перенаправляет остальной вывод в stderr.
+// Вызывается до включения индикаторов прогресса, которые тоже подменяют os.Stdout
+func useStdoutForResults() {
+	resultsStdout = os.Stdout
+	os.Stdout = os.Stderr
+}
+
+// createResultFile создает файл результатов; для имени "-" возвращает stdout, который не закрывается.
+// Файл с расширением .gz сжимается в gzip по мере записи
+func createResultFile(filename string) (io.WriteCloser, error) {
+	if filename == stdoutOutput {
+		return stdoutWriter{resultsStdout}, nil
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(filename, ".gz") {
+		return newGzipFile(file, filename), nil
+	}
+	return file, nil
+}
+
+// stdoutWriter - stdout как файл результатов: Close не закрывает дескриптор
+type stdoutWriter struct {
+	io.Writer
+}
+
+func (stdoutWriter) Close() error { return nil }
+
+// writeResultBOM - писать BOM в начало файлов JSON и CSV; выключается флагом -no-bom
+var writeResultBOM = true
+
+// writeBOM записывает BOM для корректного отображения UTF-8 в Excel. В stdout BOM не пишется:
+// jq и другие программы конвейера его не ожидают
+func writeBOM(w io.Writer, filename string) error {
+	if filename == stdoutOutput || !writeResultBOM {
+		return nil
+	}
+	_, err := w.Write([]byte{0xEF, 0xBB, 0xBF})
+	return err
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// streamBroker публикует сообщение в топик Kafka или тему NATS
+type streamBroker interface {
+	Publish(key string, value []byte) error
+	Close() error
+}
+
+// streamSink публикует каждый товар отдельным сообщением, как только он готов, чтобы
+// потребители получали данные во время обхода, а не после сохранения файлов
+type streamSink struct {
+	mu     sync.Mutex
+	broker streamBroker
+	seen   map[string]bool // ключи дедупликации уже опубликованных товаров
+}
+
+// openStreamSink подключается к брокеру по адресу вида kafka://host:9092,host2:9092/топик
+// или nats://host:4222/тема. Схемы kafka+tls и nats+tls включают TLS, логин и пароль
+// из адреса используются для SASL PLAIN (Kafka) или входа на сервер NATS
+func openStreamSink(ctx context.Context, rawURL string) (*streamSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("некорректный адрес %q", rawURL)
+	}
+	target := strings.Trim(u.Path, "/")
+	if target == "" {
+		return nil, fmt.Errorf("в адресе %s не указан топик или тема", u.Redacted())
+	}
+
+	var broker streamBroker
+	switch u.Scheme {
+	case "kafka", "kafka+tls":
+		broker, err = openKafka(ctx, u, target)
+	case "nats", "nats+tls":
+		broker, err = openNATS(u, target)
+	default:
+		return nil, fmt.Errorf("неизвестная схема %q (допустимо: kafka, kafka+tls, nats, nats+tls)", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &streamSink{broker: broker, seen: make(map[string]bool)}, nil
+}
+
+// WriteProduct публикует товар в JSON с ID товара в качестве ключа. Дубликаты пропускаются
+// так же, как в NDJSON
+func (s *streamSink) WriteProduct(product Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := dedupeBy.Key(product)
+	if key == "" || s.seen[key] {
+		return nil
+	}
+	s.seen[key] = true
+
+	data, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	return s.broker.Publish(product.ID, data)
+}
+
+// Close дожидается отправки накопленных сообщений
+func (s *streamSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.broker.Close()
+}
+
+// streamHeaders - заголовки сообщения: по run_id потребитель отличает товары разных запусков
+func streamHeaders() map[string]string {
+	headers := map[string]string{"content-type": "application/json"}
+	if runMeta != nil {
+		headers["run_id"] = runMeta.RunID
+	}
+	return headers
+}
+
+// kafkaBroker отправляет сообщения пачками в фоне. Ключ - ID товара, поэтому все версии
+// товара попадают в один раздел и читаются по порядку, а в сжатом топике остается последняя
+type kafkaBroker struct {
+	ctx    context.Context
+	writer *kafka.Writer
+
+	mu       sync.Mutex
+	failed   int
+	firstErr error
+}
+
+// openKafka проверяет, что топик существует: запись в несуществующий топик в фоне
+// обнаружилась бы только по ошибкам доставки
+func openKafka(ctx context.Context, u *url.URL, topic string) (*kafkaBroker, error) {
+	transport := &kafka.Transport{DialTimeout: 30 * time.Second, ClientID: "parserEol"}
+	if u.Scheme == "kafka+tls" {
+		transport.TLS = &tls.Config{}
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		transport.SASL = plain.Mechanism{Username: u.User.Username(), Password: password}
+	}
+	addr := kafka.TCP(strings.Split(u.Host, ",")...)
+
+	checkCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	client := &kafka.Client{Addr: addr, Transport: transport}
+	meta, err := client.Metadata(checkCtx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("не удалось подключиться к Kafka: %v", err)
+	}
+	if len(meta.Topics) == 0 {
+		return nil, fmt.Errorf("топик %s не найден", topic)
+	}
+	if meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("топик %s: %v", topic, meta.Topics[0].Error)
+	}
+
+	b := &kafkaBroker{ctx: ctx}
+	b.writer = &kafka.Writer{
+		Addr:         addr,
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 100 * time.Millisecond,
+		Async:        true,
+		Transport:    transport,
+		Completion:   b.completed,
+	}
+	return b, nil
+}
+
+// completed учитывает сообщения, которые не удалось доставить после повторов
+func (b *kafkaBroker) completed(messages []kafka.Message, err error) {
+	if err == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failed += len(messages)
+	if b.firstErr == nil {
+		b.firstErr = err
+	}
+}
+
+func (b *kafkaBroker) Publish(key string, value []byte) error {
+	message := kafka.Message{Key: []byte(key), Value: value}
+	for name, header := range streamHeaders() {
+		message.Headers = append(message.Headers, kafka.Header{Key: name, Value: []byte(header)})
+	}
+	// В фоновом режиме WriteMessages только ставит сообщение в очередь
+	return b.writer.WriteMessages(b.ctx, message)
+}
+
+func (b *kafkaBroker) Close() error {
+	err := b.writer.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failed > 0 {
+		return fmt.Errorf("не доставлено сообщений в Kafka: %d: %v", b.failed, b.firstErr)
+	}
+	return err
+}
+
+// natsBroker публикует сообщения в тему NATS. Клиент буферизует их и при разрыве
+// соединения переподключается сам
+type natsBroker struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func openNATS(u *url.URL, subject string) (*natsBroker, error) {
+	scheme := "nats"
+	if u.Scheme == "nats+tls" {
+		scheme = "tls"
+	}
+	var servers []string
+	for _, host := range strings.Split(u.Host, ",") {
+		servers = append(servers, scheme+"://"+host)
+	}
+
+	options := []nats.Option{nats.Name("parserEol"), nats.Timeout(30 * time.Second), nats.MaxReconnects(-1)}
+	if u.User != nil {
+		// Адрес с одним именем без пароля - токен, как в nats://token@host
+		if password, ok := u.User.Password(); ok {
+			options = append(options, nats.UserInfo(u.User.Username(), password))
+		} else {
+			options = append(options, nats.Token(u.User.Username()))
+		}
+	}
+
+	conn, err := nats.Connect(strings.Join(servers, ","), options...)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось подключиться к NATS: %v", err)
+	}
+	return &natsBroker{conn: conn, subject: subject}, nil
+}
+
+func (b *natsBroker) Publish(key string, value []byte) error {
+	message := nats.NewMsg(b.subject)
+	message.Data = value
+	message.Header.Set("product_id", key)
+	for name, header := range streamHeaders() {
+		message.Header.Set(name, header)
+	}
+	return b.conn.PublishMsg(message)
+}
+
+func (b *natsBroker) Close() error {
+	defer b.conn.Close()
+	return b.conn.FlushTimeout(time.Minute)
+}
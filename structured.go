@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// structuredProduct - данные товара из разметки schema.org (JSON-LD или микроданные)
+type structuredProduct struct {
+	Name         string
+	SKU          string
+	Brand        string
+	Manufacturer string
+	Price        string
+	Availability string // Значение schema.org без префикса: InStock, OutOfStock, PreOrder...
+	Images       []string
+}
+
+// extractStructuredProduct извлекает товар из блоков application/ld+json и микроразметки
+// schema.org/Product. JSON-LD предпочтительнее, микроданные дополняют незаполненные поля.
+// Относительные адреса изображений разрешаются относительно pageURL
+func extractStructuredProduct(doc *goquery.Document, pageURL string) (structuredProduct, bool) {
+	product, found := jsonLDProduct(doc)
+	if micro, ok := microdataProduct(doc); ok {
+		product = mergeStructuredProducts(product, micro)
+		found = true
+	}
+	if !found {
+		return structuredProduct{}, false
+	}
+
+	base, err := url.Parse(pageURL)
+	for i, image := range product.Images {
+		if err != nil {
+			break
+		}
+		if u, err := base.Parse(image); err == nil {
+			product.Images[i] = u.String()
+		}
+	}
+
+	return product, true
+}
+
+// mergeStructuredProducts дополняет пустые поля primary значениями из secondary
+func mergeStructuredProducts(primary, secondary structuredProduct) structuredProduct {
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&primary.Name, secondary.Name)
+	fill(&primary.SKU, secondary.SKU)
+	fill(&primary.Brand, secondary.Brand)
+	fill(&primary.Manufacturer, secondary.Manufacturer)
+	fill(&primary.Price, secondary.Price)
+	fill(&primary.Availability, secondary.Availability)
+	if len(primary.Images) == 0 {
+		primary.Images = secondary.Images
+	}
+	return primary
+}
+
+// jsonLDProduct ищет объект с @type Product во всех блоках JSON-LD страницы,
+// включая массивы и @graph
+func jsonLDProduct(doc *goquery.Document) (structuredProduct, bool) {
+	var result structuredProduct
+	found := false
+
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s.Text())), &data); err != nil {
+			return true
+		}
+		if node := findJSONLDType(data, "Product"); node != nil {
+			result, found = parseJSONLDProduct(node), true
+			return false
+		}
+		return true
+	})
+
+	return result, found
+}
+
+// findJSONLDType рекурсивно ищет узел с типом want (Product, BreadcrumbList)
+func findJSONLDType(data interface{}, want string) map[string]interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if node := findJSONLDType(item, want); node != nil {
+				return node
+			}
+		}
+	case map[string]interface{}:
+		if jsonLDHasType(v["@type"], want) {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findJSONLDType(graph, want)
+		}
+	}
+	return nil
+}
+
+// jsonLDHasType проверяет @type, который может быть строкой или массивом строк
+func jsonLDHasType(value interface{}, want string) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.EqualFold(schemaName(v), want)
+	case []interface{}:
+		for _, item := range v {
+			if jsonLDHasType(item, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseJSONLDProduct извлекает поля из узла Product
+func parseJSONLDProduct(node map[string]interface{}) structuredProduct {
+	product := structuredProduct{
+		Name:         jsonLDString(node["name"]),
+		SKU:          jsonLDString(node["sku"]),
+		Brand:        jsonLDName(node["brand"]),
+		Manufacturer: jsonLDName(node["manufacturer"]),
+		Images:       jsonLDImages(node["image"]),
+	}
+	if product.SKU == "" {
+		product.SKU = jsonLDString(node["mpn"])
+	}
+
+	// offers может быть одним предложением, массивом или AggregateOffer с диапазоном цен
+	offers := node["offers"]
+	if list, ok := offers.([]interface{}); ok && len(list) > 0 {
+		offers = list[0]
+	}
+	if offer, ok := offers.(map[string]interface{}); ok {
+		product.Price = jsonLDString(offer["price"])
+		if product.Price == "" {
+			product.Price = jsonLDString(offer["lowPrice"])
+		}
+		product.Availability = schemaName(jsonLDString(offer["availability"]))
+	}
+	if price, ok := normalizeEmbeddedPrice(product.Price); ok {
+		product.Price = price
+	} else {
+		product.Price = ""
+	}
+
+	return product
+}
+
+// jsonLDString возвращает строковое или числовое значение
+func jsonLDString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		if len(v) > 0 {
+			return jsonLDString(v[0])
+		}
+	}
+	return ""
+}
+
+// jsonLDName возвращает название сущности, заданной строкой или объектом вида {"@type": "Brand", "name": "..."}
+func jsonLDName(value interface{}) string {
+	if node, ok := value.(map[string]interface{}); ok {
+		return jsonLDString(node["name"])
+	}
+	return jsonLDString(value)
+}
+
+// jsonLDImages возвращает адреса изображений: строка, массив строк или ImageObject
+func jsonLDImages(value interface{}) []string {
+	var images []string
+	switch v := value.(type) {
+	case string:
+		if v = strings.TrimSpace(v); v != "" {
+			images = append(images, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			images = append(images, jsonLDImages(item)...)
+		}
+	case map[string]interface{}:
+		if u := jsonLDString(v["contentUrl"]); u != "" {
+			images = append(images, u)
+		} else if u := jsonLDString(v["url"]); u != "" {
+			images = append(images, u)
+		}
+	}
+	return images
+}
+
+// microdataProduct извлекает товар из микроразметки itemscope itemtype="https://schema.org/Product"
+func microdataProduct(doc *goquery.Document) (structuredProduct, bool) {
+	scope := doc.Find("[itemscope][itemtype]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return strings.EqualFold(schemaName(s.AttrOr("itemtype", "")), "Product")
+	}).First()
+	if scope.Length() == 0 {
+		return structuredProduct{}, false
+	}
+
+	product := structuredProduct{
+		Name:  microdataValue(microdataProps(scope, "name").First()),
+		SKU:   microdataValue(microdataProps(scope, "sku").First()),
+		Brand: microdataValue(microdataProps(scope, "brand").First()),
+	}
+	if product.SKU == "" {
+		product.SKU = microdataValue(microdataProps(scope, "mpn").First())
+	}
+
+	// Бренд и производитель могут быть вложенной сущностью Brand или Organization со своим name
+	if brand := microdataProps(scope, "brand").First(); brand.Is("[itemscope]") {
+		product.Brand = microdataValue(microdataProps(brand, "name").First())
+	}
+	product.Manufacturer = microdataValue(microdataProps(scope, "manufacturer").First())
+	if manufacturer := microdataProps(scope, "manufacturer").First(); manufacturer.Is("[itemscope]") {
+		product.Manufacturer = microdataValue(microdataProps(manufacturer, "name").First())
+	}
+
+	microdataProps(scope, "image").Each(func(_ int, s *goquery.Selection) {
+		if image := microdataValue(s); image != "" {
+			product.Images = append(product.Images, image)
+		}
+	})
+
+	offer := microdataProps(scope, "offers").First()
+	if offer.Length() > 0 {
+		price := microdataValue(microdataProps(offer, "price").First())
+		if price == "" {
+			price = microdataValue(microdataProps(offer, "lowPrice").First())
+		}
+		if normalized, ok := normalizeEmbeddedPrice(price); ok {
+			product.Price = normalized
+		}
+		product.Availability = schemaName(microdataValue(microdataProps(offer, "availability").First()))
+	}
+
+	return product, true
+}
+
+// microdataProps возвращает свойства с именем prop, принадлежащие самой сущности scope,
+// а не вложенным в нее сущностям
+func microdataProps(scope *goquery.Selection, prop string) *goquery.Selection {
+	return scope.Find(fmt.Sprintf(`[itemprop~="%s"]`, prop)).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.Parent().Closest("[itemscope]").IsSelection(scope)
+	})
+}
+
+// microdataValue возвращает значение свойства по правилам микроданных:
+// content, адрес для ссылок и изображений, datetime или текст элемента
+func microdataValue(s *goquery.Selection) string {
+	if s.Length() == 0 {
+		return ""
+	}
+	if content, ok := s.Attr("content"); ok {
+		return strings.TrimSpace(content)
+	}
+	switch goquery.NodeName(s) {
+	case "a", "link", "area":
+		return strings.TrimSpace(s.AttrOr("href", ""))
+	case "img", "source", "video", "audio", "iframe", "embed":
+		return strings.TrimSpace(s.AttrOr("src", ""))
+	case "time":
+		if datetime, ok := s.Attr("datetime"); ok {
+			return strings.TrimSpace(datetime)
+		}
+	case "data", "meter":
+		if value, ok := s.Attr("value"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
+
+// schemaName убирает префикс словаря schema.org: "https://schema.org/InStock" -> "InStock"
+func schemaName(value string) string {
+	value = strings.TrimSpace(value)
+	if i := strings.LastIndex(value, "/"); i >= 0 && strings.Contains(strings.ToLower(value), "schema.org") {
+		return value[i+1:]
+	}
+	return value
+}
@@ -0,0 +1,102 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// initSystemd настраивает работу под управлением systemd:
+// периодические сигналы watchdog, если они включены в unit-файле.
+// Формат логов для журнала настраивает setupLogging.
+// Возвращает функцию, которую нужно вызвать при завершении работы
+func initSystemd() func() {
+	stopWatchdog := startWatchdog()
+
+	return func() {
+		stopWatchdog()
+		sdNotify("STOPPING=1")
+	}
+}
+
+// sdNotify отправляет сообщение менеджеру служб systemd (см. sd_notify(3)).
+// Без переменной NOTIFY_SOCKET ничего не делает
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+
+	// Адрес, начинающийся с @, относится к абстрактному пространству имен
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("Не удалось отправить уведомление systemd", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("Не удалось отправить уведомление systemd", "err", err)
+	}
+}
+
+// startWatchdog запускает отправку WATCHDOG=1 с половинным интервалом от WatchdogSec
+func startWatchdog() func() {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return func() {}
+	}
+
+	// Если watchdog предназначен другому процессу, не вмешиваемся
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return func() {}
+	}
+
+	interval := time.Duration(usec) * time.Microsecond / 2
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sdNotify("WATCHDOG=1")
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// underJournald проверяет, что stderr процесса подключен к журналу systemd:
+// systemd передает устройство и inode потока в переменной JOURNAL_STREAM
+func underJournald() bool {
+	stream := os.Getenv("JOURNAL_STREAM")
+	if stream == "" {
+		return false
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(int(os.Stderr.Fd()), &stat); err != nil {
+		return false
+	}
+
+	return stream == fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+}
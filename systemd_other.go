@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+// initSystemd ничего не делает на системах без systemd
+func initSystemd() func() {
+	return func() {}
+}
+
+// sdNotify ничего не делает на системах без systemd
+func sdNotify(state string) {}
+
+// underJournald всегда возвращает false: журнала systemd на этих системах нет
+func underJournald() bool {
+	return false
+}
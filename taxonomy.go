@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Режимы работы парсера (-mode)
+const (
+	modeProducts   = "products"   // Полный обход: категории, товары, обогащение
+	modeCategories = "categories" // Только дерево категорий с количеством товаров
+)
+
+var (
+	// categoryCountRe находит количество товаров, которое сайт сам выводит на странице категории
+	categoryCountRe = regexp.MustCompile(`(?i)найден[оа]?[\s\x{a0}]+(\d[\d\s\x{a0}]*?)[\s\x{a0}]*товар|товаров:?[\s\x{a0}]*(\d[\d\s\x{a0}]*)`)
+	// categoryLinkCountRe - количество товаров в скобках после названия подкатегории: "Токарные (125)"
+	categoryLinkCountRe = regexp.MustCompile(`\s*\(\d[\d\s]*\)$`)
+)
+
+// categoryNode - категория в дереве каталога
+type categoryNode struct {
+	Name          string          `json:"name"`
+	URL           string          `json:"url"`
+	Path          string          `json:"path"`           // Названия от корня: "Станки / Токарные"
+	Depth         int             `json:"depth"`          // 0 для категорий верхнего уровня
+	Products      int             `json:"products"`       // Количество товаров в категории
+	ProductsExact bool            `json:"products_exact"` // false - оценка по числу страниц
+	NoIndex       bool            `json:"noindex,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	Subcategories []*categoryNode `json:"subcategories,omitempty"`
+}
+
+// categoryDiscovery обходит страницы категорий и строит дерево подкатегорий
+type categoryDiscovery struct {
+	ctx      context.Context
+	maxDepth int
+	delayMs  int
+
+	semaphore chan struct{}
+	wg        sync.WaitGroup
+
+	mu   sync.Mutex
+	seen map[string]bool // Уже найденные категории: разделы каталога ссылаются друг на друга
+}
+
+// discoverCategoryTree загружает страницы категорий, определяет количество товаров в каждой
+// и рекурсивно находит подкатегории до глубины maxDepth (0 - без подкатегорий)
+func discoverCategoryTree(ctx context.Context, roots []Category, maxDepth, threads, delayMs int) []*categoryNode {
+	d := &categoryDiscovery{
+		ctx:       ctx,
+		maxDepth:  maxDepth,
+		delayMs:   delayMs,
+		semaphore: make(chan struct{}, threads),
+		seen:      make(map[string]bool),
+	}
+	status.TrackQueue("категорий", d.semaphore)
+
+	nodes := make([]*categoryNode, 0, len(roots))
+	for _, root := range roots {
+		d.seen[root.URL] = true
+		nodes = append(nodes, &categoryNode{Name: root.Name, URL: root.URL, Path: root.Name})
+	}
+
+	for _, node := range nodes {
+		d.wg.Add(1)
+		go d.visit(node)
+	}
+	d.wg.Wait()
+
+	return nodes
+}
+
+// visit загружает страницу категории, заполняет количество товаров и запускает обход подкатегорий.
+// Подкатегории узла заполняет только эта горутина, поэтому дерево не требует блокировок
+func (d *categoryDiscovery) visit(node *categoryNode) {
+	defer d.wg.Done()
+
+	if d.ctx.Err() != nil {
+		node.Error = "обход прерван"
+		return
+	}
+
+	d.semaphore <- struct{}{}
+	doc, header, err := fetchCategoryDocument(d.ctx, node.URL, d.delayMs)
+	<-d.semaphore
+
+	if err != nil {
+		node.Error = err.Error()
+		status.CountError("категории")
+		slog.Error("Ошибка при загрузке категории", "category", node.Path, "url", node.URL, "err", err)
+		return
+	}
+
+	// Подкатегории запрещенной к индексации категории при -skip-noindex не ищем: она будет убрана из дерева
+	node.NoIndex = pageNoIndex(doc, header)
+	if node.NoIndex && skipNoIndex {
+		slog.Info("Категория пропущена: страница запрещена к индексации", "category", node.Path)
+		return
+	}
+
+	node.Products, node.ProductsExact = countCategoryProducts(doc, Category{Name: node.Name, URL: node.URL})
+	stall.MarkPage()
+	slog.Info("Категория", "path", node.Path, "products", node.Products, "exact", node.ProductsExact)
+
+	if node.Depth >= d.maxDepth {
+		return
+	}
+
+	for _, child := range d.subcategories(doc, node) {
+		node.Subcategories = append(node.Subcategories, child)
+		d.wg.Add(1)
+		go d.visit(child)
+	}
+}
+
+// subcategories находит на странице категории ссылки на ее непосредственные подкатегории:
+// адреса на один уровень глубже адреса категории
+func (d *categoryDiscovery) subcategories(doc *goquery.Document, parent *categoryNode) []*categoryNode {
+	parentURL, err := url.Parse(parent.URL)
+	if err != nil {
+		return nil
+	}
+
+	var children []*categoryNode
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		u, err := parentURL.Parse(href)
+		if err != nil || u.Host != parentURL.Host || u.RawQuery != "" || strings.Contains(u.Path, ".html") {
+			return
+		}
+
+		rest, found := strings.CutPrefix(u.Path, parentURL.Path)
+		rest = strings.Trim(rest, "/")
+		if !found || rest == "" || strings.Contains(rest, "/") {
+			return
+		}
+
+		name := categoryLinkCountRe.ReplaceAllString(strings.Join(strings.Fields(s.Text()), " "), "")
+		if name == "" || len(name) >= 100 {
+			return
+		}
+
+		childURL := baseURL + strings.TrimSuffix(u.Path, "/") + "/"
+		if !scope.Allowed(childURL) || !robots.Allowed(childURL) {
+			return
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.seen[childURL] {
+			return
+		}
+		d.seen[childURL] = true
+
+		children = append(children, &categoryNode{
+			Name:  name,
+			URL:   childURL,
+			Path:  parent.Path + " / " + name,
+			Depth: parent.Depth + 1,
+		})
+	})
+
+	return children
+}
+
+// fetchCategoryDocument загружает и разбирает страницу категории; заголовки ответа нужны для X-Robots-Tag
+func fetchCategoryDocument(ctx context.Context, pageURL string, delayMs int) (*goquery.Document, http.Header, error) {
+	if err := waitTurn(ctx, pageURL); err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := doRequestWithRetry(ctx, pageURL, 2, delayMs)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("ошибка при получении страницы категории: %d", resp.StatusCode)
+	}
+
+	utf8Reader, err := responseUTF8Reader(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(utf8Reader)
+	return doc, resp.Header, err
+}
+
+// countCategoryProducts определяет количество товаров категории по первой странице.
+// Если сайт выводит количество ("Найдено 125 товаров"), оно точное; если страница одна,
+// товары считаются на ней; иначе количество оценивается как товары первой страницы,
+// умноженные на номер последней страницы пагинации
+func countCategoryProducts(doc *goquery.Document, category Category) (int, bool) {
+	if match := categoryCountRe.FindStringSubmatch(doc.Find("body").Text()); match != nil {
+		if n, err := strconv.Atoi(strings.Join(strings.Fields(match[1]+match[2]), "")); err == nil {
+			return n, true
+		}
+	}
+
+	page := parseListPage(doc, nil, category, true)
+	if !page.HasNextPage {
+		return len(page.Products), true
+	}
+
+	return len(page.Products) * page.LastPage, false
+}
+
+// runCategoriesMode строит дерево категорий и сохраняет его в <имя>.categories.json (дерево)
+// и <имя>.categories.csv (плоский список), не загружая товары
+func runCategoriesMode(ctx context.Context, roots []Category, namer *outputNamer, maxDepth, threads, delayMs int) {
+	sdNotify(fmt.Sprintf("STATUS=Поиск подкатегорий %d категорий", len(roots)))
+
+	tree := discoverCategoryTree(ctx, roots, maxDepth, threads, delayMs)
+	if skipNoIndex {
+		tree = pruneNoIndexCategories(tree)
+	}
+	flat := flattenCategoryTree(tree)
+
+	failed := 0
+	for _, node := range flat {
+		if node.Error != "" {
+			failed++
+		}
+	}
+	fmt.Printf("Дерево категорий: %d категорий верхнего уровня, всего %d, с ошибками %d\n", len(tree), len(flat), failed)
+
+	sdNotify("STATUS=Сохранение результатов")
+	filename := namer.Name("categories.json")
+	if err := saveToJSON(tree, filename); err != nil {
+		slog.Error("Ошибка при сохранении дерева категорий в JSON", "err", err)
+	} else {
+		fmt.Printf("Дерево категорий сохранено в файл %s\n", filename)
+		saveRunMetadata(filename, "categories.json", len(flat))
+	}
+
+	filename = namer.Name("categories.csv")
+	if err := saveCategoriesCSV(tree, filename); err != nil {
+		slog.Error("Ошибка при сохранении списка категорий в CSV", "err", err)
+	} else {
+		fmt.Printf("Список категорий сохранен в файл %s\n", filename)
+		saveRunMetadata(filename, "categories.csv", len(flat))
+	}
+}
+
+// pruneNoIndexCategories убирает из дерева категории, запрещенные к индексации, вместе с подкатегориями
+func pruneNoIndexCategories(nodes []*categoryNode) []*categoryNode {
+	kept := nodes[:0]
+	for _, node := range nodes {
+		if node.NoIndex {
+			continue
+		}
+		node.Subcategories = pruneNoIndexCategories(node.Subcategories)
+		kept = append(kept, node)
+	}
+	return kept
+}
+
+// flattenCategoryTree возвращает категории дерева в порядке обхода в глубину
+func flattenCategoryTree(nodes []*categoryNode) []*categoryNode {
+	var flat []*categoryNode
+	for _, node := range nodes {
+		flat = append(flat, node)
+		flat = append(flat, flattenCategoryTree(node.Subcategories)...)
+	}
+	return flat
+}
+
+// saveCategoriesCSV сохраняет дерево категорий плоским списком в CSV в оформлении -csv-delimiter
+func saveCategoriesCSV(nodes []*categoryNode, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// BOM для корректного отображения кириллицы в Excel и оформление CSV - как в saveToCSV
+	if err := writeBOM(file, filename); err != nil {
+		return err
+	}
+
+	writer := csvFormat.NewWriter(file)
+
+	if err := writer.Write([]string{"Путь", "Название", "URL", "Уровень", "Товаров", "Точно", "Noindex", "Ошибка"}); err != nil {
+		return err
+	}
+
+	for _, node := range flattenCategoryTree(nodes) {
+		exact := "нет"
+		if node.ProductsExact {
+			exact = "да"
+		}
+		noindex := ""
+		if node.NoIndex {
+			noindex = "да"
+		}
+		record := []string{node.Path, node.Name, node.URL, strconv.Itoa(node.Depth), strconv.Itoa(node.Products), exact, noindex, node.Error}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
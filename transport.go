@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// transportSettings - тайм-ауты отдельных этапов запроса и пул соединений HTTP-клиента парсера.
+// Общий тайм-аут запроса (-request-timeout) задается в http.Client и включает чтение тела
+type transportSettings struct {
+	DialTimeout           time.Duration // Установка TCP-соединения
+	TLSHandshakeTimeout   time.Duration // Согласование TLS
+	ResponseHeaderTimeout time.Duration // Ожидание заголовков ответа после отправки запроса
+	IdleConnTimeout       time.Duration // Сколько простаивающее соединение остается открытым
+	MaxIdleConnsPerHost   int           // Простаивающих соединений на хост, готовых к повторному использованию
+}
+
+// Validate проверяет, что тайм-ауты не отрицательные, а пул не пустой
+func (s transportSettings) Validate() error {
+	for _, timeout := range []struct {
+		flag  string
+		value time.Duration
+	}{
+		{"-dial-timeout", s.DialTimeout},
+		{"-tls-timeout", s.TLSHandshakeTimeout},
+		{"-response-header-timeout", s.ResponseHeaderTimeout},
+		{"-idle-conn-timeout", s.IdleConnTimeout},
+	} {
+		if timeout.value < 0 {
+			return fmt.Errorf("тайм-аут %s не может быть отрицательным", timeout.flag)
+		}
+	}
+	if s.MaxIdleConnsPerHost < 1 {
+		return fmt.Errorf("-max-idle-conns-per-host должен быть не меньше 1")
+	}
+	return nil
+}
+
+// newBaseTransport создает транспорт на основе стандартного с тайм-аутами settings; 0 - без ограничения.
+// Стандартный транспорт держит 2 простаивающих соединения на хост, и при большем числе потоков
+// остальные соединения закрываются после каждого запроса и открываются заново с TLS
+func newBaseTransport(settings transportSettings) *http.Transport {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.DialContext = (&net.Dialer{
+		Timeout:   settings.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	base.TLSHandshakeTimeout = settings.TLSHandshakeTimeout
+	base.ResponseHeaderTimeout = settings.ResponseHeaderTimeout
+	base.IdleConnTimeout = settings.IdleConnTimeout
+	base.MaxIdleConnsPerHost = settings.MaxIdleConnsPerHost
+	base.MaxIdleConns = max(base.MaxIdleConns, settings.MaxIdleConnsPerHost)
+	return base
+}
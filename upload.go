@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// uploadPasswordEnv - переменная окружения с паролем SFTP/FTP, если его нет в адресе -upload-url
+const uploadPasswordEnv = "PARSER_UPLOAD_PASSWORD"
+
+// uploadPartSuffix - суффикс файла на время загрузки. Файл получает свое имя только после
+// загрузки целиком, чтобы программа на стороне получателя не забрала его наполовину записанным
+const uploadPartSuffix = ".part"
+
+// uploadConn - соединение с сервером получателя
+type uploadConn interface {
+	// Put загружает локальный файл под именем remote+uploadPartSuffix и переименовывает его в remote
+	Put(ctx context.Context, local, remote string) error
+	Close() error
+}
+
+// fileDelivery загружает файлы результатов на сервер SFTP или FTP получателя (-upload-url)
+type fileDelivery struct {
+	target     *url.URL
+	password   string
+	keyFile    string // Закрытый ключ SSH для SFTP
+	knownHosts string // Файл известных ключей серверов SSH
+}
+
+// newFileDelivery проверяет адрес вида sftp://user@host:22/incoming, ftp://user@host/incoming
+// или ftps://... (FTP с явным TLS). Пароль берется из адреса или из PARSER_UPLOAD_PASSWORD
+func newFileDelivery(rawURL, keyFile, knownHosts string) (*fileDelivery, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch target.Scheme {
+	case "sftp", "ftp", "ftps":
+	default:
+		return nil, fmt.Errorf("неподдерживаемая схема %q (допустимо: sftp, ftp, ftps)", target.Scheme)
+	}
+	if target.Hostname() == "" {
+		return nil, fmt.Errorf("в адресе %q не указан сервер", rawURL)
+	}
+
+	d := &fileDelivery{target: target, keyFile: keyFile, knownHosts: knownHosts}
+	if password, ok := target.User.Password(); ok {
+		d.password = password
+	} else {
+		d.password = os.Getenv(uploadPasswordEnv)
+	}
+
+	// Ключи SSH проверяем сразу, а не после многочасового обхода
+	if target.Scheme == "sftp" {
+		if _, err := d.sshConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// String возвращает адрес получателя без пароля для сообщений
+func (d *fileDelivery) String() string {
+	return d.target.Redacted()
+}
+
+// user возвращает имя пользователя из адреса; для FTP без имени - anonymous
+func (d *fileDelivery) user() string {
+	if name := d.target.User.Username(); name != "" {
+		return name
+	}
+	if d.target.Scheme == "sftp" {
+		return os.Getenv("USER")
+	}
+	return "anonymous"
+}
+
+// remotePath возвращает путь файла на сервере: каталог из адреса и имя файла без локального каталога
+func (d *fileDelivery) remotePath(filename string) string {
+	return path.Join(d.target.Path, filepath.Base(filename))
+}
+
+func (d *fileDelivery) dial(ctx context.Context) (uploadConn, error) {
+	if d.target.Scheme == "sftp" {
+		return dialSFTP(ctx, d)
+	}
+	return dialFTP(ctx, d)
+}
+
+// UploadFiles загружает файлы через одно соединение и возвращает число загруженных.
+// После ошибки соединение открывается заново; каждый файл повторяется до трех раз
+func (d *fileDelivery) UploadFiles(ctx context.Context, filenames []string) int {
+	var conn uploadConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	uploaded := 0
+	for _, filename := range filenames {
+		remote := d.remotePath(filename)
+		var err error
+		for attempt := 0; attempt < 3; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryBackoff(attempt, 1000, 0)):
+				}
+			}
+			if conn == nil {
+				conn, err = d.dial(ctx)
+			}
+			if conn != nil {
+				if err = conn.Put(ctx, filename, remote); err != nil {
+					conn.Close()
+					conn = nil
+				}
+			}
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if err != nil {
+			slog.Error("Не удалось загрузить файл получателю", "file", filename, "target", d.String(), "err", err)
+			status.CountError("выгрузка")
+			continue
+		}
+		uploaded++
+		slog.Info("Файл загружен получателю", "file", filename, "target", d.String(), "path", remote)
+	}
+	return uploaded
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Variant - торговое предложение товара: исполнение с отдельными ID, ценой и наличием,
+// например станок с другим размером стола или мощностью двигателя
+type Variant struct {
+	ID           string            `json:"id"`
+	ParentID     string            `json:"parent_id"` // ID товара, к которому относится предложение
+	Name         string            `json:"name,omitempty"`
+	SKU          string            `json:"sku,omitempty"`
+	Price        string            `json:"price,omitempty"`
+	Availability string            `json:"availability,omitempty"`
+	InStock      bool              `json:"in_stock"`
+	Properties   map[string]string `json:"properties,omitempty"` // Свойства, которыми предложения различаются: "Размер стола" -> "1200x600"
+}
+
+// String возвращает предложение одной строкой для CSV: "1200x600, 5.5 кВт: 150000"
+func (v Variant) String() string {
+	names := slices.Sorted(maps.Keys(v.Properties))
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		values = append(values, v.Properties[name])
+	}
+
+	label := strings.Join(values, ", ")
+	if label == "" {
+		label = v.Name
+	}
+	if label == "" {
+		label = v.ID
+	}
+	if v.Price != "" {
+		label += ": " + v.Price
+	}
+	return label
+}
+
+// variantsText объединяет предложения через "|" для CSV и XLSX
+func variantsText(variants []Variant) string {
+	parts := make([]string, len(variants))
+	for i, v := range variants {
+		parts[i] = v.String()
+	}
+	return strings.Join(parts, "|")
+}
+
+// linkVariants проставляет предложениям ID товара, к которому они относятся
+func linkVariants(variants []Variant, parentID string) []Variant {
+	for i := range variants {
+		variants[i].ParentID = parentID
+	}
+	return variants
+}
+
+// variantRelation - строка файла связей: товар и одно его предложение
+type variantRelation struct {
+	ParentID  string
+	VariantID string
+	SKU       string
+	Name      string
+}
+
+// variantRelations перечисляет связи товаров с их предложениями в порядке товаров
+func variantRelations(products []Product) []variantRelation {
+	var relations []variantRelation
+	for _, product := range products {
+		for _, v := range product.Variants {
+			relations = append(relations, variantRelation{ParentID: product.ID, VariantID: v.ID, SKU: v.SKU, Name: v.Name})
+		}
+	}
+	return relations
+}
+
+// saveVariantRelations сохраняет связи товаров с предложениями в CSV в оформлении -csv-delimiter:
+// по файлу импорт восстанавливает иерархию, не разбирая колонку «Варианты»
+func saveVariantRelations(relations []variantRelation, filename string) error {
+	file, err := createResultFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeBOM(file, filename); err != nil {
+		return err
+	}
+
+	writer := csvFormat.NewWriter(file)
+	records := [][]string{{"ID товара", "ID предложения", "Артикул", "Название"}}
+	for _, r := range relations {
+		records = append(records, []string{r.ParentID, r.VariantID, r.SKU, r.Name})
+	}
+	return writer.WriteAll(records)
+}
+
+// lowestVariantPrice возвращает минимальную цену предложений - цену "от" для товара без своей цены
+func lowestVariantPrice(variants []Variant) string {
+	lowest, lowestValue := "", 0.0
+	for _, v := range variants {
+		if value, ok := parsePrice(v.Price); ok && (lowest == "" || value < lowestValue) {
+			lowest, lowestValue = v.Price, value
+		}
+	}
+	return lowest
+}
+
+// variantsEqual сравнивает предложения по ID, цене и наличию
+func variantsEqual(a, b []Variant) bool {
+	return slices.EqualFunc(a, b, func(x, y Variant) bool {
+		return x.ID == y.ID && x.Price == y.Price && x.Availability == y.Availability
+	})
+}
+
+// extractVariants находит торговые предложения на странице товара: сначала в параметрах
+// компонента Bitrix JCCatalogElement (в них есть свойства, которыми предложения различаются),
+// затем в разметке schema.org - несколько Offer в offers или hasVariant у ProductGroup
+func extractVariants(doc *goquery.Document) []Variant {
+	if variants := bitrixOffers(doc); len(variants) > 0 {
+		return variants
+	}
+	return jsonLDVariants(doc)
+}
+
+// bitrixOffers разбирает OFFERS и TREE_PROPS из вызова new JCCatalogElement({...}) шаблона
+// catalog.element. Параметры записаны литералом объекта JS (CUtil::PhpToJSObject), а не JSON
+func bitrixOffers(doc *goquery.Document) []Variant {
+	var variants []Variant
+
+	doc.Find("script").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		script := s.Text()
+		start := strings.Index(script, "JCCatalogElement(")
+		if start < 0 {
+			return true
+		}
+		literal, ok := jsBalancedObject(script, start)
+		if !ok {
+			return true
+		}
+
+		var params map[string]interface{}
+		if err := json.Unmarshal([]byte(jsObjectToJSON(literal)), &params); err != nil {
+			return true
+		}
+		offers, _ := params["OFFERS"].([]interface{})
+		if len(offers) == 0 {
+			return true
+		}
+
+		treeProps := bitrixTreeProps(params["TREE_PROPS"])
+		for _, item := range offers {
+			offer, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			variant := Variant{
+				ID:   jsonLDString(offer["ID"]),
+				Name: jsonLDString(offer["NAME"]),
+			}
+			if variant.ID == "" {
+				continue
+			}
+			variant.Price = bitrixOfferPrice(offer)
+
+			if canBuy, ok := offer["CAN_BUY"].(bool); ok {
+				variant.Availability = "OutOfStock"
+				if canBuy {
+					variant.Availability = "InStock"
+				}
+				variant.InStock = canBuy
+			}
+
+			if tree, ok := offer["TREE"].(map[string]interface{}); ok {
+				for key, valueID := range tree {
+					prop, ok := treeProps[strings.TrimPrefix(key, "PROP_")]
+					if !ok {
+						continue
+					}
+					if value := prop.values[jsonLDString(valueID)]; value != "" && value != "-" {
+						if variant.Properties == nil {
+							variant.Properties = make(map[string]string)
+						}
+						variant.Properties[prop.name] = value
+					}
+				}
+			}
+			variants = append(variants, variant)
+		}
+		return len(variants) == 0
+	})
+
+	return variants
+}
+
+// bitrixTreeProp - свойство предложений из TREE_PROPS: название и значения по ID
+type bitrixTreeProp struct {
+	name   string
+	values map[string]string
+}
+
+// bitrixTreeProps разбирает TREE_PROPS по ID свойства; VALUES бывает объектом или массивом
+func bitrixTreeProps(value interface{}) map[string]bitrixTreeProp {
+	props := make(map[string]bitrixTreeProp)
+	list, _ := value.([]interface{})
+	for _, item := range list {
+		node, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		prop := bitrixTreeProp{name: jsonLDString(node["NAME"]), values: make(map[string]string)}
+
+		var values []interface{}
+		switch v := node["VALUES"].(type) {
+		case map[string]interface{}:
+			for _, value := range v {
+				values = append(values, value)
+			}
+		case []interface{}:
+			values = v
+		}
+		for _, value := range values {
+			if entry, ok := value.(map[string]interface{}); ok {
+				prop.values[jsonLDString(entry["ID"])] = jsonLDString(entry["NAME"])
+			}
+		}
+		props[jsonLDString(node["ID"])] = prop
+	}
+	return props
+}
+
+// bitrixOfferPrice возвращает цену предложения: ITEM_PRICES (Bitrix 17+), MIN_PRICE или PRICE
+func bitrixOfferPrice(offer map[string]interface{}) string {
+	var raw string
+	if prices, ok := offer["ITEM_PRICES"].([]interface{}); ok && len(prices) > 0 {
+		if price, ok := prices[0].(map[string]interface{}); ok {
+			raw = jsonLDString(price["PRICE"])
+		}
+	}
+	for _, key := range []string{"MIN_PRICE", "PRICE"} {
+		if raw != "" {
+			break
+		}
+		if price, ok := offer[key].(map[string]interface{}); ok {
+			raw = jsonLDString(price["DISCOUNT_VALUE"])
+			if raw == "" {
+				raw = jsonLDString(price["VALUE"])
+			}
+		}
+	}
+	price, _ := normalizeEmbeddedPrice(raw)
+	return price
+}
+
+// jsonLDVariants извлекает предложения из JSON-LD: ProductGroup с hasVariant или Product
+// с несколькими Offer. Единственное предложение вариантом не считается
+func jsonLDVariants(doc *goquery.Document) []Variant {
+	var variants []Variant
+
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s.Text())), &data); err != nil {
+			return true
+		}
+
+		if group := findJSONLDType(data, "ProductGroup"); group != nil {
+			members, _ := group["hasVariant"].([]interface{})
+			for i, member := range members {
+				node, ok := member.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				variant := jsonLDOfferVariant(node, i)
+				variant.Name = jsonLDString(node["name"])
+				variant.SKU = jsonLDString(node["sku"])
+				variant.Properties = jsonLDVariantProperties(node)
+				if offer, ok := node["offers"].(map[string]interface{}); ok {
+					fromOffer := jsonLDOfferVariant(offer, i)
+					variant.Price, variant.Availability, variant.InStock = fromOffer.Price, fromOffer.Availability, fromOffer.InStock
+				}
+				if variant.SKU != "" {
+					variant.ID = variant.SKU
+				}
+				variants = append(variants, variant)
+			}
+			return len(variants) == 0
+		}
+
+		product := findJSONLDType(data, "Product")
+		if product == nil {
+			return true
+		}
+		offers, _ := product["offers"].([]interface{})
+		if len(offers) < 2 {
+			return true
+		}
+		for i, item := range offers {
+			if offer, ok := item.(map[string]interface{}); ok {
+				variants = append(variants, jsonLDOfferVariant(offer, i))
+			}
+		}
+		return len(variants) == 0
+	})
+
+	return variants
+}
+
+// jsonLDOfferVariant создает предложение из узла Offer; без sku ID - номер предложения
+func jsonLDOfferVariant(offer map[string]interface{}, index int) Variant {
+	variant := Variant{
+		ID:           jsonLDString(offer["sku"]),
+		SKU:          jsonLDString(offer["sku"]),
+		Name:         jsonLDString(offer["name"]),
+		Availability: schemaName(jsonLDString(offer["availability"])),
+	}
+	if variant.ID == "" {
+		variant.ID = fmt.Sprintf("%d", index+1)
+	}
+	variant.Price, _ = normalizeEmbeddedPrice(jsonLDString(offer["price"]))
+	variant.InStock = availabilityInStock(variant.Availability)
+	return variant
+}
+
+// jsonLDVariantProperties собирает свойства варианта: size, color, material и additionalProperty
+func jsonLDVariantProperties(node map[string]interface{}) map[string]string {
+	props := make(map[string]string)
+	for _, key := range []string{"size", "color", "material", "pattern"} {
+		if value := jsonLDName(node[key]); value != "" {
+			props[key] = value
+		}
+	}
+	extra, _ := node["additionalProperty"].([]interface{})
+	for _, item := range extra {
+		if prop, ok := item.(map[string]interface{}); ok {
+			if name, value := jsonLDString(prop["name"]), jsonLDString(prop["value"]); name != "" && value != "" {
+				props[name] = value
+			}
+		}
+	}
+	if len(props) == 0 {
+		return nil
+	}
+	return props
+}
+
+// jsBalancedObject возвращает литерал объекта, начинающийся с первой "{" после start,
+// до парной ей "}" с учетом строк в кавычках
+func jsBalancedObject(src string, start int) (string, bool) {
+	open := strings.IndexByte(src[start:], '{')
+	if open < 0 {
+		return "", false
+	}
+	open += start
+
+	depth := 0
+	var quote byte
+	for i := open; i < len(src); i++ {
+		c := src[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return src[open : i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// jsObjectToJSON приводит литерал объекта JS к JSON: строки в одинарных кавычках
+// заключаются в двойные, ключи без кавычек берутся в кавычки
+func jsObjectToJSON(src string) string {
+	var b strings.Builder
+	b.Grow(len(src))
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\'' || c == '"':
+			b.WriteByte('"')
+			for i++; i < len(src) && src[i] != c; i++ {
+				switch {
+				case src[i] == '\\' && i+1 < len(src):
+					i++
+					if src[i] == '\'' {
+						b.WriteByte('\'')
+					} else {
+						b.WriteByte('\\')
+						b.WriteByte(src[i])
+					}
+				case src[i] == '"':
+					b.WriteString(`\"`)
+				case src[i] == '\n':
+					b.WriteString(`\n`)
+				case src[i] == '\r':
+					b.WriteString(`\r`)
+				case src[i] == '\t':
+					b.WriteString(`\t`)
+				default:
+					b.WriteByte(src[i])
+				}
+			}
+			b.WriteByte('"')
+			i++
+		case c == '_' || c == '$' || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '$' || (src[j]|0x20 >= 'a' && src[j]|0x20 <= 'z') || (src[j] >= '0' && src[j] <= '9')) {
+				j++
+			}
+			word := src[i:j]
+			k := j
+			for k < len(src) && (src[k] == ' ' || src[k] == '\t' || src[k] == '\n' || src[k] == '\r') {
+				k++
+			}
+			if k < len(src) && src[k] == ':' {
+				b.WriteString(`"` + word + `"`)
+			} else {
+				b.WriteString(word)
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
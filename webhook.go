@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webhookSecretEnv - переменная окружения с секретом подписи уведомления. Секрет не передается
+// флагом, чтобы не попасть в список процессов и в сведения о запуске
+const webhookSecretEnv = "PARSER_WEBHOOK_SECRET"
+
+// Содержимое уведомления -webhook-payload
+const (
+	webhookLink     = "link"     // Ссылки на файлы результатов
+	webhookProducts = "products" // Ссылки и полный список товаров
+)
+
+// runWebhook отправляет уведомление о завершении запуска на -webhook-url
+type runWebhook struct {
+	client   *http.Client
+	url      string
+	payload  string
+	secret   string
+	linkBase string        // Адрес, по которому получатель скачивает файлы из каталога результатов
+	linkTTL  time.Duration // Срок действия подписанных ссылок S3
+}
+
+// newRunWebhook проверяет настройки. Для ссылок нужен источник: загрузка в S3 (подписанные ссылки)
+// или -webhook-link-base - адрес, по которому раздается каталог результатов
+func newRunWebhook(rawURL, payload, linkBase string, linkTTL time.Duration, withS3 bool) (*runWebhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("некорректный адрес %q", rawURL)
+	}
+	switch payload {
+	case webhookLink:
+		if !withS3 && linkBase == "" {
+			return nil, fmt.Errorf("для ссылок на файлы нужна загрузка в S3 (-s3-bucket) или -webhook-link-base")
+		}
+	case webhookProducts:
+	default:
+		return nil, fmt.Errorf("неизвестное содержимое %q (допустимо: link, products)", payload)
+	}
+	if linkTTL <= 0 || linkTTL > 7*24*time.Hour {
+		return nil, fmt.Errorf("срок действия ссылок должен быть от 1s до 168h: %s", linkTTL)
+	}
+	return &runWebhook{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		url:      rawURL,
+		payload:  payload,
+		secret:   os.Getenv(webhookSecretEnv),
+		linkBase: strings.TrimSuffix(linkBase, "/"),
+		linkTTL:  linkTTL,
+	}, nil
+}
+
+// webhookFile - файл результатов в уведомлении
+type webhookFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	URL  string `json:"url,omitempty"`
+}
+
+// webhookStats - итоги запуска в уведомлении
+type webhookStats struct {
+	Products int `json:"products"` // Найдено товаров
+	Exported int `json:"exported"` // Выведено в файлы после фильтров и режима -incremental
+	Changed  int `json:"changed"`
+	Removed  int `json:"removed"`
+	Errors   int `json:"errors"` // Потерянные категории и товары
+}
+
+// webhookPayload - тело уведомления
+type webhookPayload struct {
+	Event      string        `json:"event"`
+	RunID      string        `json:"run_id"`
+	Site       string        `json:"site"`
+	Locale     string        `json:"locale,omitempty"`
+	Version    string        `json:"version"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Stats      webhookStats  `json:"stats"`
+	Files      []webhookFile `json:"files"`
+	Products   []Product     `json:"products,omitempty"`
+}
+
+// Send собирает уведомление о завершенном запуске и отправляет его. Ссылки на файлы, загруженные
+// в S3, подписываются на linkTTL; остальные строятся от -webhook-link-base, если он задан
+func (w *runWebhook) Send(ctx context.Context, stats webhookStats, files []string, s3 *s3Uploader, s3Uploaded []string, products []Product) error {
+	now := time.Now()
+	payload := webhookPayload{
+		Event:      "run.completed",
+		RunID:      runMeta.RunID,
+		Site:       runMeta.Site,
+		Locale:     runMeta.Locale,
+		Version:    runMeta.Version,
+		StartedAt:  runMeta.StartedAt,
+		FinishedAt: now,
+		Stats:      stats,
+		Files:      []webhookFile{},
+	}
+	for _, filename := range files {
+		file := webhookFile{Name: filepath.Base(filename)}
+		if info, err := os.Stat(filename); err == nil {
+			file.Size = info.Size()
+		}
+		switch {
+		case s3 != nil && slices.Contains(s3Uploaded, filename):
+			file.URL = s3.PresignGet(s3.Key(filename), w.linkTTL, now)
+		case w.linkBase != "":
+			file.URL = w.linkBase + "/" + url.PathEscape(file.Name)
+		}
+		payload.Files = append(payload.Files, file)
+	}
+	if w.payload == webhookProducts {
+		payload.Products = products
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return w.post(ctx, body)
+}
+
+// post отправляет тело с подписью; при ошибках сети, 429 и 5xx повторяет до трех раз
+func (w *runWebhook) post(ctx context.Context, body []byte) error {
+	var lastErr error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryBackoff(attempt, 2000, 0)):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "parserEol/"+runMeta.Version)
+		req.Header.Set("X-Parser-Event", "run.completed")
+		req.Header.Set("X-Parser-Run-Id", runMeta.RunID)
+		if w.secret != "" {
+			timestamp, signature := webhookSignature(w.secret, body, time.Now())
+			req.Header.Set("X-Parser-Timestamp", timestamp)
+			req.Header.Set("X-Parser-Signature", signature)
+		}
+
+		resp, err := w.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("код ответа %d", resp.StatusCode)
+		if !retryableStatus(resp.StatusCode) {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+// webhookSignature подписывает уведомление: HMAC-SHA256 от "<timestamp>.<тело>" в hex.
+// Время входит в подпись, чтобы перехваченное уведомление нельзя было повторить позже
+func webhookSignature(secret string, body []byte, now time.Time) (timestamp, signature string) {
+	timestamp = strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return timestamp, "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
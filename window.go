@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schedule ограничивает время обхода сайта; nil означает, что ограничений нет
+var schedule *crawlSchedule
+
+// crawlWindow - интервал времени суток, в который разрешен обход.
+// Если конец меньше начала, интервал переходит через полночь
+type crawlWindow struct {
+	start time.Duration // Смещение от полуночи
+	end   time.Duration
+}
+
+// crawlSchedule - набор разрешенных интервалов. Вне их запросы приостанавливаются
+// и автоматически продолжаются, когда наступает очередной интервал
+type crawlSchedule struct {
+	windows []crawlWindow
+	mu      sync.Mutex
+	paused  bool
+}
+
+// parseCrawlWindows разбирает значение вида "01:00-06:00,22:00-23:30" (местное время)
+func parseCrawlWindows(value string) (*crawlSchedule, error) {
+	s := &crawlSchedule{}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to, found := strings.Cut(part, "-")
+		if !found {
+			return nil, fmt.Errorf("интервал %q должен иметь вид ЧЧ:ММ-ЧЧ:ММ", part)
+		}
+
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("интервал %q имеет нулевую длину", part)
+		}
+
+		s.windows = append(s.windows, crawlWindow{start: start, end: end})
+	}
+
+	if len(s.windows) == 0 {
+		return nil, fmt.Errorf("не задано ни одного интервала")
+	}
+
+	return s, nil
+}
+
+// parseClock разбирает время суток ЧЧ:ММ в смещение от полуночи
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("некорректное время %q, ожидается ЧЧ:ММ", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains проверяет, попадает ли момент t в один из интервалов
+func (s *crawlSchedule) contains(t time.Time) bool {
+	offset := sinceMidnight(t)
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if offset >= w.start && offset < w.end {
+				return true
+			}
+		} else if offset >= w.start || offset < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOpen возвращает ближайший момент начала разрешенного интервала после t
+func (s *crawlSchedule) nextOpen(t time.Time) time.Time {
+	midnight := t.Add(-sinceMidnight(t))
+
+	var next time.Time
+	for _, w := range s.windows {
+		candidate := midnight.Add(w.start)
+		if !candidate.After(t) {
+			candidate = candidate.AddDate(0, 0, 1)
+		}
+		if next.IsZero() || candidate.Before(next) {
+			next = candidate
+		}
+	}
+
+	return next
+}
+
+// Wait блокирует выполнение, пока текущее время находится вне разрешенных интервалов.
+// Все собранные данные при этом остаются в памяти, и обход продолжается с того же места
+func (s *crawlSchedule) Wait(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	for {
+		now := time.Now()
+		if s.contains(now) {
+			s.mu.Lock()
+			if s.paused {
+				s.paused = false
+				slog.Info("Наступило разрешенное время обхода, работа продолжается")
+			}
+			s.mu.Unlock()
+			return nil
+		}
+
+		next := s.nextOpen(now)
+
+		s.mu.Lock()
+		if !s.paused {
+			s.paused = true
+			slog.Info("Вне разрешенного времени обхода, пауза", "until", next.Format("02.01 15:04"))
+		}
+		s.mu.Unlock()
+
+		// Просыпаемся не реже раза в минуту, чтобы учесть перевод часов
+		timer := time.NewTimer(min(time.Until(next), time.Minute))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// sinceMidnight возвращает время, прошедшее с начала суток
+func sinceMidnight(t time.Time) time.Duration {
+	hour, minute, second := t.Clock()
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute +
+		time.Duration(second)*time.Second + time.Duration(t.Nanosecond())
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	xlsxProductsSheet  = "Товары"
+	xlsxSummarySheet   = "Сводка"
+	xlsxMaxColWidth    = 80 // Максимальная ширина колонки в символах
+	xlsxMaxSheetLength = 31 // Ограничение Excel на длину имени листа
+)
+
+// Варианты раскладки книги XLSX
+const (
+	xlsxLayoutSingle      = "single"       // Все товары на одном листе
+	xlsxLayoutPerCategory = "per-category" // Лист на каждую категорию и лист со сводкой
+)
+
+// xlsxStyles содержит идентификаторы стилей, общие для всех листов книги
+type xlsxStyles struct {
+	header int
+	price  int
+	text   int
+}
+
+// saveToXLSX сохраняет данные в файл Excel.
+// Строки записываются через потоковый writer excelize, поэтому книга на сотни тысяч
+// товаров не держится в памяти целиком.
+// При раскладке per-category каждая категория получает свой лист, а первым идет лист со сводкой.
+// Последний лист книги - сведения о запуске
+func saveToXLSX(products []Product, filename string, layout string) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	styles, err := newXLSXStyles(f)
+	if err != nil {
+		return err
+	}
+
+	if layout == xlsxLayoutPerCategory {
+		if err := writeCategorySheets(f, products, styles); err != nil {
+			return err
+		}
+		if err := writeRunSheet(f, len(products)); err != nil {
+			return err
+		}
+		return f.SaveAs(filename)
+	}
+
+	// Переименовываем лист по умолчанию, чтобы не создавать лишний пустой лист
+	if err := f.SetSheetName(f.GetSheetName(0), xlsxProductsSheet); err != nil {
+		return err
+	}
+
+	if err := writeProductSheet(f, xlsxProductsSheet, products, styles); err != nil {
+		return err
+	}
+	if err := writeRunSheet(f, len(products)); err != nil {
+		return err
+	}
+
+	return f.SaveAs(filename)
+}
+
+// writeCategorySheets создает лист со сводкой по категориям и по листу на каждую категорию.
+// Названия категорий в сводке - ссылки на их листы
+func writeCategorySheets(f *excelize.File, products []Product, styles xlsxStyles) error {
+	byCategory := make(map[string][]Product)
+	for _, product := range products {
+		byCategory[product.Category] = append(byCategory[product.Category], product)
+	}
+
+	if err := f.SetSheetName(f.GetSheetName(0), xlsxSummarySheet); err != nil {
+		return err
+	}
+
+	headers := []interface{}{"Категория", "Лист", "Товаров", "С ценой", "Мин. цена", "Макс. цена", "Медиана", "Без цены, %"}
+	if err := f.SetSheetRow(xlsxSummarySheet, "A1", &headers); err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(xlsxSummarySheet, "A1", "H1", styles.header); err != nil {
+		return err
+	}
+
+	used := map[string]bool{strings.ToLower(xlsxSummarySheet): true}
+	for i, stats := range computePriceStats(products) {
+		sheet := xlsxSheetName(stats.Category, used)
+		if _, err := f.NewSheet(sheet); err != nil {
+			return err
+		}
+		if err := writeProductSheet(f, sheet, byCategory[stats.Category], styles); err != nil {
+			return fmt.Errorf("лист %s: %v", sheet, err)
+		}
+
+		row := []interface{}{stats.Category, sheet, stats.Products, stats.Priced, nil, nil, nil,
+			math.Round(stats.MissingRatio*1000) / 10}
+		if stats.Priced > 0 {
+			row[4], row[5], row[6] = stats.Min, stats.Max, stats.Median
+		}
+
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(xlsxSummarySheet, cell, &row); err != nil {
+			return err
+		}
+
+		// Ссылка с названия листа на сам лист
+		linkCell, _ := excelize.CoordinatesToCellName(2, i+2)
+		location := "'" + strings.ReplaceAll(sheet, "'", "''") + "'!A1"
+		if err := f.SetCellHyperLink(xlsxSummarySheet, linkCell, location, "Location"); err != nil {
+			return err
+		}
+
+		priceFrom, _ := excelize.CoordinatesToCellName(5, i+2)
+		priceTo, _ := excelize.CoordinatesToCellName(7, i+2)
+		if err := f.SetCellStyle(xlsxSummarySheet, priceFrom, priceTo, styles.price); err != nil {
+			return err
+		}
+	}
+
+	if err := f.SetColWidth(xlsxSummarySheet, "A", "B", 40); err != nil {
+		return err
+	}
+	return f.SetColWidth(xlsxSummarySheet, "C", "H", 14)
+}
+
+// xlsxSheetName превращает название категории в допустимое и уникальное в книге имя листа:
+// Excel запрещает символы : \ / ? * [ ] и ограничивает длину 31 символом
+func xlsxSheetName(category string, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, category)
+	name = strings.Trim(strings.TrimSpace(name), "'")
+	if name == "" {
+		name = "Без категории"
+	}
+	name = truncateRunes(name, xlsxMaxSheetLength)
+
+	// Имена листов сравниваются без учета регистра
+	candidate := name
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		candidate = truncateRunes(name, xlsxMaxSheetLength-len(suffix)) + suffix
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// truncateRunes обрезает строку до n символов
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// newXLSXStyles регистрирует в книге стили заголовка и ячеек
+func newXLSXStyles(f *excelize.File) (xlsxStyles, error) {
+	var styles xlsxStyles
+	var err error
+
+	styles.header, err = f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"DDEBF7"}},
+		Alignment: &excelize.Alignment{Vertical: "center"},
+	})
+	if err != nil {
+		return styles, err
+	}
+
+	priceFormat := `#,##0 "₽"`
+	styles.price, err = f.NewStyle(&excelize.Style{CustomNumFmt: &priceFormat})
+	if err != nil {
+		return styles, err
+	}
+
+	// Формат "@" не дает Excel превращать длинные ID и артикулы в числа
+	styles.text, err = f.NewStyle(&excelize.Style{NumFmt: 49})
+	if err != nil {
+		return styles, err
+	}
+
+	return styles, nil
+}
+
+// writeProductSheet записывает товары на лист с закрепленной строкой заголовков
+// и шириной колонок, подобранной по содержимому
+func writeProductSheet(f *excelize.File, sheet string, products []Product, styles xlsxStyles) error {
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+
+	columns := newProductColumns(products)
+	headers := columns.Headers()
+
+	// Ширину колонок потоковый writer позволяет задать только до записи строк,
+	// поэтому вычисляем ее отдельным проходом по товарам
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = utf8.RuneCountInString(header)
+	}
+	for _, product := range products {
+		for i, value := range columns.Row(product) {
+			if width := utf8.RuneCountInString(value); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+	for i, width := range widths {
+		if err := sw.SetColWidth(i+1, i+1, float64(min(width+2, xlsxMaxColWidth))); err != nil {
+			return err
+		}
+	}
+
+	// Закрепляем строку заголовков
+	if err := sw.SetPanes(&excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		return err
+	}
+
+	headerRow := make([]interface{}, len(headers))
+	for i, header := range headers {
+		headerRow[i] = excelize.Cell{StyleID: styles.header, Value: header}
+	}
+	if err := sw.SetRow("A1", headerRow); err != nil {
+		return err
+	}
+
+	for rowIndex, product := range products {
+		values := columns.Row(product)
+		row := make([]interface{}, len(values))
+		for i, value := range values {
+			row[i] = value
+		}
+
+		// Числовой ID сохраняем числом, остальные - текстом
+		if id, err := strconv.ParseInt(product.ID, 10, 64); err == nil {
+			row[0] = id
+		} else {
+			row[0] = excelize.Cell{StyleID: styles.text, Value: product.ID}
+		}
+
+		// Цену сохраняем числом, если ее удалось разобрать, иначе оставляем текст ("Цена по запросу")
+		if price, ok := parsePrice(product.Price); ok {
+			row[4] = excelize.Cell{StyleID: styles.price, Value: price}
+		}
+
+		cell, err := excelize.CoordinatesToCellName(1, rowIndex+2)
+		if err != nil {
+			return err
+		}
+		if err := sw.SetRow(cell, row); err != nil {
+			return fmt.Errorf("ошибка записи строки %d: %v", rowIndex+2, err)
+		}
+	}
+
+	return sw.Flush()
+}